@@ -0,0 +1,80 @@
+// Package config настройки API Gateway
+package config
+
+import (
+	"common/configutil"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config настройки API Gateway: значения по умолчанию, затем JSON-файл из CONFIG_FILE,
+// затем переменные окружения
+type Config struct {
+	Port              int    `json:"port"`
+	OrderServiceURL   string `json:"order_service_url"`
+	PaymentServiceURL string `json:"payment_service_url"`
+
+	Tracing configutil.Tracing `json:"tracing"`
+
+	// ShutdownTimeout сколько ждать завершения начатых HTTP-запросов при остановке
+	ShutdownTimeout configutil.Duration `json:"shutdown_timeout"`
+}
+
+// Load загружает и проверяет настройки API Gateway
+func Load() (Config, error) {
+	cfg := Config{
+		Port:              8080,
+		OrderServiceURL:   "http://order-service:8083",
+		PaymentServiceURL: "http://payment-service:8082",
+		Tracing:           configutil.DefaultTracing(),
+		ShutdownTimeout:   configutil.Duration(30 * time.Second),
+	}
+	if err := configutil.LoadFile(&cfg); err != nil {
+		return Config{}, err
+	}
+
+	var env configutil.Env
+	env.Int(&cfg.Port, "HTTP_PORT")
+	env.String(&cfg.OrderServiceURL, "ORDER_SERVICE_URL")
+	env.String(&cfg.PaymentServiceURL, "PAYMENT_SERVICE_URL")
+	env.Duration(&cfg.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+	cfg.Tracing.FromEnv(&env)
+	if err := env.Err(); err != nil {
+		return Config{}, fmt.Errorf("invalid environment: %w", err)
+	}
+
+	// Пути запросов добавляются к адресу сервиса, поэтому завершающий слэш убираем
+	cfg.OrderServiceURL = strings.TrimRight(cfg.OrderServiceURL, "/")
+	cfg.PaymentServiceURL = strings.TrimRight(cfg.PaymentServiceURL, "/")
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate проверяет все настройки и возвращает все найденные ошибки сразу
+func (cfg Config) Validate() error {
+	return errors.Join(
+		configutil.ValidatePort("HTTP_PORT", cfg.Port),
+		validateServiceURL("ORDER_SERVICE_URL", cfg.OrderServiceURL),
+		validateServiceURL("PAYMENT_SERVICE_URL", cfg.PaymentServiceURL),
+		configutil.ValidatePositiveDuration("SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout),
+		cfg.Tracing.Validate(),
+	)
+}
+
+// validateServiceURL проверяет, что адрес сервиса — абсолютный http(s) URL
+func validateServiceURL(name string, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s: %q is not an http(s) URL such as http://order-service:8083", name, raw)
+	}
+	return nil
+}
@@ -116,6 +116,172 @@ const docTemplate = `{
                 }
             }
         },
+        "/order/{user_id}/{order_id}/cancel": {
+            "post": {
+                "description": "Отменяет заказ. Неоплаченный заказ сразу становится cancelled, для оплаченного запрашивается возврат средств",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Отменить заказ",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID заказа",
+                        "name": "order_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Заказ не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Заказ нельзя отменить в текущем статусе",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/order/{user_id}/{order_id}/fulfill": {
+            "post": {
+                "description": "Отмечает оплаченный заказ выполненным, после чего зарезервированная сумма списывается со счета",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Выполнить заказ",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID заказа",
+                        "name": "order_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Заказ не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Заказ еще не оплачен или уже закрыт",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/order/{user_id}/{order_id}/history": {
+            "get": {
+                "description": "Возвращает все переходы статуса указанного заказа с причиной и событием-источником",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Orders"
+                ],
+                "summary": "Получить историю статусов заказа",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID заказа",
+                        "name": "order_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "object",
+                                "additionalProperties": true
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Заказ не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/orders/{user_id}": {
             "get": {
                 "description": "Возвращает список всех заказов для указанного пользователя",
@@ -157,7 +323,7 @@ const docTemplate = `{
         },
         "/payment/{user_id}": {
             "get": {
-                "description": "Возвращает баланс указанного пользователя",
+                "description": "Возвращает баланс по журналу проводок (balance и ledger), сумму холдов по заказам (held) и доступный баланс (available)",
                 "produces": [
                     "application/json"
                 ],
@@ -179,9 +345,7 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "type": "object",
-                            "additionalProperties": {
-                                "type": "number"
-                            }
+                            "additionalProperties": true
                         }
                     },
                     "500": {
@@ -291,6 +455,222 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "404": {
+                        "description": "Счет не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/payment/{user_id}/transactions": {
+            "get": {
+                "description": "Возвращает пополнения, оплаты заказов и возвраты с суммой, балансом после операции, ID заказа и временем. Для следующей страницы передайте next_cursor в параметре cursor",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payments"
+                ],
+                "summary": "Получить историю операций",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало периода включительно (RFC 3339 или YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец периода не включительно (RFC 3339 или YYYY-MM-DD)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Курсор следующей страницы",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы, по умолчанию 50, не более 200",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Неверные параметры выборки",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Счет не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/payment/{user_id}/transfer": {
+            "post": {
+                "description": "Списывает сумму с баланса отправителя и зачисляет получателю. Повтор с тем же idempotency_key не выполняет перевод второй раз",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payments"
+                ],
+                "summary": "Перевести средства другому пользователю",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID отправителя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Получатель, сумма и ключ идемпотентности",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.TransferRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Счет отправителя или получателя не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Недостаточно средств",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Ключ идемпотентности использован для другого перевода",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/payment/{user_id}/withdraw": {
+            "put": {
+                "description": "Списывает сумму с баланса пользователя и возвращает новый баланс. Вывод сверх баланса отклоняется",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payments"
+                ],
+                "summary": "Вывести средства",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Сумма вывода",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.WithdrawRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Счет не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Недостаточно средств",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Ошибка сервера",
                         "schema": {
@@ -308,14 +688,22 @@ const docTemplate = `{
                 "amount": {
                     "description": "Баланс аккаунта",
                     "type": "number"
+                },
+                "currency": {
+                    "description": "Валюта, только RUB",
+                    "type": "string"
                 }
             }
         },
         "handler.CreateOrderRequest": {
             "type": "object",
             "properties": {
-                "order_id": {
-                    "description": "ID ордера",
+                "amount": {
+                    "description": "Сумма заказа, не более двух знаков после запятой",
+                    "type": "number"
+                },
+                "currency": {
+                    "description": "Валюта, только RUB",
                     "type": "string"
                 }
             }
@@ -324,8 +712,46 @@ const docTemplate = `{
             "type": "object",
             "properties": {
                 "amount": {
-                    "description": "Сумма пополнения",
+                    "description": "Сумма пополнения, не более двух знаков после запятой",
                     "type": "number"
+                },
+                "currency": {
+                    "description": "Валюта, только RUB",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.TransferRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Сумма перевода, не более двух знаков после запятой",
+                    "type": "number"
+                },
+                "currency": {
+                    "description": "Валюта, только RUB",
+                    "type": "string"
+                },
+                "idempotency_key": {
+                    "description": "Ключ, по которому повтор запроса не выполняет перевод второй раз",
+                    "type": "string"
+                },
+                "recipient_id": {
+                    "description": "ID пользователя-получателя",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.WithdrawRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Сумма вывода, не более двух знаков после запятой",
+                    "type": "number"
+                },
+                "currency": {
+                    "description": "Валюта, только RUB",
+                    "type": "string"
                 }
             }
         }
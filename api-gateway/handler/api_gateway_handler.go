@@ -2,7 +2,9 @@ package handler
 
 import (
 	"api-gateway/service"
+	"common/money"
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
 	"net/http"
 )
@@ -13,17 +15,34 @@ type APIGatewayHandler struct {
 
 // Структура для создания заказа
 type CreateOrderRequest struct {
-	OrderId string `json:"order_id"` // ID ордера
+	Amount   money.Amount `json:"amount" swaggertype:"number"` // Сумма заказа, не более двух знаков после запятой
+	Currency string       `json:"currency,omitempty"`          // Валюта, только RUB
 }
 
 // Структура для создания аккаунта
 type CreateAccountRequest struct {
-	Amount float64 `json:"amount"` // Баланс аккаунта
+	Amount   money.Amount `json:"amount" swaggertype:"number"` // Баланс аккаунта
+	Currency string       `json:"currency,omitempty"`          // Валюта, только RUB
 }
 
 // Структура для пополнения баланса
 type DepositRequest struct {
-	Amount float64 `json:"amount"` // Сумма пополнения
+	Amount   money.Amount `json:"amount" swaggertype:"number"` // Сумма пополнения, не более двух знаков после запятой
+	Currency string       `json:"currency,omitempty"`          // Валюта, только RUB
+}
+
+// Структура для вывода средств
+type WithdrawRequest struct {
+	Amount   money.Amount `json:"amount" swaggertype:"number"` // Сумма вывода, не более двух знаков после запятой
+	Currency string       `json:"currency,omitempty"`          // Валюта, только RUB
+}
+
+// Структура для перевода средств
+type TransferRequest struct {
+	RecipientID    string       `json:"recipient_id"`                // ID пользователя-получателя
+	Amount         money.Amount `json:"amount" swaggertype:"number"` // Сумма перевода, не более двух знаков после запятой
+	Currency       string       `json:"currency,omitempty"`          // Валюта, только RUB
+	IdempotencyKey string       `json:"idempotency_key"`             // Ключ, по которому повтор запроса не выполняет перевод второй раз
 }
 
 func NewAPIGatewayHandler(svc *service.APIGatewayService) *APIGatewayHandler {
@@ -48,11 +67,19 @@ func (h *APIGatewayHandler) CreateOrder(w http.ResponseWriter, r *http.Request)
 
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := money.ValidateCurrency(req.Currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	orderId, err := h.svc.CreateOrder(userId, req.OrderId) // Передаем order_id
+	orderId, err := h.svc.CreateOrder(r.Context(), userId, req.Amount)
+	if errors.Is(err, service.ErrInvalidOrder) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -72,7 +99,7 @@ func (h *APIGatewayHandler) CreateOrder(w http.ResponseWriter, r *http.Request)
 func (h *APIGatewayHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
 	userId := mux.Vars(r)["user_id"]
 
-	orders, err := h.svc.GetOrders(userId)
+	orders, err := h.svc.GetOrders(r.Context(), userId)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -94,7 +121,7 @@ func (h *APIGatewayHandler) GetOrderStatus(w http.ResponseWriter, r *http.Reques
 	userId := mux.Vars(r)["user_id"]
 	orderId := mux.Vars(r)["order_id"]
 
-	status, err := h.svc.GetOrderStatus(userId, orderId)
+	status, err := h.svc.GetOrderStatus(r.Context(), userId, orderId)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -102,6 +129,77 @@ func (h *APIGatewayHandler) GetOrderStatus(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(map[string]string{"status": status})
 }
 
+// GetOrderHistory возвращает историю статусов заказа
+// @Summary Получить историю статусов заказа
+// @Description Возвращает все переходы статуса указанного заказа с причиной и событием-источником
+// @Tags Orders
+// @Produce json
+// @Param user_id path string true "ID пользователя"
+// @Param order_id path string true "ID заказа"
+// @Success 200 {array} map[string]interface{}
+// @Failure 404 {string} string "Заказ не найден"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /order/{user_id}/{order_id}/history [get]
+func (h *APIGatewayHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	orderId := mux.Vars(r)["order_id"]
+
+	history, err := h.svc.GetOrderHistory(r.Context(), userId, orderId)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	json.NewEncoder(w).Encode(history)
+}
+
+// CancelOrder отменяет заказ
+// @Summary Отменить заказ
+// @Description Отменяет заказ. Неоплаченный заказ сразу становится cancelled, для оплаченного запрашивается возврат средств
+// @Tags Orders
+// @Produce json
+// @Param user_id path string true "ID пользователя"
+// @Param order_id path string true "ID заказа"
+// @Success 200 {object} map[string]string
+// @Failure 404 {string} string "Заказ не найден"
+// @Failure 409 {string} string "Заказ нельзя отменить в текущем статусе"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /order/{user_id}/{order_id}/cancel [post]
+func (h *APIGatewayHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	orderId := mux.Vars(r)["order_id"]
+
+	status, err := h.svc.CancelOrder(r.Context(), userId, orderId)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// FulfillOrder отмечает заказ выполненным
+// @Summary Выполнить заказ
+// @Description Отмечает оплаченный заказ выполненным, после чего зарезервированная сумма списывается со счета
+// @Tags Orders
+// @Produce json
+// @Param user_id path string true "ID пользователя"
+// @Param order_id path string true "ID заказа"
+// @Success 200 {object} map[string]string
+// @Failure 404 {string} string "Заказ не найден"
+// @Failure 409 {string} string "Заказ еще не оплачен или уже закрыт"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /order/{user_id}/{order_id}/fulfill [post]
+func (h *APIGatewayHandler) FulfillOrder(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	orderId := mux.Vars(r)["order_id"]
+
+	status, err := h.svc.FulfillOrder(r.Context(), userId, orderId)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
 // CreateAccount создает новый платежный аккаунт
 // @Summary Создать новый платежный аккаунт
 // @Description Создает новый платежный аккаунт для указанного пользователя
@@ -116,16 +214,18 @@ func (h *APIGatewayHandler) GetOrderStatus(w http.ResponseWriter, r *http.Reques
 // @Router /payment/{user_id} [post]
 func (h *APIGatewayHandler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 	userId := mux.Vars(r)["user_id"]
-	var req struct {
-		Amount float64 `json:"amount"`
-	}
+	var req CreateAccountRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := money.ValidateCurrency(req.Currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	accountId, err := h.svc.CreateAccount(userId, req.Amount)
+	accountId, err := h.svc.CreateAccount(r.Context(), userId, req.Amount)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -141,22 +241,54 @@ func (h *APIGatewayHandler) CreateAccount(w http.ResponseWriter, r *http.Request
 
 // GetBalance получает баланс пользователя
 // @Summary Получить баланс пользователя
-// @Description Возвращает баланс указанного пользователя
+// @Description Возвращает баланс по журналу проводок (balance и ledger), сумму холдов по заказам (held) и доступный баланс (available)
 // @Tags Payments
 // @Produce json
 // @Param user_id path string true "ID пользователя"
-// @Success 200 {object} map[string]float64
+// @Success 200 {object} map[string]interface{}
 // @Failure 500 {string} string "Ошибка сервера"
 // @Router /payment/{user_id} [get]
 func (h *APIGatewayHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	userId := mux.Vars(r)["user_id"]
 
-	balance, err := h.svc.GetBalance(userId)
+	balance, err := h.svc.GetBalance(r.Context(), userId)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]float64{"balance": balance})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"balance":   balance.Ledger,
+		"ledger":    balance.Ledger,
+		"held":      balance.Held,
+		"available": balance.Available,
+		"currency":  money.Currency,
+	})
+}
+
+// GetTransactions возвращает историю операций по счету пользователя
+// @Summary Получить историю операций
+// @Description Возвращает пополнения, оплаты заказов и возвраты с суммой, балансом после операции, ID заказа и временем. Для следующей страницы передайте next_cursor в параметре cursor
+// @Tags Payments
+// @Produce json
+// @Param user_id path string true "ID пользователя"
+// @Param from query string false "Начало периода включительно (RFC 3339 или YYYY-MM-DD)"
+// @Param to query string false "Конец периода не включительно (RFC 3339 или YYYY-MM-DD)"
+// @Param cursor query string false "Курсор следующей страницы"
+// @Param limit query int false "Размер страницы, по умолчанию 50, не более 200"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {string} string "Неверные параметры выборки"
+// @Failure 404 {string} string "Счет не найден"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /payment/{user_id}/transactions [get]
+func (h *APIGatewayHandler) GetTransactions(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+
+	page, err := h.svc.GetTransactions(r.Context(), userId, r.URL.RawQuery)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	json.NewEncoder(w).Encode(page)
 }
 
 // Deposit обновляет баланс пользователя
@@ -169,6 +301,7 @@ func (h *APIGatewayHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 // @Param request body DepositRequest true "Сумма пополнения"
 // @Success 200 {string} string "Пополнение прошло успешно"
 // @Failure 400 {string} string "Неверный запрос"
+// @Failure 404 {string} string "Счет не найден"
 // @Failure 500 {string} string "Ошибка сервера"
 // @Router /payment/{user_id}/deposit [put]
 func (h *APIGatewayHandler) Deposit(w http.ResponseWriter, r *http.Request) {
@@ -177,15 +310,114 @@ func (h *APIGatewayHandler) Deposit(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := money.ValidateCurrency(req.Currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	err = h.svc.Deposit(userId, req.Amount)
+	err = h.svc.Deposit(r.Context(), userId, req.Amount)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Пополнение прошло успешно"))
 }
+
+// Withdraw выводит средства со счета пользователя
+// @Summary Вывести средства
+// @Description Списывает сумму с баланса пользователя и возвращает новый баланс. Вывод сверх баланса отклоняется
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param user_id path string true "ID пользователя"
+// @Param request body WithdrawRequest true "Сумма вывода"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {string} string "Неверный запрос"
+// @Failure 404 {string} string "Счет не найден"
+// @Failure 409 {string} string "Недостаточно средств"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /payment/{user_id}/withdraw [put]
+func (h *APIGatewayHandler) Withdraw(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	var req WithdrawRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := money.ValidateCurrency(req.Currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	balance, err := h.svc.Withdraw(r.Context(), userId, req.Amount)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"balance": balance, "currency": money.Currency})
+}
+
+// Transfer переводит средства другому пользователю
+// @Summary Перевести средства другому пользователю
+// @Description Списывает сумму с баланса отправителя и зачисляет получателю. Повтор с тем же idempotency_key не выполняет перевод второй раз
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param user_id path string true "ID отправителя"
+// @Param request body TransferRequest true "Получатель, сумма и ключ идемпотентности"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {string} string "Неверный запрос"
+// @Failure 404 {string} string "Счет отправителя или получателя не найден"
+// @Failure 409 {string} string "Недостаточно средств"
+// @Failure 422 {string} string "Ключ идемпотентности использован для другого перевода"
+// @Failure 500 {string} string "Ошибка сервера"
+// @Router /payment/{user_id}/transfer [post]
+func (h *APIGatewayHandler) Transfer(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	var req TransferRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := money.ValidateCurrency(req.Currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RecipientID == "" || req.IdempotencyKey == "" {
+		http.Error(w, "recipient_id and idempotency_key are required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.Transfer(r.Context(), userId, req.RecipientID, req.Amount, req.IdempotencyKey)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(result)
+}
+
+// errorStatus подбирает HTTP статус для ошибки сервиса, повторяя статус, которым ответил
+// order-service или payment-service
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidOrder), errors.Is(err, service.ErrInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInsufficientFunds), errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
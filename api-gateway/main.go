@@ -1,13 +1,23 @@
 package main
 
 import (
+	"api-gateway/config"
 	_ "api-gateway/docs"
 	"api-gateway/handler"
 	"api-gateway/service"
+	"common/health"
+	"common/httpserver"
+	"common/metrics"
+	"common/tracing"
+	"context"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"log"
-	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 // @title API Gateway
@@ -16,21 +26,63 @@ import (
 // @host localhost:8080
 // @BasePath /
 func main() {
-	apiGatewaySvc := service.NewAPIGatewayService()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Could not load configuration: %v", err)
+	}
+
+	// По SIGINT/SIGTERM сервер перестает принимать запросы и дожидается начатых
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Запросы к сервисам продолжают трассировку входящего запроса
+	shutdownTracing, err := tracing.Setup(ctx, "api-gateway", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Could not set up tracing: %v", err)
+	}
+
+	apiGatewaySvc := service.NewAPIGatewayService(cfg.OrderServiceURL, cfg.PaymentServiceURL)
 	apiGatewayHandler := handler.NewAPIGatewayHandler(apiGatewaySvc)
 
 	r := mux.NewRouter()
+	// Время обработки запросов по маршрутам для /metrics
+	r.Use(metrics.Middleware)
+	r.Use(tracing.Middleware)
 
 	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
+	// Gateway готов, когда отвечают оба сервиса
+	readiness := health.NewChecker()
+	readiness.Add("order-service", apiGatewaySvc.CheckOrderService)
+	readiness.Add("payment-service", apiGatewaySvc.CheckPaymentService)
+	r.Handle("/metrics", promhttp.Handler())
+	r.HandleFunc("/healthz", health.Live).Methods("GET")
+	r.Handle("/readyz", readiness).Methods("GET")
+
 	r.HandleFunc("/order/{user_id}", apiGatewayHandler.CreateOrder).Methods("POST")
 	r.HandleFunc("/orders/{user_id}", apiGatewayHandler.GetOrders).Methods("GET")
 	r.HandleFunc("/order/{user_id}/{order_id}", apiGatewayHandler.GetOrderStatus).Methods("GET")
+	r.HandleFunc("/order/{user_id}/{order_id}/history", apiGatewayHandler.GetOrderHistory).Methods("GET")
+	r.HandleFunc("/order/{user_id}/{order_id}/cancel", apiGatewayHandler.CancelOrder).Methods("POST")
+	r.HandleFunc("/order/{user_id}/{order_id}/fulfill", apiGatewayHandler.FulfillOrder).Methods("POST")
+
+	r.HandleFunc("/payment/{user_id}", apiGatewayHandler.CreateAccount).Methods("POST")    // Create account
+	r.HandleFunc("/payment/{user_id}", apiGatewayHandler.GetBalance).Methods("GET")        // Get balance
+	r.HandleFunc("/payment/{user_id}/deposit", apiGatewayHandler.Deposit).Methods("PUT")   // Deposit
+	r.HandleFunc("/payment/{user_id}/withdraw", apiGatewayHandler.Withdraw).Methods("PUT") // Withdraw
+	r.HandleFunc("/payment/{user_id}/transfer", apiGatewayHandler.Transfer).Methods("POST")
+	r.HandleFunc("/payment/{user_id}/transactions", apiGatewayHandler.GetTransactions).Methods("GET")
 
-	r.HandleFunc("/payment/{user_id}", apiGatewayHandler.CreateAccount).Methods("POST")  // Create account
-	r.HandleFunc("/payment/{user_id}", apiGatewayHandler.GetBalance).Methods("GET")      // Get balance
-	r.HandleFunc("/payment/{user_id}/deposit", apiGatewayHandler.Deposit).Methods("PUT") // Deposit
+	addr := fmt.Sprintf(":%d", cfg.Port)
+	log.Printf("Server started on %s", addr)
+	serveErr := httpserver.Serve(ctx, addr, tracing.Handler(r), time.Duration(cfg.ShutdownTimeout))
 
-	log.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	// Недоотправленные спаны отправляются до выхода
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+	if serveErr != nil {
+		log.Fatalf("HTTP server failed: %v", serveErr)
+	}
+	log.Printf("Server stopped")
 }
@@ -2,30 +2,130 @@ package service
 
 import (
 	"bytes"
+	"common/money"
+	"common/tracing"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 )
 
-type APIGatewayService struct{}
+var (
+	// ErrInsufficientFunds возвращается, когда payment-service отклоняет списание сверх баланса
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrInvalidOrder возвращается, когда order-service отклоняет заказ, например с неположительной суммой
+	ErrInvalidOrder = errors.New("invalid order")
+	// ErrIdempotencyKeyReused возвращается, когда ключ идемпотентности уже использован для другого перевода
+	ErrIdempotencyKeyReused = errors.New("idempotency key already used for a different transfer")
+	// ErrInvalidRequest возвращается, когда сервис отклоняет параметры запроса
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrNotFound возвращается, когда сервис не нашел заказ или счет
+	ErrNotFound = errors.New("not found")
+	// ErrConflict возвращается, когда операция невозможна в текущем состоянии, например отмена выполненного заказа
+	ErrConflict = errors.New("conflict")
+)
+
+type APIGatewayService struct {
+	orderServiceURL   string // Адрес order-service без завершающего слэша
+	paymentServiceURL string // Адрес payment-service без завершающего слэша
+	client            *http.Client
+}
+
+func NewAPIGatewayService(orderServiceURL string, paymentServiceURL string) *APIGatewayService {
+	return &APIGatewayService{
+		orderServiceURL:   orderServiceURL,
+		paymentServiceURL: paymentServiceURL,
+		// Запросы к сервисам передают контекст трассировки входящего запроса
+		client: &http.Client{Transport: tracing.Transport(http.DefaultTransport)},
+	}
+}
+
+// send отправляет запрос к сервису в контексте входящего запроса: если клиент отключился
+// или gateway останавливается, запрос к сервису тоже отменяется
+func (svc *APIGatewayService) send(ctx context.Context, method string, url string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return svc.client.Do(req)
+}
+
+// rejection переводит ответ сервиса со статусом 4xx в ошибку с тем же смыслом, чтобы клиент
+// получил от gateway статус сервиса, а не 500. Для остальных статусов возвращает nil.
+func rejection(resp *http.Response, body []byte) error {
+	var kind error
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		kind = ErrNotFound
+	case resp.StatusCode == http.StatusConflict:
+		kind = ErrConflict
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		kind = ErrInvalidRequest
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w: %s", kind, failureMessage(resp, body))
+}
+
+// failureMessage достает сообщение об ошибке из JSON-ответа сервиса
+func failureMessage(resp *http.Response, body []byte) string {
+	var failure struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &failure); err != nil || failure.Message == "" {
+		return resp.Status
+	}
+	return failure.Message
+}
+
+// CheckOrderService проверка готовности: order-service доступен и жив
+func (svc *APIGatewayService) CheckOrderService(ctx context.Context) error {
+	return svc.checkService(ctx, svc.orderServiceURL)
+}
 
-func NewAPIGatewayService() *APIGatewayService {
-	return &APIGatewayService{}
+// CheckPaymentService проверка готовности: payment-service доступен и жив
+func (svc *APIGatewayService) CheckPaymentService(ctx context.Context) error {
+	return svc.checkService(ctx, svc.paymentServiceURL)
+}
+
+// checkService запрашивает /healthz сервиса. Готовность самого сервиса не проверяется:
+// если у него недоступна база, gateway все равно может обслуживать запросы к другому сервису.
+func (svc *APIGatewayService) checkService(ctx context.Context, serviceURL string) error {
+	resp, err := svc.send(ctx, http.MethodGet, serviceURL+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s/healthz returned status: %d", serviceURL, resp.StatusCode)
+	}
+	return nil
 }
 
 // CreateOrder отправляет запрос на создание заказа в order-service
-func (svc *APIGatewayService) CreateOrder(userId string, orderId string) (string, error) {
+func (svc *APIGatewayService) CreateOrder(ctx context.Context, userId string, amount money.Amount) (string, error) {
 	orderData := map[string]interface{}{
 		"user_id":  userId,
-		"order_id": orderId,
+		"amount":   amount,
+		"currency": money.Currency,
 	}
 	data, err := json.Marshal(orderData)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal order data: %v", err)
 	}
 
-	resp, err := http.Post("http://order-service:8083/order/"+userId, "application/json", bytes.NewReader(data))
+	resp, err := svc.send(ctx, http.MethodPost, svc.orderServiceURL+"/order/"+userId, data)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request to order service: %v", err)
 	}
@@ -36,28 +136,24 @@ func (svc *APIGatewayService) CreateOrder(userId string, orderId string) (string
 		return "", fmt.Errorf("failed to read response body: %v", err)
 	}
 
-	fmt.Println("Response Body:", string(body))
-
-	if string(body) != "" {
-		return string(body), nil
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return "", fmt.Errorf("%w: %s", ErrInvalidOrder, failureMessage(resp, body))
 	}
-
-	var result map[string]interface{}
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %v", err)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to create order: %s - %s", resp.Status, string(body))
 	}
 
-	if orderId, ok := result["order_id"].(string); ok {
-		return orderId, nil
+	// order-service отвечает ID заказа JSON-строкой
+	var orderId string
+	if err := json.Unmarshal(body, &orderId); err != nil || orderId == "" {
+		return "", fmt.Errorf("unexpected response from order service: %s", string(body))
 	}
-
-	return "", fmt.Errorf("unexpected response: %v", result)
+	return orderId, nil
 }
 
 // GetOrders отправляет запрос на получение заказов в order-service
-func (svc *APIGatewayService) GetOrders(userId string) ([]map[string]interface{}, error) {
-	resp, err := http.Get("http://order-service:8083/orders/" + userId)
+func (svc *APIGatewayService) GetOrders(ctx context.Context, userId string) ([]map[string]interface{}, error) {
+	resp, err := svc.send(ctx, http.MethodGet, svc.orderServiceURL+"/orders/"+userId, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request to order service: %v", err)
 	}
@@ -77,8 +173,8 @@ func (svc *APIGatewayService) GetOrders(userId string) ([]map[string]interface{}
 }
 
 // GetOrderStatus отправляет запрос на получение статуса заказа в order-service
-func (svc *APIGatewayService) GetOrderStatus(userId, orderId string) (string, error) {
-	resp, err := http.Get("http://order-service:8083/order/" + userId + "/" + orderId)
+func (svc *APIGatewayService) GetOrderStatus(ctx context.Context, userId, orderId string) (string, error) {
+	resp, err := svc.send(ctx, http.MethodGet, svc.orderServiceURL+"/order/"+userId+"/"+orderId, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request to order service: %v", err)
 	}
@@ -101,18 +197,102 @@ func (svc *APIGatewayService) GetOrderStatus(userId, orderId string) (string, er
 	return "", fmt.Errorf("unexpected response: %v", result)
 }
 
+// GetOrderHistory отправляет запрос на получение истории статусов заказа в order-service
+func (svc *APIGatewayService) GetOrderHistory(ctx context.Context, userId, orderId string) ([]map[string]interface{}, error) {
+	resp, err := svc.send(ctx, http.MethodGet, svc.orderServiceURL+"/order/"+userId+"/"+orderId+"/history", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to order service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if err := rejection(resp, body); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("order service returned status: %d", resp.StatusCode)
+	}
+
+	var history []map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&history)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return history, nil
+}
+
+// CancelOrder отправляет запрос на отмену заказа в order-service и возвращает новый статус заказа
+func (svc *APIGatewayService) CancelOrder(ctx context.Context, userId, orderId string) (string, error) {
+	resp, err := svc.send(ctx, http.MethodPost, svc.orderServiceURL+"/order/"+userId+"/"+orderId+"/cancel", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request to order service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if err := rejection(resp, body); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to cancel order: %s - %s", resp.Status, string(body))
+	}
+
+	var result map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	if status, ok := result["status"].(string); ok {
+		return status, nil
+	}
+
+	return "", fmt.Errorf("unexpected response: %v", result)
+}
+
+// FulfillOrder отправляет запрос на выполнение заказа в order-service
+func (svc *APIGatewayService) FulfillOrder(ctx context.Context, userId, orderId string) (string, error) {
+	resp, err := svc.send(ctx, http.MethodPost, svc.orderServiceURL+"/order/"+userId+"/"+orderId+"/fulfill", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request to order service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if err := rejection(resp, body); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to fulfill order: %s - %s", resp.Status, string(body))
+	}
+
+	var result map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	if status, ok := result["status"].(string); ok {
+		return status, nil
+	}
+
+	return "", fmt.Errorf("unexpected response: %v", result)
+}
+
 // CreateAccount отправляет запрос на создание аккаунта в payment-service
-func (svc *APIGatewayService) CreateAccount(userId string, amount float64) (string, error) {
+func (svc *APIGatewayService) CreateAccount(ctx context.Context, userId string, amount money.Amount) (string, error) {
 	accountData := map[string]interface{}{
-		"user_id": userId,
-		"amount":  amount,
+		"user_id":  userId,
+		"amount":   amount,
+		"currency": money.Currency,
 	}
 	data, err := json.Marshal(accountData)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal account data: %v", err)
 	}
 
-	resp, err := http.Post("http://payment-service:8082/payment/"+userId, "application/json", bytes.NewReader(data))
+	resp, err := svc.send(ctx, http.MethodPost, svc.paymentServiceURL+"/payment/"+userId, data)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request to payment service: %v", err)
 	}
@@ -126,35 +306,74 @@ func (svc *APIGatewayService) CreateAccount(userId string, amount float64) (stri
 	return "", fmt.Errorf("payment service error: %s", string(body))
 }
 
+// Balance баланс пользователя по журналу проводок и доступная часть за вычетом холдов по заказам
+type Balance struct {
+	Ledger    money.Amount `json:"ledger"`
+	Held      money.Amount `json:"held"`
+	Available money.Amount `json:"available"`
+}
+
 // GetBalance отправляет запрос на получение баланса пользователя в payment-service
-func (svc *APIGatewayService) GetBalance(userId string) (float64, error) {
-	resp, err := http.Get("http://payment-service:8082/payment/" + userId)
+func (svc *APIGatewayService) GetBalance(ctx context.Context, userId string) (Balance, error) {
+	resp, err := svc.send(ctx, http.MethodGet, svc.paymentServiceURL+"/payment/"+userId, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to send request to payment service: %v", err)
+		return Balance{}, fmt.Errorf("failed to send request to payment service: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("payment service returned status: %d", resp.StatusCode)
+		return Balance{}, fmt.Errorf("payment service returned status: %d", resp.StatusCode)
 	}
 
-	var result struct {
-		Balance float64 `json:"balance"`
-	}
+	var result Balance
 	err = json.NewDecoder(resp.Body).Decode(&result)
 	if err != nil {
-		return 0, fmt.Errorf("failed to decode response: %v", err)
+		return Balance{}, fmt.Errorf("failed to decode response: %v", err)
 	}
 
-	return result.Balance, nil
+	return result, nil
+}
+
+// GetTransactions отправляет запрос на получение истории операций в payment-service.
+// Параметры выборки (from, to, cursor, limit) передаются без изменений, а ответ
+// возвращается как есть, чтобы суммы не проходили через float64.
+func (svc *APIGatewayService) GetTransactions(ctx context.Context, userId string, rawQuery string) (json.RawMessage, error) {
+	url := svc.paymentServiceURL + "/payment/" + userId + "/transactions"
+	if rawQuery != "" {
+		url += "?" + rawQuery
+	}
+
+	resp, err := svc.send(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to payment service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if err := rejection(resp, body); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get transactions: %s - %s", resp.Status, string(body))
+	}
+
+	var page json.RawMessage
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return page, nil
 }
 
 // Deposit отправляет запрос на пополнение баланса пользователя в payment-service
-func (svc *APIGatewayService) Deposit(userId string, amount float64) error {
+func (svc *APIGatewayService) Deposit(ctx context.Context, userId string, amount money.Amount) error {
 	depositData := struct {
-		Amount float64 `json:"amount"`
+		Amount   money.Amount `json:"amount"`
+		Currency string       `json:"currency"`
 	}{
-		Amount: amount,
+		Amount:   amount,
+		Currency: money.Currency,
 	}
 
 	data, err := json.Marshal(depositData)
@@ -162,18 +381,7 @@ func (svc *APIGatewayService) Deposit(userId string, amount float64) error {
 		return fmt.Errorf("failed to marshal deposit data: %v", err)
 	}
 
-	req, err := http.NewRequest(
-		"PUT",
-		"http://payment-service:8082/payment/"+userId+"/deposit",
-		bytes.NewReader(data),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := svc.send(ctx, http.MethodPut, svc.paymentServiceURL+"/payment/"+userId+"/deposit", data)
 	if err != nil {
 		return fmt.Errorf("failed to send request to payment service: %v", err)
 	}
@@ -181,8 +389,97 @@ func (svc *APIGatewayService) Deposit(userId string, amount float64) error {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(resp.Body)
+		if err := rejection(resp, body); err != nil {
+			return err
+		}
 		return fmt.Errorf("failed to deposit: %s - %s", resp.Status, string(body))
 	}
 
 	return nil
 }
+
+// Withdraw отправляет запрос на вывод средств в payment-service и возвращает новый баланс
+func (svc *APIGatewayService) Withdraw(ctx context.Context, userId string, amount money.Amount) (money.Amount, error) {
+	withdrawData := struct {
+		Amount   money.Amount `json:"amount"`
+		Currency string       `json:"currency"`
+	}{
+		Amount:   amount,
+		Currency: money.Currency,
+	}
+
+	data, err := json.Marshal(withdrawData)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal withdraw data: %v", err)
+	}
+
+	resp, err := svc.send(ctx, http.MethodPut, svc.paymentServiceURL+"/payment/"+userId+"/withdraw", data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request to payment service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return 0, ErrInsufficientFunds
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if err := rejection(resp, body); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("failed to withdraw: %s - %s", resp.Status, string(body))
+	}
+
+	var result struct {
+		Balance money.Amount `json:"balance"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %v", err)
+	}
+	return result.Balance, nil
+}
+
+// Transfer отправляет запрос на перевод средств другому пользователю в payment-service.
+// Ответ возвращается как есть, чтобы суммы не проходили через float64.
+func (svc *APIGatewayService) Transfer(ctx context.Context, userId string, recipientId string, amount money.Amount, idempotencyKey string) (json.RawMessage, error) {
+	transferData := struct {
+		RecipientID    string       `json:"recipient_id"`
+		Amount         money.Amount `json:"amount"`
+		Currency       string       `json:"currency"`
+		IdempotencyKey string       `json:"idempotency_key"`
+	}{
+		RecipientID:    recipientId,
+		Amount:         amount,
+		Currency:       money.Currency,
+		IdempotencyKey: idempotencyKey,
+	}
+
+	data, err := json.Marshal(transferData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal transfer data: %v", err)
+	}
+
+	resp, err := svc.send(ctx, http.MethodPost, svc.paymentServiceURL+"/payment/"+userId+"/transfer", data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to payment service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return json.RawMessage(body), nil
+	case http.StatusConflict:
+		return nil, ErrInsufficientFunds
+	case http.StatusUnprocessableEntity:
+		return nil, ErrIdempotencyKeyReused
+	}
+	if err := rejection(resp, body); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("failed to transfer: %s - %s", resp.Status, string(body))
+}
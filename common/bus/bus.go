@@ -0,0 +1,37 @@
+// Package bus шина сообщений между сервисами: публикация в топики и чтение
+// топиков группой подписчиков. Реализации: Kafka для работы сервисов и MemoryBus
+// в памяти процесса для тестов без брокера.
+//
+// Доставка не реже одного раза: сообщение подтверждается только после того, как
+// обработчик вернул nil, а при ошибке доставляется повторно. Поэтому обработчики
+// должны быть идемпотентными.
+package bus
+
+import "context"
+
+// Message сообщение в топике
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string // Метаданные сообщения, например причина отправки в dead-letter топик
+}
+
+// Handler обрабатывает сообщение. Ошибка означает, что сообщение не подтверждено
+// и будет доставлено повторно.
+type Handler func(ctx context.Context, msg Message) error
+
+// Publisher публикует сообщения в топики
+type Publisher interface {
+	// Publish публикует сообщения и возвращается после их приема шиной
+	Publish(ctx context.Context, msgs ...Message) error
+	Close() error
+}
+
+// Subscriber читает топики от имени группы подписчиков сервиса
+type Subscriber interface {
+	// Subscribe передает сообщения топика в handle по порядку, пока не отменен ctx.
+	// Группа продолжает с последнего подтвержденного сообщения. Остановка по ctx
+	// не считается ошибкой и возвращает nil.
+	Subscribe(ctx context.Context, topic string, handle Handler) error
+}
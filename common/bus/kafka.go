@@ -0,0 +1,244 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"log"
+	"time"
+)
+
+// kafkaRetryDelay пауза перед повторным чтением после ошибки брокера
+// и перед повторной доставкой сообщения, которое не удалось обработать
+const kafkaRetryDelay = time.Second
+
+// shutdownGrace сколько начатая обработка сообщения может продолжаться после остановки подписчика
+const shutdownGrace = 10 * time.Second
+
+// ProducerConfig настройки публикации в Kafka
+type ProducerConfig struct {
+	// Acks сколько реплик должны подтвердить запись: all, one или none
+	Acks string
+	// BatchSize и BatchTimeout ограничивают пачку сообщений, отправляемую брокеру за раз
+	BatchSize    int
+	BatchTimeout time.Duration
+	// Compression сжатие пачек: none, gzip, snappy, lz4 или zstd
+	Compression string
+	// MaxAttempts сколько раз пачка отправляется при ошибках брокера
+	MaxAttempts int
+}
+
+// KafkaPublisher публикует сообщения через один долгоживущий kafka.Writer.
+// Writer общий для всего сервиса: конкурентные Publish собираются в общие пачки
+// и используют одни соединения с брокерами.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher создает publisher для брокеров brokers. Топик задается в каждом сообщении.
+// Партиция выбирается по хешу ключа, поэтому сообщения с одним ключом читаются по порядку.
+//
+// kafka-go не поддерживает идемпотентного продюсера Kafka, поэтому повтор пачки после
+// потерянного подтверждения может записать сообщения дважды. Повторы все равно безопасны:
+// ID события выводится из его содержимого (см. events.New), а обработчики идемпотентны.
+func NewKafkaPublisher(brokers []string, cfg ProducerConfig) (*KafkaPublisher, error) {
+	acks, ok := map[string]kafka.RequiredAcks{
+		"all":  kafka.RequireAll,
+		"one":  kafka.RequireOne,
+		"none": kafka.RequireNone,
+	}[cfg.Acks]
+	if !ok {
+		return nil, fmt.Errorf("unknown acks %q", cfg.Acks)
+	}
+	compression, ok := map[string]kafka.Compression{
+		"none":   0,
+		"gzip":   kafka.Gzip,
+		"snappy": kafka.Snappy,
+		"lz4":    kafka.Lz4,
+		"zstd":   kafka.Zstd,
+	}[cfg.Compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression %q", cfg.Compression)
+	}
+
+	return &KafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: acks,
+		BatchSize:    cfg.BatchSize,
+		BatchTimeout: cfg.BatchTimeout,
+		Compression:  compression,
+		MaxAttempts:  cfg.MaxAttempts,
+		// Топики, в том числе dead-letter, создаются брокером при первой публикации
+		AllowAutoTopicCreation: true,
+	}}, nil
+}
+
+// Publish отправляет сообщения в Kafka и ждет их подтверждения по настройке Acks
+func (p *KafkaPublisher) Publish(ctx context.Context, msgs ...Message) error {
+	kafkaMsgs := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		kafkaMsg := kafka.Message{Topic: msg.Topic, Key: msg.Key, Value: msg.Value}
+		for key, value := range msg.Headers {
+			kafkaMsg.Headers = append(kafkaMsg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+		kafkaMsgs = append(kafkaMsgs, kafkaMsg)
+	}
+
+	start := time.Now()
+	err := p.writer.WriteMessages(ctx, kafkaMsgs...)
+	observePublish(msgs, time.Since(start), err)
+	if err != nil {
+		return fmt.Errorf("could not write to Kafka: %v", err)
+	}
+	return nil
+}
+
+// Close отправляет оставшиеся сообщения и закрывает соединения с брокерами
+func (p *KafkaPublisher) Close() error {
+	if err := p.writer.Close(); err != nil {
+		return fmt.Errorf("could not flush Kafka writer: %v", err)
+	}
+	return nil
+}
+
+// KafkaSubscriber читает топики Kafka в группе подписчиков
+type KafkaSubscriber struct {
+	brokers []string
+	group   string
+	workers int
+}
+
+// NewKafkaSubscriber создает subscriber для группы group, который обрабатывает
+// партиции топика параллельно, не больше чем в workers горутинах
+func NewKafkaSubscriber(brokers []string, group string, workers int) *KafkaSubscriber {
+	return &KafkaSubscriber{brokers: brokers, group: group, workers: workers}
+}
+
+// Subscribe читает топик и фиксирует смещение сообщения только после его обработки.
+// Сообщения одной партиции обрабатываются по порядку, разных партиций — параллельно.
+// Сообщение, обработка которого завершилась ошибкой, передается в handle повторно
+// и задерживает свою партицию, поэтому ограничивать число попыток должен сам handle, см. WithRetry.
+// После отмены ctx Subscribe дожидается начатых сообщений и фиксирует их смещения.
+func (s *KafkaSubscriber) Subscribe(ctx context.Context, topic string, handle Handler) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: s.brokers,
+		Topic:   topic,
+		GroupID: s.group,
+	})
+	defer reader.Close()
+
+	pool := newPartitionPool(s.workers)
+	defer pool.close()
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Failed to read message from %s: %v. Retrying...", topic, err)
+			if !sleep(ctx, kafkaRetryDelay) {
+				return nil
+			}
+			continue
+		}
+
+		observeLag(msg)
+		if !pool.dispatch(ctx, msg.Partition, func() { s.process(ctx, reader, msg, handle) }) {
+			return nil
+		}
+	}
+}
+
+// process передает сообщение в handle до успешной обработки и фиксирует его смещение.
+// Начатая обработка переживает остановку подписчика на shutdownGrace, чтобы сообщение
+// успело зафиксироваться и не обрабатывалось после перезапуска еще раз.
+func (s *KafkaSubscriber) process(ctx context.Context, reader *kafka.Reader, msg kafka.Message, handle Handler) {
+	// Сообщения, прочитанные до остановки, но не начатые, группа получит снова
+	if ctx.Err() != nil {
+		return
+	}
+	work, cancel := withGrace(ctx, shutdownGrace)
+	defer cancel()
+
+	message := Message{Topic: msg.Topic, Key: msg.Key, Value: msg.Value}
+	if len(msg.Headers) > 0 {
+		message.Headers = make(map[string]string, len(msg.Headers))
+		for _, header := range msg.Headers {
+			message.Headers[header.Key] = string(header.Value)
+		}
+	}
+	started := time.Now()
+	if !handleUntilDone(ctx, work, msg, message, handle) {
+		return
+	}
+
+	consumeDuration.WithLabelValues(msg.Topic).Observe(time.Since(started).Seconds())
+	consumedMessages.WithLabelValues(msg.Topic).Inc()
+
+	// Если коммит не прошел, после перебалансировки сообщение придет еще раз
+	if err := reader.CommitMessages(work, msg); err != nil && work.Err() == nil {
+		log.Printf("Failed to commit message from %s partition %d at offset %d: %v", msg.Topic, msg.Partition, msg.Offset, err)
+	}
+}
+
+// handleUntilDone передает сообщение в handle, пока обработка не завершится успешно, и
+// возвращает false, если подписчик остановили раньше. Неудачные попытки считает WithRetry:
+// ошибка доходит сюда уже после всех его повторов, поэтому здесь она только логируется.
+func handleUntilDone(ctx context.Context, work context.Context, msg kafka.Message, message Message, handle Handler) bool {
+	for {
+		err := handle(work, message)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		log.Printf("Error handling message from %s partition %d at offset %d, redelivering: %v", msg.Topic, msg.Partition, msg.Offset, err)
+		if !sleep(ctx, kafkaRetryDelay) {
+			return false
+		}
+	}
+}
+
+// CheckBrokers проверяет, что хотя бы один из брокеров принимает соединения
+func CheckBrokers(ctx context.Context, brokers []string) error {
+	var errs []error
+	for _, broker := range brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		conn.Close()
+		return nil
+	}
+	return fmt.Errorf("no Kafka broker is reachable: %v", errors.Join(errs...))
+}
+
+// withGrace возвращает контекст, который отменяется через grace после отмены ctx
+func withGrace(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	work, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(grace, cancel)
+	})
+	return work, func() {
+		stop()
+		cancel()
+	}
+}
+
+// sleep ждет d и возвращает false, если ctx отменили раньше
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,34 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithGraceOutlivesParent(t *testing.T) {
+	parent, stop := context.WithCancel(context.Background())
+	work, cancel := withGrace(parent, 50*time.Millisecond)
+	defer cancel()
+
+	stop()
+	select {
+	case <-work.Done():
+		t.Fatal("work context was cancelled together with its parent")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	select {
+	case <-work.Done():
+	case <-time.After(time.Second):
+		t.Fatal("work context outlived the grace period")
+	}
+}
+
+func TestWithGraceReleasedByCancel(t *testing.T) {
+	work, cancel := withGrace(context.Background(), time.Hour)
+	cancel()
+	if work.Err() == nil {
+		t.Fatal("cancel did not cancel the work context")
+	}
+}
@@ -0,0 +1,244 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed возвращается при публикации в закрытую шину
+var ErrClosed = errors.New("bus is closed")
+
+// MemoryBus шина сообщений в памяти процесса. Каждый топик — один упорядоченный
+// журнал, каждая группа подписчиков читает его со своего смещения, начиная с первого
+// сообщения. Как и Kafka, шина доставляет сообщения не реже одного раза: сообщение,
+// обработка которого завершилась ошибкой, доставляется повторно, а с Redeliveries > 0
+// даже успешно обработанное сообщение приходит еще раз, как после падения подписчика
+// до фиксации смещения.
+type MemoryBus struct {
+	// Redeliveries сколько раз успешно обработанное сообщение доставляется повторно.
+	// Как и RetryDelay, задается до первой подписки.
+	Redeliveries int
+	// RetryDelay пауза перед повторной доставкой сообщения после ошибки обработки
+	RetryDelay time.Duration
+
+	mu      sync.Mutex
+	changed chan struct{} // закрывается и заменяется при каждом изменении состояния
+	closed  bool
+	topics  map[string][]Message
+	groups  map[memoryGroupKey]*memoryGroup
+}
+
+// memoryGroupKey группа подписчиков на топике
+type memoryGroupKey struct {
+	topic string
+	group string
+}
+
+// memoryGroup смещение группы в топике
+type memoryGroup struct {
+	offset   int  // следующее неподтвержденное сообщение
+	inFlight bool // сообщение по смещению offset сейчас обрабатывается
+}
+
+// NewMemoryBus создает пустую шину в памяти
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		RetryDelay: 10 * time.Millisecond,
+		changed:    make(chan struct{}),
+		topics:     make(map[string][]Message),
+		groups:     make(map[memoryGroupKey]*memoryGroup),
+	}
+}
+
+// Publish добавляет сообщения в конец их топиков
+func (b *MemoryBus) Publish(ctx context.Context, msgs ...Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	for _, msg := range msgs {
+		msg.Key = append([]byte(nil), msg.Key...)
+		msg.Value = append([]byte(nil), msg.Value...)
+		msg.Headers = copyHeaders(msg.Headers)
+		b.topics[msg.Topic] = append(b.topics[msg.Topic], msg)
+	}
+	b.notify()
+	return nil
+}
+
+// Close останавливает всех подписчиков и запрещает дальнейшую публикацию
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.notify()
+	return nil
+}
+
+// Subscriber возвращает подписчика от имени группы group
+func (b *MemoryBus) Subscriber(group string) Subscriber {
+	return memorySubscriber{bus: b, group: group}
+}
+
+// Messages возвращает все сообщения, опубликованные в топик
+func (b *MemoryBus) Messages(topic string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]Message(nil), b.topics[topic]...)
+}
+
+// WaitIdle ждет, пока все группы подписчиков подтвердят все сообщения своих топиков.
+// Сообщения в топике, на который еще никто не подписался, тоже ждут обработки,
+// поэтому WaitIdle можно вызывать сразу после запуска подписчиков. Так тест дожидается
+// окончания цепочки событий, которую он запустил.
+func (b *MemoryBus) WaitIdle(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		idle := b.idle()
+		changed := b.changed
+		b.mu.Unlock()
+		if idle {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// isClosed сообщает, закрыта ли шина
+func (b *MemoryBus) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.closed
+}
+
+// idle проверяет, что ни у одной группы нет неподтвержденных сообщений, вызывается под блокировкой
+func (b *MemoryBus) idle() bool {
+	subscribed := make(map[string]bool)
+	for key, group := range b.groups {
+		if group.inFlight || group.offset < len(b.topics[key.topic]) {
+			return false
+		}
+		subscribed[key.topic] = true
+	}
+	for topic, msgs := range b.topics {
+		if len(msgs) > 0 && !subscribed[topic] {
+			return false
+		}
+	}
+	return true
+}
+
+// notify будит всех ожидающих, вызывается под блокировкой
+func (b *MemoryBus) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// memorySubscriber подписчик MemoryBus от имени группы
+type memorySubscriber struct {
+	bus   *MemoryBus
+	group string
+}
+
+// Subscribe передает сообщения топика в handle. Подписчики одной группы
+// обрабатывают топик по очереди, по одному сообщению.
+func (s memorySubscriber) Subscribe(ctx context.Context, topic string, handle Handler) error {
+	b := s.bus
+	key := memoryGroupKey{topic: topic, group: s.group}
+
+	b.mu.Lock()
+	if _, ok := b.groups[key]; !ok {
+		b.groups[key] = &memoryGroup{}
+		b.notify()
+	}
+	b.mu.Unlock()
+
+	for {
+		msg, ok := s.claim(ctx, key)
+		if !ok {
+			return nil
+		}
+
+		deliveries := 0
+		for deliveries <= b.Redeliveries {
+			if err := handle(ctx, msg); err != nil {
+				if ctx.Err() != nil || b.isClosed() || !sleep(ctx, b.RetryDelay) {
+					s.release(key, false)
+					return nil
+				}
+				continue
+			}
+			deliveries++
+		}
+		s.release(key, true)
+	}
+}
+
+// claim ждет следующее сообщение группы и отмечает его как обрабатываемое
+func (s memorySubscriber) claim(ctx context.Context, key memoryGroupKey) (Message, bool) {
+	b := s.bus
+	for {
+		b.mu.Lock()
+		group := b.groups[key]
+		if b.closed {
+			b.mu.Unlock()
+			return Message{}, false
+		}
+		if !group.inFlight && group.offset < len(b.topics[key.topic]) {
+			group.inFlight = true
+			msg := b.topics[key.topic][group.offset]
+			b.mu.Unlock()
+			return msg, true
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Message{}, false
+		case <-changed:
+		}
+	}
+}
+
+// release снимает отметку обработки и, если сообщение обработано, подтверждает его
+func (s memorySubscriber) release(key memoryGroupKey, commit bool) {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group := b.groups[key]
+	group.inFlight = false
+	if commit {
+		group.offset++
+	}
+	b.notify()
+}
+
+// copyHeaders копирует метаданные сообщения
+func copyHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(headers))
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,116 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryBusRedeliversFailedMessages(t *testing.T) {
+	b := NewMemoryBus()
+	b.RetryDelay = time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var handled []string
+	attempts := 0
+	go b.Subscriber("group").Subscribe(ctx, "topic", func(ctx context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if string(msg.Value) == "first" {
+			attempts++
+			if attempts < 3 {
+				return errors.New("transient failure")
+			}
+		}
+		handled = append(handled, string(msg.Value))
+		return nil
+	})
+
+	publish(t, b, "topic", "first", "second")
+	if err := b.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 3 || len(handled) != 2 || handled[0] != "first" || handled[1] != "second" {
+		t.Fatalf("attempts = %d, handled = %v; want the first message retried until it succeeds, in order", attempts, handled)
+	}
+}
+
+func TestMemoryBusRedeliversHandledMessages(t *testing.T) {
+	b := NewMemoryBus()
+	b.Redeliveries = 2
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	publish(t, b, "topic", "event")
+
+	// Группа, подписавшаяся позже, читает топик с первого сообщения
+	var mu sync.Mutex
+	counts := map[string]int{}
+	for _, group := range []string{"a", "b"} {
+		group := group
+		started := make(chan struct{})
+		var once sync.Once
+		go b.Subscriber(group).Subscribe(ctx, "topic", func(ctx context.Context, msg Message) error {
+			once.Do(func() { close(started) })
+			mu.Lock()
+			defer mu.Unlock()
+			counts[group+":"+string(msg.Value)]++
+			return nil
+		})
+		select {
+		case <-started:
+		case <-ctx.Done():
+			t.Fatalf("group %s received nothing", group)
+		}
+		if err := b.WaitIdle(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if counts["a:event"] != 3 || counts["b:event"] != 3 {
+		t.Fatalf("deliveries = %v, want 3 per group", counts)
+	}
+}
+
+func TestMemoryBusSubscribeStops(t *testing.T) {
+	b := NewMemoryBus()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() {
+		done <- b.Subscriber("group").Subscribe(ctx, "topic", func(context.Context, Message) error { return nil })
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Subscribe returned %v after cancellation, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Subscribe did not stop after cancellation")
+	}
+
+	b.Close()
+	if err := b.Publish(context.Background(), Message{Topic: "topic"}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Publish after Close: %v, want ErrClosed", err)
+	}
+}
+
+func publish(t *testing.T, b *MemoryBus, topic string, values ...string) {
+	t.Helper()
+	for _, value := range values {
+		if err := b.Publish(context.Background(), Message{Topic: topic, Value: []byte(value)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
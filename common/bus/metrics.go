@@ -0,0 +1,73 @@
+package bus
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/segmentio/kafka-go"
+	"strconv"
+	"time"
+)
+
+// Метрики публикации и чтения Kafka, доступны на /metrics сервиса
+var (
+	publishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_publish_duration_seconds",
+		Help:    "Time from Publish call to broker acknowledgement, per message.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"topic"})
+	publishedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_published_messages_total",
+		Help: "Messages acknowledged by Kafka.",
+	}, []string{"topic"})
+	publishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_publish_errors_total",
+		Help: "Messages Kafka did not acknowledge.",
+	}, []string{"topic"})
+
+	consumeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_consume_duration_seconds",
+		Help:    "Time to handle a consumed message, including retries, until its offset is committed.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"topic"})
+	consumedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumed_messages_total",
+		Help: "Messages handled successfully or moved to the dead-letter topic.",
+	}, []string{"topic"})
+	consumeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consume_errors_total",
+		Help: "Failed attempts to handle a consumed message, counted by the retry policy.",
+	}, []string{"topic"})
+	deadLetteredMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_dead_lettered_messages_total",
+		Help: "Messages moved to the dead-letter topic after the last retry, by original topic.",
+	}, []string{"topic"})
+	consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_consumer_lag",
+		Help: "Messages in the partition after the last fetched one.",
+	}, []string{"topic", "partition"})
+)
+
+// observePublish записывает время и результат публикации каждого сообщения.
+// kafka.WriteErrors сообщает результат отдельно для каждого сообщения пачки.
+func observePublish(msgs []Message, elapsed time.Duration, err error) {
+	var writeErrors kafka.WriteErrors
+	perMessage := errors.As(err, &writeErrors) && len(writeErrors) == len(msgs)
+	for i, msg := range msgs {
+		failed := err != nil
+		if perMessage {
+			failed = writeErrors[i] != nil
+		}
+		publishDuration.WithLabelValues(msg.Topic).Observe(elapsed.Seconds())
+		if failed {
+			publishErrors.WithLabelValues(msg.Topic).Inc()
+		} else {
+			publishedMessages.WithLabelValues(msg.Topic).Inc()
+		}
+	}
+}
+
+// observeLag записывает отставание подписчика по партиции прочитанного сообщения
+func observeLag(msg kafka.Message) {
+	consumerLag.WithLabelValues(msg.Topic, strconv.Itoa(msg.Partition)).Set(float64(max(msg.HighWaterMark-msg.Offset-1, 0)))
+}
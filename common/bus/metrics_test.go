@@ -0,0 +1,81 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"testing"
+	"time"
+)
+
+func TestObservePublishCountsEachMessage(t *testing.T) {
+	msgs := []Message{{Topic: "metrics.a"}, {Topic: "metrics.b"}}
+
+	observePublish(msgs, time.Millisecond, nil)
+	// Пачка записана частично: брокер отклонил только второе сообщение
+	observePublish(msgs, time.Millisecond, kafka.WriteErrors{nil, errors.New("not leader")})
+	// Ошибка без подробностей по сообщениям относится ко всей пачке
+	observePublish(msgs[:1], time.Millisecond, errors.New("connection refused"))
+
+	for _, tt := range []struct {
+		topic             string
+		published, failed float64
+	}{
+		{"metrics.a", 2, 1},
+		{"metrics.b", 1, 1},
+	} {
+		if got := testutil.ToFloat64(publishedMessages.WithLabelValues(tt.topic)); got != tt.published {
+			t.Errorf("%s published = %v, want %v", tt.topic, got, tt.published)
+		}
+		if got := testutil.ToFloat64(publishErrors.WithLabelValues(tt.topic)); got != tt.failed {
+			t.Errorf("%s errors = %v, want %v", tt.topic, got, tt.failed)
+		}
+	}
+	if got := testutil.CollectAndCount(publishDuration, "kafka_publish_duration_seconds"); got < 2 {
+		t.Errorf("publish duration has %d series, want one per topic", got)
+	}
+}
+
+func TestConsumeMetrics(t *testing.T) {
+	// Каждая неудачная попытка считается ошибкой, сообщение после последней уходит в dead-letter топик
+	subscriber := WithRetry(singleMessageSubscriber{}, testPolicy, NewMemoryBus())
+	err := subscriber.Subscribe(context.Background(), "metrics.retry", func(context.Context, Message) error {
+		return errors.New("cannot process poison")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(consumeErrors.WithLabelValues("metrics.retry")); got != 3 {
+		t.Errorf("consume errors = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(deadLetteredMessages.WithLabelValues("metrics.retry")); got != 1 {
+		t.Errorf("dead-lettered messages = %v, want 1", got)
+	}
+
+	// Сообщение, которое не удалось отправить в dead-letter топик, подписчик Kafka доставляет
+	// повторно, но его неудачные попытки уже посчитаны и второй раз не учитываются
+	attempts := 0
+	retrying := retryingSubscriber{policy: testPolicy, deadLetters: failingPublisher{}}
+	handle := func(ctx context.Context, msg Message) error {
+		return retrying.handle(ctx, msg, func(context.Context, Message) error {
+			attempts++
+			if attempts <= testPolicy.MaxAttempts {
+				return errors.New("cannot process poison")
+			}
+			return nil
+		})
+	}
+	ctx := context.Background()
+	if !handleUntilDone(ctx, ctx, kafka.Message{Topic: "metrics.redelivered"}, Message{Topic: "metrics.redelivered"}, handle) {
+		t.Fatal("redelivered message was not handled")
+	}
+	if got := testutil.ToFloat64(consumeErrors.WithLabelValues("metrics.redelivered")); got != 3 {
+		t.Errorf("consume errors after redelivery = %v, want 3", got)
+	}
+
+	observeLag(kafka.Message{Topic: "metrics.lag", Partition: 2, Offset: 10, HighWaterMark: 15})
+	if got := testutil.ToFloat64(consumerLag.WithLabelValues("metrics.lag", "2")); got != 4 {
+		t.Errorf("lag = %v, want 4", got)
+	}
+}
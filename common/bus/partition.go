@@ -0,0 +1,58 @@
+package bus
+
+import (
+	"context"
+	"sync"
+)
+
+// partitionQueueSize сколько прочитанных сообщений может ждать обработки у одного обработчика.
+// Когда очередь заполнена, чтение топика приостанавливается.
+const partitionQueueSize = 16
+
+// partitionPool обрабатывает сообщения разных партиций параллельно, не больше чем
+// в size горутинах. Все сообщения одной партиции попадают к одному обработчику,
+// поэтому внутри партиции порядок обработки совпадает с порядком в топике.
+type partitionPool struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+}
+
+// newPartitionPool запускает size обработчиков
+func newPartitionPool(size int) *partitionPool {
+	if size < 1 {
+		size = 1
+	}
+	pool := &partitionPool{queues: make([]chan func(), size)}
+	for i := range pool.queues {
+		queue := make(chan func(), partitionQueueSize)
+		pool.queues[i] = queue
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for job := range queue {
+				job()
+			}
+		}()
+	}
+	return pool
+}
+
+// dispatch ставит job в очередь обработчика партиции partition и возвращает false,
+// если ctx отменили раньше, чем в очереди освободилось место
+func (pool *partitionPool) dispatch(ctx context.Context, partition int, job func()) bool {
+	queue := pool.queues[partition%len(pool.queues)]
+	select {
+	case queue <- job:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// close дожидается выполнения всех поставленных в очередь задач и останавливает обработчиков
+func (pool *partitionPool) close() {
+	for _, queue := range pool.queues {
+		close(queue)
+	}
+	pool.wg.Wait()
+}
@@ -0,0 +1,83 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPartitionPoolKeepsPartitionOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const workers, partitions, perPartition = 3, 7, 50
+	pool := newPartitionPool(workers)
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	processed := make(map[int][]int)
+	for i := 0; i < perPartition; i++ {
+		for partition := 0; partition < partitions; partition++ {
+			partition, i := partition, i
+			ok := pool.dispatch(ctx, partition, func() {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				mu.Unlock()
+
+				time.Sleep(10 * time.Microsecond)
+
+				mu.Lock()
+				running--
+				processed[partition] = append(processed[partition], i)
+				mu.Unlock()
+			})
+			if !ok {
+				t.Fatal("dispatch timed out")
+			}
+		}
+	}
+	pool.close()
+
+	if maxRunning > workers {
+		t.Fatalf("%d jobs ran concurrently, want at most %d", maxRunning, workers)
+	}
+	for partition := 0; partition < partitions; partition++ {
+		got := processed[partition]
+		if len(got) != perPartition {
+			t.Fatalf("partition %d: processed %d messages, want %d", partition, len(got), perPartition)
+		}
+		for i, n := range got {
+			if n != i {
+				t.Fatalf("partition %d processed out of order: %v", partition, got)
+			}
+		}
+	}
+}
+
+func TestPartitionPoolProcessesPartitionsConcurrently(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool := newPartitionPool(2)
+	defer pool.close()
+
+	// Сообщение партиции 0 ждет, пока обработается сообщение партиции 1
+	unblocked := make(chan struct{})
+	done := make(chan struct{})
+	pool.dispatch(ctx, 0, func() {
+		select {
+		case <-unblocked:
+		case <-ctx.Done():
+		}
+		close(done)
+	})
+	pool.dispatch(ctx, 1, func() { close(unblocked) })
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("partition 1 was blocked by partition 0")
+	}
+}
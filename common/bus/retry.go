@@ -0,0 +1,95 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Метаданные сообщения, отправленного в dead-letter топик
+const (
+	HeaderOriginalTopic = "dead-letter-original-topic" // топик, из которого прочитано сообщение
+	HeaderError         = "dead-letter-error"          // ошибка последней попытки обработки
+	HeaderAttempts      = "dead-letter-attempts"       // число попыток обработки
+	HeaderFailedAt      = "dead-letter-failed-at"      // время последней попытки в RFC 3339
+)
+
+// RetryPolicy политика повторной обработки сообщений
+type RetryPolicy struct {
+	MaxAttempts     int           // попыток обработки до отправки в dead-letter топик
+	InitialBackoff  time.Duration // пауза после первой неудачной попытки
+	MaxBackoff      time.Duration // пауза удваивается после каждой попытки, но не больше MaxBackoff
+	DeadLetterTopic string
+}
+
+// WithRetry оборачивает subscriber: сообщение, обработка которого завершилась ошибкой,
+// обрабатывается повторно с экспоненциальной задержкой, а после MaxAttempts попыток
+// публикуется в dead-letter топик через deadLetters с метаданными об ошибке.
+// Сообщение подтверждается только после успешной обработки или публикации в
+// dead-letter топик; если опубликовать не удалось, оно будет доставлено повторно.
+func WithRetry(subscriber Subscriber, policy RetryPolicy, deadLetters Publisher) Subscriber {
+	return retryingSubscriber{subscriber: subscriber, policy: policy, deadLetters: deadLetters}
+}
+
+// retryingSubscriber подписчик с политикой повторов
+type retryingSubscriber struct {
+	subscriber  Subscriber
+	policy      RetryPolicy
+	deadLetters Publisher
+}
+
+// Subscribe передает сообщения топика в handle с повторами по политике
+func (s retryingSubscriber) Subscribe(ctx context.Context, topic string, handle Handler) error {
+	return s.subscriber.Subscribe(ctx, topic, func(ctx context.Context, msg Message) error {
+		return s.handle(ctx, msg, handle)
+	})
+}
+
+// handle обрабатывает сообщение с повторами и при исчерпании попыток отправляет его в dead-letter топик
+func (s retryingSubscriber) handle(ctx context.Context, msg Message, handle Handler) error {
+	backoff := s.policy.InitialBackoff
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		err = handle(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		consumeErrors.WithLabelValues(msg.Topic).Inc()
+		if attempt >= s.policy.MaxAttempts {
+			break
+		}
+
+		log.Printf("Error handling message from %s (attempt %d of %d), retrying in %s: %v", msg.Topic, attempt, s.policy.MaxAttempts, backoff, err)
+		if !sleep(ctx, backoff) {
+			return err
+		}
+		backoff *= 2
+		if backoff > s.policy.MaxBackoff {
+			backoff = s.policy.MaxBackoff
+		}
+	}
+
+	headers := copyHeaders(msg.Headers)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers[HeaderOriginalTopic] = msg.Topic
+	headers[HeaderError] = err.Error()
+	headers[HeaderAttempts] = strconv.Itoa(attempt)
+	headers[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	deadLetter := Message{Topic: s.policy.DeadLetterTopic, Key: msg.Key, Value: msg.Value, Headers: headers}
+	if publishErr := s.deadLetters.Publish(ctx, deadLetter); publishErr != nil {
+		return fmt.Errorf("could not publish message from %s to %s after %d attempts: %v (last error: %v)",
+			msg.Topic, s.policy.DeadLetterTopic, attempt, publishErr, err)
+	}
+	deadLetteredMessages.WithLabelValues(msg.Topic).Inc()
+	log.Printf("Message from %s moved to %s after %d attempts: %v", msg.Topic, s.policy.DeadLetterTopic, attempt, err)
+	return nil
+}
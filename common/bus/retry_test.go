@@ -0,0 +1,95 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	InitialBackoff:  time.Millisecond,
+	MaxBackoff:      2 * time.Millisecond,
+	DeadLetterTopic: "topic.dlq",
+}
+
+func TestWithRetryMovesPoisonMessagesToDeadLetterTopic(t *testing.T) {
+	b := NewMemoryBus()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	subscriber := WithRetry(b.Subscriber("group"), testPolicy, b)
+	go subscriber.Subscribe(ctx, "topic", func(ctx context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		value := string(msg.Value)
+		attempts[value]++
+		switch {
+		case value == "poison":
+			return errors.New("cannot process poison")
+		case value == "transient" && attempts[value] < 2:
+			return errors.New("database is busy")
+		}
+		return nil
+	})
+
+	// WaitIdle ждет, пока прочитаны все топики, поэтому dead-letter топик тоже читается
+	go b.Subscriber("dead-letters").Subscribe(ctx, testPolicy.DeadLetterTopic, func(context.Context, Message) error { return nil })
+
+	if err := b.Publish(ctx, Message{Topic: "topic", Key: []byte("user"), Value: []byte("poison"), Headers: map[string]string{"trace": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, b, "topic", "transient", "ok")
+	if err := b.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts["poison"] != 3 || attempts["transient"] != 2 || attempts["ok"] != 1 {
+		t.Fatalf("attempts = %v, want poison 3, transient 2, ok 1", attempts)
+	}
+
+	deadLetters := b.Messages("topic.dlq")
+	if len(deadLetters) != 1 {
+		t.Fatalf("dead letters = %+v, want the poison message only", deadLetters)
+	}
+	dead := deadLetters[0]
+	if string(dead.Value) != "poison" || string(dead.Key) != "user" || dead.Headers["trace"] != "1" {
+		t.Fatalf("dead letter = %+v, want the original message", dead)
+	}
+	if dead.Headers[HeaderOriginalTopic] != "topic" || dead.Headers[HeaderAttempts] != "3" ||
+		dead.Headers[HeaderError] != "cannot process poison" || dead.Headers[HeaderFailedAt] == "" {
+		t.Fatalf("dead letter headers = %v", dead.Headers)
+	}
+}
+
+// failingPublisher публикатор, который всегда возвращает ошибку
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(context.Context, ...Message) error {
+	return errors.New("broker is down")
+}
+func (failingPublisher) Close() error { return nil }
+
+// singleMessageSubscriber передает в handle одно сообщение и возвращает результат обработки
+type singleMessageSubscriber struct{}
+
+func (singleMessageSubscriber) Subscribe(ctx context.Context, topic string, handle Handler) error {
+	return handle(ctx, Message{Topic: topic, Value: []byte("poison")})
+}
+
+func TestWithRetryKeepsMessageWhenDeadLetterPublishFails(t *testing.T) {
+	subscriber := WithRetry(singleMessageSubscriber{}, testPolicy, failingPublisher{})
+	err := subscriber.Subscribe(context.Background(), "topic", func(context.Context, Message) error {
+		return errors.New("cannot process poison")
+	})
+	// Ошибка оставляет сообщение неподтвержденным, и подписчик доставит его повторно
+	if err == nil {
+		t.Fatal("handler succeeded although the message reached neither the handler nor the dead-letter topic")
+	}
+}
@@ -0,0 +1,158 @@
+// Package configutil загружает настройки сервисов из необязательного JSON-файла
+// и переменных окружения. Переменные окружения имеют приоритет над файлом,
+// файл — над значениями по умолчанию.
+package configutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileEnv переменная окружения с путем к JSON-файлу конфигурации
+const FileEnv = "CONFIG_FILE"
+
+// LoadFile заполняет dst из JSON-файла, указанного в CONFIG_FILE.
+// Без CONFIG_FILE ничего не делает. Неизвестные ключи считаются ошибкой,
+// чтобы опечатка в файле не превращалась в молча проигнорированную настройку.
+func LoadFile(dst interface{}) error {
+	path := os.Getenv(FileEnv)
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file %s: %v", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return fmt.Errorf("could not parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Env читает переменные окружения поверх уже загруженных значений
+// и накапливает ошибки разбора, чтобы сообщить обо всех сразу
+type Env struct {
+	errs []error
+}
+
+// String подставляет значение переменной name, если она задана
+func (env *Env) String(dst *string, name string) {
+	if value, ok := os.LookupEnv(name); ok {
+		*dst = value
+	}
+}
+
+// Int подставляет целое значение переменной name, если она задана
+func (env *Env) Int(dst *int, name string) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return
+	}
+	parsed, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		env.errs = append(env.errs, fmt.Errorf("%s: %q is not an integer", name, value))
+		return
+	}
+	*dst = parsed
+}
+
+// Bool подставляет логическое значение переменной name (true/false, 1/0), если она задана
+func (env *Env) Bool(dst *bool, name string) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return
+	}
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		env.errs = append(env.errs, fmt.Errorf("%s: %q is not a boolean", name, value))
+		return
+	}
+	*dst = parsed
+}
+
+// Duration подставляет длительность из переменной name (например, 30s или 24h), если она задана
+func (env *Env) Duration(dst *Duration, name string) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return
+	}
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		env.errs = append(env.errs, fmt.Errorf("%s: %q is not a duration such as 30s or 24h", name, value))
+		return
+	}
+	*dst = Duration(parsed)
+}
+
+// List подставляет список из переменной name, разделенный запятыми, если она задана
+func (env *Env) List(dst *[]string, name string) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return
+	}
+	*dst = splitList(value)
+}
+
+// Err возвращает все ошибки разбора переменных окружения
+func (env *Env) Err() error {
+	return errors.Join(env.errs...)
+}
+
+// splitList разбивает строку по запятым, отбрасывая пустые элементы
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Duration длительность, которая в JSON записывается строкой вида "30s" или "24h"
+type Duration time.Duration
+
+// UnmarshalJSON разбирает длительность из строки
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\" or \"24h\"")
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", value, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON записывает длительность строкой
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ValidatePort проверяет номер порта для прослушивания
+func ValidatePort(name string, port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%s: %d is not a valid port", name, port)
+	}
+	return nil
+}
+
+// ValidatePositiveDuration проверяет, что длительность больше нуля
+func ValidatePositiveDuration(name string, d Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s must be positive", name)
+	}
+	return nil
+}
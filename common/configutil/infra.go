@@ -0,0 +1,308 @@
+package configutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Database настройки подключения к PostgreSQL. DSN, если задан, заменяет остальные поля.
+type Database struct {
+	DSN      string `json:"dsn,omitempty"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	SSLMode  string `json:"sslmode"`
+}
+
+// DefaultDatabase настройки базы данных из docker-compose
+func DefaultDatabase() Database {
+	return Database{
+		Host:     "postgres",
+		Port:     5432,
+		User:     "user",
+		Password: "password",
+		Name:     "order_db",
+		SSLMode:  "disable",
+	}
+}
+
+// FromEnv читает DATABASE_URL и переменные DB_*
+func (db *Database) FromEnv(env *Env) {
+	env.String(&db.DSN, "DATABASE_URL")
+	env.String(&db.Host, "DB_HOST")
+	env.Int(&db.Port, "DB_PORT")
+	env.String(&db.User, "DB_USER")
+	env.String(&db.Password, "DB_PASSWORD")
+	env.String(&db.Name, "DB_NAME")
+	env.String(&db.SSLMode, "DB_SSLMODE")
+}
+
+// ConnString возвращает строку подключения для lib/pq
+func (db Database) ConnString() string {
+	if db.DSN != "" {
+		return db.DSN
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(db.User, db.Password),
+		Host:     net.JoinHostPort(db.Host, strconv.Itoa(db.Port)),
+		Path:     "/" + db.Name,
+		RawQuery: url.Values{"sslmode": {db.SSLMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// Validate проверяет, что по настройкам можно подключиться к базе данных
+func (db Database) Validate() error {
+	if db.DSN != "" {
+		if _, err := url.Parse(db.DSN); err != nil {
+			return fmt.Errorf("DATABASE_URL: %v", err)
+		}
+		return nil
+	}
+
+	var errs []error
+	if db.Host == "" {
+		errs = append(errs, errors.New("DB_HOST is required"))
+	}
+	if err := ValidatePort("DB_PORT", db.Port); err != nil {
+		errs = append(errs, err)
+	}
+	if db.User == "" {
+		errs = append(errs, errors.New("DB_USER is required"))
+	}
+	if db.Name == "" {
+		errs = append(errs, errors.New("DB_NAME is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// Kafka настройки подключения к брокерам и группа подписчиков сервиса
+type Kafka struct {
+	Brokers       []string `json:"brokers"`
+	ConsumerGroup string   `json:"consumer_group"`
+	// ConsumerWorkers сколько партиций топика обрабатываются одновременно
+	ConsumerWorkers int `json:"consumer_workers"`
+
+	// DeadLetterTopic топик сервиса для сообщений, которые не удалось обработать за Retry.MaxAttempts попыток
+	DeadLetterTopic string   `json:"dead_letter_topic"`
+	Retry           Retry    `json:"retry"`
+	Producer        Producer `json:"producer"`
+}
+
+// Retry политика повторной обработки сообщения с экспоненциальной задержкой
+type Retry struct {
+	MaxAttempts    int      `json:"max_attempts"`
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+}
+
+// Producer настройки публикации сообщений сервисом
+type Producer struct {
+	// Acks сколько реплик должны подтвердить запись: all, one или none
+	Acks string `json:"acks"`
+	// BatchSize и BatchTimeout ограничивают пачку: она отправляется, когда набрано
+	// BatchSize сообщений или с первого сообщения прошло BatchTimeout
+	BatchSize    int      `json:"batch_size"`
+	BatchTimeout Duration `json:"batch_timeout"`
+	// Compression сжатие пачек: none, gzip, snappy, lz4 или zstd
+	Compression string `json:"compression"`
+	// MaxAttempts сколько раз пачка отправляется при ошибках брокера
+	MaxAttempts int `json:"max_attempts"`
+}
+
+// ProducerAcks допустимые значения Producer.Acks
+var ProducerAcks = []string{"all", "one", "none"}
+
+// ProducerCompressions допустимые значения Producer.Compression
+var ProducerCompressions = []string{"none", "gzip", "snappy", "lz4", "zstd"}
+
+// DefaultKafka настройки Kafka из docker-compose для указанной группы подписчиков.
+// Dead-letter топик по умолчанию называется по группе: <группа>.dlq.
+func DefaultKafka(consumerGroup string) Kafka {
+	return Kafka{
+		Brokers:         []string{"kafka:9093"},
+		ConsumerGroup:   consumerGroup,
+		ConsumerWorkers: 8,
+		DeadLetterTopic: consumerGroup + ".dlq",
+		Retry: Retry{
+			MaxAttempts:    5,
+			InitialBackoff: Duration(500 * time.Millisecond),
+			MaxBackoff:     Duration(30 * time.Second),
+		},
+		Producer: Producer{
+			Acks:         "all",
+			BatchSize:    100,
+			BatchTimeout: Duration(10 * time.Millisecond),
+			Compression:  "snappy",
+			MaxAttempts:  10,
+		},
+	}
+}
+
+// FromEnv читает KAFKA_BROKERS (список через запятую) или пару KAFKA_HOST и KAFKA_PORT,
+// KAFKA_CONSUMER_GROUP, KAFKA_CONSUMER_WORKERS, KAFKA_DEAD_LETTER_TOPIC, настройки повторов KAFKA_RETRY_*
+// и публикации KAFKA_PRODUCER_*
+func (k *Kafka) FromEnv(env *Env) {
+	var host, port string
+	env.String(&host, "KAFKA_HOST")
+	env.String(&port, "KAFKA_PORT")
+	if host != "" {
+		if port == "" {
+			port = "9092"
+		}
+		k.Brokers = []string{net.JoinHostPort(host, port)}
+	}
+	env.List(&k.Brokers, "KAFKA_BROKERS")
+	env.String(&k.ConsumerGroup, "KAFKA_CONSUMER_GROUP")
+	env.Int(&k.ConsumerWorkers, "KAFKA_CONSUMER_WORKERS")
+	env.String(&k.DeadLetterTopic, "KAFKA_DEAD_LETTER_TOPIC")
+	env.Int(&k.Retry.MaxAttempts, "KAFKA_RETRY_MAX_ATTEMPTS")
+	env.Duration(&k.Retry.InitialBackoff, "KAFKA_RETRY_INITIAL_BACKOFF")
+	env.Duration(&k.Retry.MaxBackoff, "KAFKA_RETRY_MAX_BACKOFF")
+	env.String(&k.Producer.Acks, "KAFKA_PRODUCER_ACKS")
+	env.Int(&k.Producer.BatchSize, "KAFKA_PRODUCER_BATCH_SIZE")
+	env.Duration(&k.Producer.BatchTimeout, "KAFKA_PRODUCER_BATCH_TIMEOUT")
+	env.String(&k.Producer.Compression, "KAFKA_PRODUCER_COMPRESSION")
+	env.Int(&k.Producer.MaxAttempts, "KAFKA_PRODUCER_MAX_ATTEMPTS")
+}
+
+// Validate проверяет адреса брокеров, группу подписчиков, число обработчиков, политику повторов и настройки публикации
+func (k Kafka) Validate() error {
+	var errs []error
+	if len(k.Brokers) == 0 {
+		errs = append(errs, errors.New("KAFKA_BROKERS is required"))
+	}
+	for _, broker := range k.Brokers {
+		if _, port, err := net.SplitHostPort(broker); err != nil || port == "" {
+			errs = append(errs, fmt.Errorf("KAFKA_BROKERS: %q is not a host:port address", broker))
+		}
+	}
+	if k.ConsumerGroup == "" {
+		errs = append(errs, errors.New("KAFKA_CONSUMER_GROUP is required"))
+	}
+	if k.ConsumerWorkers < 1 {
+		errs = append(errs, errors.New("KAFKA_CONSUMER_WORKERS must be at least 1"))
+	}
+	if k.DeadLetterTopic == "" {
+		errs = append(errs, errors.New("KAFKA_DEAD_LETTER_TOPIC is required"))
+	}
+	if k.Retry.MaxAttempts < 1 {
+		errs = append(errs, errors.New("KAFKA_RETRY_MAX_ATTEMPTS must be at least 1"))
+	}
+	if k.Retry.InitialBackoff <= 0 {
+		errs = append(errs, errors.New("KAFKA_RETRY_INITIAL_BACKOFF must be positive"))
+	}
+	if k.Retry.MaxBackoff < k.Retry.InitialBackoff {
+		errs = append(errs, errors.New("KAFKA_RETRY_MAX_BACKOFF must not be less than KAFKA_RETRY_INITIAL_BACKOFF"))
+	}
+	if !slices.Contains(ProducerAcks, k.Producer.Acks) {
+		errs = append(errs, fmt.Errorf("KAFKA_PRODUCER_ACKS must be one of %s", strings.Join(ProducerAcks, ", ")))
+	}
+	if k.Producer.BatchSize < 1 {
+		errs = append(errs, errors.New("KAFKA_PRODUCER_BATCH_SIZE must be at least 1"))
+	}
+	if k.Producer.BatchTimeout <= 0 {
+		errs = append(errs, errors.New("KAFKA_PRODUCER_BATCH_TIMEOUT must be positive"))
+	}
+	if !slices.Contains(ProducerCompressions, k.Producer.Compression) {
+		errs = append(errs, fmt.Errorf("KAFKA_PRODUCER_COMPRESSION must be one of %s", strings.Join(ProducerCompressions, ", ")))
+	}
+	if k.Producer.MaxAttempts < 1 {
+		errs = append(errs, errors.New("KAFKA_PRODUCER_MAX_ATTEMPTS must be at least 1"))
+	}
+	return errors.Join(errs...)
+}
+
+// Topics названия топиков Kafka, общие для order-service и payment-service
+type Topics struct {
+	PaymentTransactions string `json:"payment_transactions"`
+	PaymentRefunds      string `json:"payment_refunds"`
+	PaymentCaptures     string `json:"payment_captures"`
+	PaymentResults      string `json:"payment_results"`
+}
+
+// DefaultTopics названия топиков по умолчанию
+func DefaultTopics() Topics {
+	return Topics{
+		PaymentTransactions: "payment_transactions",
+		PaymentRefunds:      "payment_refunds",
+		PaymentCaptures:     "payment_captures",
+		PaymentResults:      "payment_results",
+	}
+}
+
+// FromEnv читает переменные KAFKA_TOPIC_*
+func (t *Topics) FromEnv(env *Env) {
+	env.String(&t.PaymentTransactions, "KAFKA_TOPIC_PAYMENT_TRANSACTIONS")
+	env.String(&t.PaymentRefunds, "KAFKA_TOPIC_PAYMENT_REFUNDS")
+	env.String(&t.PaymentCaptures, "KAFKA_TOPIC_PAYMENT_CAPTURES")
+	env.String(&t.PaymentResults, "KAFKA_TOPIC_PAYMENT_RESULTS")
+}
+
+// Validate проверяет, что все топики названы и не совпадают
+func (t Topics) Validate() error {
+	var errs []error
+	seen := make(map[string]string)
+	for _, topic := range []struct{ env, name string }{
+		{"KAFKA_TOPIC_PAYMENT_TRANSACTIONS", t.PaymentTransactions},
+		{"KAFKA_TOPIC_PAYMENT_REFUNDS", t.PaymentRefunds},
+		{"KAFKA_TOPIC_PAYMENT_CAPTURES", t.PaymentCaptures},
+		{"KAFKA_TOPIC_PAYMENT_RESULTS", t.PaymentResults},
+	} {
+		if topic.name == "" {
+			errs = append(errs, fmt.Errorf("%s is required", topic.env))
+			continue
+		}
+		if other, ok := seen[topic.name]; ok {
+			errs = append(errs, fmt.Errorf("%s: topic %q is already used by %s", topic.env, topic.name, other))
+		}
+		seen[topic.name] = topic.env
+	}
+	return errors.Join(errs...)
+}
+
+// Tracing настройки экспорта трассировок OpenTelemetry
+type Tracing struct {
+	// Exporter куда отправлять спаны: none, stdout или otlp
+	Exporter string `json:"exporter"`
+	// OTLPEndpoint адрес коллектора, принимающего OTLP по HTTP, например http://jaeger:4318
+	OTLPEndpoint string `json:"otlp_endpoint"`
+}
+
+// TracingExporters допустимые значения Tracing.Exporter
+var TracingExporters = []string{"none", "stdout", "otlp"}
+
+// DefaultTracing трассировки не экспортируются, но контекст трассировки передается дальше
+func DefaultTracing() Tracing {
+	return Tracing{Exporter: "none", OTLPEndpoint: "http://localhost:4318"}
+}
+
+// FromEnv читает TRACING_EXPORTER и TRACING_OTLP_ENDPOINT
+func (t *Tracing) FromEnv(env *Env) {
+	env.String(&t.Exporter, "TRACING_EXPORTER")
+	env.String(&t.OTLPEndpoint, "TRACING_OTLP_ENDPOINT")
+}
+
+// Validate проверяет экспортер и адрес коллектора
+func (t Tracing) Validate() error {
+	if !slices.Contains(TracingExporters, t.Exporter) {
+		return fmt.Errorf("TRACING_EXPORTER must be one of %s", strings.Join(TracingExporters, ", "))
+	}
+	if t.Exporter != "otlp" {
+		return nil
+	}
+	u, err := url.Parse(t.OTLPEndpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("TRACING_OTLP_ENDPOINT: %q is not an http(s) URL such as http://jaeger:4318", t.OTLPEndpoint)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package deadletter
+
+import (
+	"common/bus"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+var (
+	// ErrActorRequired возвращается для действия без имени администратора
+	ErrActorRequired = errors.New("actor is required")
+	// ErrReasonRequired возвращается при отбрасывании сообщения без причины
+	ErrReasonRequired = errors.New("reason is required")
+	// ErrInvalidValue возвращается для исправленного сообщения, которое не является JSON
+	ErrInvalidValue = errors.New("edited value must be valid JSON")
+)
+
+// Admin разбор отложенных сообщений: просмотр, возврат в исходный топик и отбрасывание
+type Admin struct {
+	store     Store
+	publisher bus.Publisher
+}
+
+// NewAdmin создает Admin, возвращающий сообщения в топики через publisher
+func NewAdmin(store Store, publisher bus.Publisher) *Admin {
+	return &Admin{store: store, publisher: publisher}
+}
+
+// List возвращает отложенные сообщения, начиная с новых
+func (admin *Admin) List(ctx context.Context, filter Filter) ([]Message, error) {
+	return admin.store.List(ctx, filter)
+}
+
+// View возвращает сообщение с журналом действий. Просмотр содержимого тоже записывается в журнал.
+func (admin *Admin) View(ctx context.Context, id int64, actor string) (Message, []AuditEntry, error) {
+	if actor == "" {
+		return Message{}, nil, ErrActorRequired
+	}
+	msg, err := admin.store.Get(ctx, id)
+	if err != nil {
+		return Message{}, nil, err
+	}
+	if err := admin.store.Audit(ctx, AuditEntry{MessageID: id, Action: ActionViewed, Actor: actor}); err != nil {
+		return Message{}, nil, err
+	}
+	history, err := admin.store.History(ctx, id)
+	if err != nil {
+		return Message{}, nil, err
+	}
+	return msg, history, nil
+}
+
+// Requeue публикует сообщение в исходный топик, заменив его на value, если оно задано,
+// и отмечает сообщение возвращенным. Если отметить не удалось, сообщение уже опубликовано:
+// обработчики идемпотентны, поэтому повторный возврат безопасен.
+func (admin *Admin) Requeue(ctx context.Context, id int64, actor string, reason string, value []byte) (Message, error) {
+	if actor == "" {
+		return Message{}, ErrActorRequired
+	}
+	if value != nil && !json.Valid(value) {
+		return Message{}, ErrInvalidValue
+	}
+	msg, err := admin.store.Get(ctx, id)
+	if err != nil {
+		return Message{}, err
+	}
+	if msg.Status != StatusPending {
+		return Message{}, ErrResolved
+	}
+
+	requeued := bus.Message{Topic: msg.Topic, Key: msg.Key, Value: msg.Value}
+	if value != nil {
+		requeued.Value = value
+	}
+	if err := admin.publisher.Publish(ctx, requeued); err != nil {
+		return Message{}, fmt.Errorf("could not requeue message %d to %s: %v", id, msg.Topic, err)
+	}
+
+	msg, err = admin.store.Resolve(ctx, id, AuditEntry{Action: ActionRequeued, Actor: actor, Reason: reason, Value: value})
+	if err != nil {
+		return Message{}, err
+	}
+	log.Printf("Dead letter %d requeued to %s by %s", id, msg.Topic, actor)
+	return msg, nil
+}
+
+// Discard отбрасывает сообщение с указанием причины
+func (admin *Admin) Discard(ctx context.Context, id int64, actor string, reason string) (Message, error) {
+	if actor == "" {
+		return Message{}, ErrActorRequired
+	}
+	if reason == "" {
+		return Message{}, ErrReasonRequired
+	}
+	msg, err := admin.store.Resolve(ctx, id, AuditEntry{Action: ActionDiscarded, Actor: actor, Reason: reason})
+	if err != nil {
+		return Message{}, err
+	}
+	log.Printf("Dead letter %d discarded by %s: %s", id, actor, reason)
+	return msg, nil
+}
+
+// Collect читает dead-letter топик сервиса и сохраняет сообщения в store до отмены ctx.
+// Читать топик нужно подписчиком без WithRetry: сообщение, которое не удалось сохранить,
+// доставляется повторно, а не отправляется в тот же dead-letter топик.
+func Collect(ctx context.Context, subscriber bus.Subscriber, topic string, store Store) error {
+	return subscriber.Subscribe(ctx, topic, func(ctx context.Context, msg bus.Message) error {
+		deadLetter := Message{
+			Kind:   KindDeadLettered,
+			Topic:  msg.Headers[bus.HeaderOriginalTopic],
+			Key:    msg.Key,
+			Value:  msg.Value,
+			Reason: msg.Headers[bus.HeaderError],
+		}
+		if deadLetter.Topic == "" {
+			// Сообщение опубликовано в топик не через WithRetry, вернуть его можно только сюда же
+			deadLetter.Topic = msg.Topic
+		}
+		if attempts, err := strconv.Atoi(msg.Headers[bus.HeaderAttempts]); err == nil {
+			deadLetter.Attempts = attempts
+		}
+		return store.Add(ctx, deadLetter)
+	})
+}
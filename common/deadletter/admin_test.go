@@ -0,0 +1,128 @@
+package deadletter
+
+import (
+	"common/bus"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminRequeueAndDiscard(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	messages := bus.NewMemoryBus()
+	handler := NewHandler(NewAdmin(store, messages))
+
+	do := func(method, path, actor, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if actor != "" {
+			req.Header.Set(ActorHeader, actor)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if err := store.Add(ctx, Message{Kind: KindQuarantined, Topic: "payment_results", Key: []byte("tx"), Value: []byte(`not json`), Reason: "malformed", Attempts: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(ctx, Message{Kind: KindDeadLettered, Topic: "payment_results", Value: []byte(`{"n":1}`), Reason: "order not found", Attempts: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := do(http.MethodGet, "/admin/dead-letters", "", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("list without actor: status %d, want 400", rec.Code)
+	}
+	rec := do(http.MethodGet, "/admin/dead-letters?kind=quarantined", "alice", "")
+	var summaries []MessageSummary
+	if err := json.NewDecoder(rec.Body).Decode(&summaries); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || len(summaries) != 1 || summaries[0].ID != 1 || summaries[0].Status != StatusPending {
+		t.Fatalf("list quarantined: status %d, %+v", rec.Code, summaries)
+	}
+
+	// Исправленное сообщение должно быть JSON, исходное возвращается как есть
+	if rec := do(http.MethodPost, "/admin/dead-letters/1/requeue", "alice", `{"value":"not json"}`); rec.Code != http.StatusOK {
+		t.Fatalf("requeue with JSON string: status %d: %s", rec.Code, rec.Body)
+	}
+	published := messages.Messages("payment_results")
+	if len(published) != 1 || string(published[0].Key) != "tx" || string(published[0].Value) != `"not json"` {
+		t.Fatalf("published = %+v", published)
+	}
+	if rec := do(http.MethodPost, "/admin/dead-letters/1/requeue", "alice", ""); rec.Code != http.StatusConflict {
+		t.Fatalf("second requeue: status %d, want 409", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/admin/dead-letters/2/discard", "bob", `{}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("discard without reason: status %d, want 400", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/admin/dead-letters/2/discard", "bob", `{"reason":"order was deleted"}`); rec.Code != http.StatusOK {
+		t.Fatalf("discard: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/admin/dead-letters/3/discard", "bob", `{"reason":"x"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("discard unknown message: status %d, want 404", rec.Code)
+	}
+	if len(messages.Messages("payment_results")) != 1 {
+		t.Fatal("discarded message must not be published")
+	}
+
+	rec = do(http.MethodGet, "/admin/dead-letters/1", "carol", "")
+	var details MessageDetails
+	if err := json.NewDecoder(rec.Body).Decode(&details); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || details.Status != StatusRequeued || details.ResolvedAt == nil || string(details.Value) != `"not json"` {
+		t.Fatalf("view: status %d, %+v", rec.Code, details)
+	}
+	var actions []string
+	for _, entry := range details.History {
+		actions = append(actions, entry.Action+":"+entry.Actor)
+	}
+	if got := strings.Join(actions, ","); got != "requeued:alice,viewed:carol" {
+		t.Fatalf("history = %s", got)
+	}
+}
+
+func TestCollectStoresDeadLetters(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	store := NewMemoryStore()
+	messages := bus.NewMemoryBus()
+
+	err := messages.Publish(ctx, bus.Message{
+		Topic: "orders.dlq",
+		Key:   []byte("tx"),
+		Value: []byte(`{}`),
+		Headers: map[string]string{
+			bus.HeaderOriginalTopic: "payment_results",
+			bus.HeaderError:         "order not found",
+			bus.HeaderAttempts:      strconv.Itoa(3),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go Collect(ctx, messages.Subscriber("orders"), "orders.dlq", store)
+	if err := messages.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.List(ctx, Filter{Kind: KindDeadLettered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("stored %d messages, want 1", len(stored))
+	}
+	msg := stored[0]
+	if msg.Topic != "payment_results" || msg.Reason != "order not found" || msg.Attempts != 3 || string(msg.Key) != "tx" || msg.Status != StatusPending {
+		t.Fatalf("stored message = %+v", msg)
+	}
+}
@@ -0,0 +1,104 @@
+// Package deadletter хранилище сообщений шины, которые сервис отложил, не обработав:
+// они подтверждаются в топике, чтобы не останавливать его чтение, и сохраняются
+// для разбора вручную. Администратор может вернуть сообщение в исходный топик,
+// при необходимости исправив его, или отбросить с указанием причины; каждое
+// действие записывается в журнал.
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Виды отложенных сообщений
+const (
+	// KindQuarantined сообщение, которое не удалось разобрать: некорректный JSON,
+	// неизвестный тип или версия события, недопустимое содержимое
+	KindQuarantined = "quarantined"
+	// KindDeadLettered сообщение, обработка которого не удалась за все попытки,
+	// прочитанное из dead-letter топика сервиса
+	KindDeadLettered = "dead_lettered"
+)
+
+// Статусы отложенного сообщения
+const (
+	StatusPending   = "pending"   // ждет разбора
+	StatusRequeued  = "requeued"  // возвращено в исходный топик
+	StatusDiscarded = "discarded" // отброшено
+)
+
+// Действия администратора в журнале
+const (
+	ActionViewed    = "viewed"
+	ActionRequeued  = "requeued"
+	ActionDiscarded = "discarded"
+)
+
+var (
+	// ErrNotFound возвращается для несуществующего сообщения
+	ErrNotFound = errors.New("dead letter not found")
+	// ErrResolved возвращается при попытке повторно вернуть или отбросить разобранное сообщение
+	ErrResolved = errors.New("dead letter is already resolved")
+)
+
+// Message отложенное сообщение шины и причина, по которой оно не обработано
+type Message struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	Topic      string     `json:"topic"` // исходный топик, в который сообщение возвращается при повторе
+	Key        []byte     `json:"key,omitempty"`
+	Value      []byte     `json:"value"`
+	Reason     string     `json:"reason"`
+	Attempts   int        `json:"attempts"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// AuditEntry запись журнала действий с отложенным сообщением
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	MessageID int64     `json:"message_id"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	Reason    string    `json:"reason,omitempty"`
+	Value     []byte    `json:"value,omitempty"` // исправленное сообщение, если его вернули измененным
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Filter условия выборки отложенных сообщений, пустые поля не ограничивают выборку
+type Filter struct {
+	Kind   string
+	Status string
+	Limit  int
+}
+
+// Store хранилище отложенных сообщений сервиса
+type Store interface {
+	// Add сохраняет сообщение в статусе pending, ID и время создания назначает хранилище
+	Add(ctx context.Context, msg Message) error
+	// List возвращает сообщения, начиная с новых
+	List(ctx context.Context, filter Filter) ([]Message, error)
+	// Get возвращает сообщение по ID или ErrNotFound
+	Get(ctx context.Context, id int64) (Message, error)
+	// Resolve переводит сообщение из pending в статус по действию entry.Action (requeued
+	// или discarded) и записывает entry в журнал одной операцией. Для уже разобранного
+	// сообщения возвращает ErrResolved.
+	Resolve(ctx context.Context, id int64, entry AuditEntry) (Message, error)
+	// Audit записывает в журнал действие, не меняющее статус сообщения
+	Audit(ctx context.Context, entry AuditEntry) error
+	// History возвращает журнал действий с сообщением в хронологическом порядке
+	History(ctx context.Context, id int64) ([]AuditEntry, error)
+}
+
+// resolvedStatus статус, в который сообщение переводит действие
+func resolvedStatus(action string) (string, bool) {
+	switch action {
+	case ActionRequeued:
+		return StatusRequeued, true
+	case ActionDiscarded:
+		return StatusDiscarded, true
+	}
+	return "", false
+}
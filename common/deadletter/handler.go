@@ -0,0 +1,297 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ActorHeader заголовок с именем администратора, от имени которого выполняется действие
+const ActorHeader = "X-Admin-User"
+
+// Размер страницы списка отложенных сообщений
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// Handler HTTP API разбора отложенных сообщений:
+//
+//	GET  /admin/dead-letters              список сообщений, фильтры kind, status, limit
+//	GET  /admin/dead-letters/{id}         сообщение с содержимым и журналом действий
+//	POST /admin/dead-letters/{id}/requeue вернуть в исходный топик, возможно исправленным
+//	POST /admin/dead-letters/{id}/discard отбросить с указанием причины
+type Handler struct {
+	admin *Admin
+	mux   *http.ServeMux
+}
+
+// NewHandler создает HTTP API поверх admin
+func NewHandler(admin *Admin) *Handler {
+	h := &Handler{admin: admin, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /admin/dead-letters", h.List)
+	h.mux.HandleFunc("GET /admin/dead-letters/{id}", h.View)
+	h.mux.HandleFunc("POST /admin/dead-letters/{id}/requeue", h.Requeue)
+	h.mux.HandleFunc("POST /admin/dead-letters/{id}/discard", h.Discard)
+	return h
+}
+
+// ServeHTTP обрабатывает запросы к /admin/dead-letters
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// MessageSummary отложенное сообщение в списке, без содержимого
+type MessageSummary struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	Topic      string     `json:"topic"`
+	Reason     string     `json:"reason"`
+	Attempts   int        `json:"attempts"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// MessageDetails отложенное сообщение с содержимым и журналом действий
+type MessageDetails struct {
+	MessageSummary
+	Key     string           `json:"key,omitempty"`
+	Value   json.RawMessage  `json:"value" swaggertype:"object"` // JSON-сообщение или строка, если это не JSON
+	History []AuditEntryView `json:"history"`
+}
+
+// AuditEntryView запись журнала действий
+type AuditEntryView struct {
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	Reason    string          `json:"reason,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty" swaggertype:"object"` // исправленное сообщение при возврате
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// RequeueRequest запрос на возврат сообщения в исходный топик
+type RequeueRequest struct {
+	Reason string          `json:"reason"`
+	Value  json.RawMessage `json:"value,omitempty" swaggertype:"object"` // исправленное сообщение, по умолчанию исходное
+}
+
+// DiscardRequest запрос на отбрасывание сообщения
+type DiscardRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ErrorResponse ошибка API
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// List godoc
+// @Summary Список отложенных сообщений
+// @Description Сообщения, которые не удалось разобрать или обработать, начиная с новых
+// @Tags admin
+// @Produce json
+// @Param X-Admin-User header string true "Администратор"
+// @Param kind query string false "quarantined или dead_lettered"
+// @Param status query string false "pending, requeued или discarded"
+// @Param limit query int false "Размер страницы, по умолчанию 50, не больше 500"
+// @Success 200 {array} deadletter.MessageSummary
+// @Failure 400 {object} deadletter.ErrorResponse
+// @Failure 500 {object} deadletter.ErrorResponse
+// @Router /admin/dead-letters [get]
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(ActorHeader) == "" {
+		sendError(w, ErrActorRequired)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := Filter{Kind: query.Get("kind"), Status: query.Get("status"), Limit: defaultListLimit}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			sendJSON(w, ErrorResponse{Message: "limit must be a positive integer"}, http.StatusBadRequest)
+			return
+		}
+		filter.Limit = min(limit, maxListLimit)
+	}
+
+	messages, err := h.admin.List(r.Context(), filter)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	summaries := make([]MessageSummary, 0, len(messages))
+	for _, msg := range messages {
+		summaries = append(summaries, summary(msg))
+	}
+	sendJSON(w, summaries, http.StatusOK)
+}
+
+// View godoc
+// @Summary Отложенное сообщение
+// @Description Содержимое сообщения и журнал действий с ним. Просмотр записывается в журнал
+// @Tags admin
+// @Produce json
+// @Param X-Admin-User header string true "Администратор"
+// @Param id path int true "ID сообщения"
+// @Success 200 {object} deadletter.MessageDetails
+// @Failure 400 {object} deadletter.ErrorResponse
+// @Failure 404 {object} deadletter.ErrorResponse
+// @Failure 500 {object} deadletter.ErrorResponse
+// @Router /admin/dead-letters/{id} [get]
+func (h *Handler) View(w http.ResponseWriter, r *http.Request) {
+	id, ok := messageID(w, r)
+	if !ok {
+		return
+	}
+
+	msg, history, err := h.admin.View(r.Context(), id, r.Header.Get(ActorHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	details := MessageDetails{
+		MessageSummary: summary(msg),
+		Key:            string(msg.Key),
+		Value:          rawJSON(msg.Value),
+		History:        make([]AuditEntryView, 0, len(history)),
+	}
+	for _, entry := range history {
+		view := AuditEntryView{Action: entry.Action, Actor: entry.Actor, Reason: entry.Reason, CreatedAt: entry.CreatedAt}
+		if entry.Value != nil {
+			view.Value = rawJSON(entry.Value)
+		}
+		details.History = append(details.History, view)
+	}
+	sendJSON(w, details, http.StatusOK)
+}
+
+// Requeue godoc
+// @Summary Вернуть сообщение в топик
+// @Description Публикует сообщение в исходный топик, исходным или исправленным, и отмечает его возвращенным
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-User header string true "Администратор"
+// @Param id path int true "ID сообщения"
+// @Param request body deadletter.RequeueRequest false "Причина и исправленное сообщение"
+// @Success 200 {object} deadletter.MessageSummary
+// @Failure 400 {object} deadletter.ErrorResponse
+// @Failure 404 {object} deadletter.ErrorResponse
+// @Failure 409 {object} deadletter.ErrorResponse
+// @Failure 500 {object} deadletter.ErrorResponse
+// @Router /admin/dead-letters/{id}/requeue [post]
+func (h *Handler) Requeue(w http.ResponseWriter, r *http.Request) {
+	id, ok := messageID(w, r)
+	if !ok {
+		return
+	}
+	var req RequeueRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSON(w, ErrorResponse{Message: "Invalid request: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var value []byte
+	if len(req.Value) > 0 {
+		value = req.Value
+	}
+	msg, err := h.admin.Requeue(r.Context(), id, r.Header.Get(ActorHeader), req.Reason, value)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	sendJSON(w, summary(msg), http.StatusOK)
+}
+
+// Discard godoc
+// @Summary Отбросить сообщение
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-User header string true "Администратор"
+// @Param id path int true "ID сообщения"
+// @Param request body deadletter.DiscardRequest true "Причина"
+// @Success 200 {object} deadletter.MessageSummary
+// @Failure 400 {object} deadletter.ErrorResponse
+// @Failure 404 {object} deadletter.ErrorResponse
+// @Failure 409 {object} deadletter.ErrorResponse
+// @Failure 500 {object} deadletter.ErrorResponse
+// @Router /admin/dead-letters/{id}/discard [post]
+func (h *Handler) Discard(w http.ResponseWriter, r *http.Request) {
+	id, ok := messageID(w, r)
+	if !ok {
+		return
+	}
+	var req DiscardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, ErrorResponse{Message: "Invalid request: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	msg, err := h.admin.Discard(r.Context(), id, r.Header.Get(ActorHeader), req.Reason)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	sendJSON(w, summary(msg), http.StatusOK)
+}
+
+// messageID разбирает ID сообщения из пути и отвечает 400, если он некорректен
+func messageID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		sendJSON(w, ErrorResponse{Message: "id must be a positive integer"}, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// summary сообщение без содержимого
+func summary(msg Message) MessageSummary {
+	return MessageSummary{
+		ID:         msg.ID,
+		Kind:       msg.Kind,
+		Topic:      msg.Topic,
+		Reason:     msg.Reason,
+		Attempts:   msg.Attempts,
+		Status:     msg.Status,
+		CreatedAt:  msg.CreatedAt,
+		ResolvedAt: msg.ResolvedAt,
+	}
+}
+
+// rawJSON возвращает JSON-сообщение как есть, а любое другое — JSON-строкой
+func rawJSON(value []byte) json.RawMessage {
+	if json.Valid(value) {
+		return value
+	}
+	quoted, _ := json.Marshal(string(value))
+	return quoted
+}
+
+// sendError отвечает статусом, соответствующим ошибке
+func sendError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrActorRequired), errors.Is(err, ErrReasonRequired), errors.Is(err, ErrInvalidValue):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrResolved):
+		status = http.StatusConflict
+	}
+	sendJSON(w, ErrorResponse{Message: err.Error()}, status)
+}
+
+// sendJSON отвечает JSON-документом
+func sendJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,136 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryStore хранилище отложенных сообщений в памяти процесса для тестов
+type MemoryStore struct {
+	mu       sync.Mutex
+	messages []Message // ID сообщения — его индекс плюс один
+	audit    []AuditEntry
+}
+
+// NewMemoryStore создает пустое хранилище в памяти
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Add сохраняет копию сообщения
+func (s *MemoryStore) Add(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg.ID = int64(len(s.messages) + 1)
+	msg.Key = append([]byte(nil), msg.Key...)
+	msg.Value = append([]byte(nil), msg.Value...)
+	msg.Status = StatusPending
+	msg.CreatedAt = time.Now().UTC()
+	msg.ResolvedAt = nil
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// List возвращает сообщения, начиная с новых
+func (s *MemoryStore) List(ctx context.Context, filter Filter) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []Message
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		msg := s.messages[i]
+		if (filter.Kind != "" && msg.Kind != filter.Kind) || (filter.Status != "" && msg.Status != filter.Status) {
+			continue
+		}
+		messages = append(messages, msg)
+		if filter.Limit > 0 && len(messages) == filter.Limit {
+			break
+		}
+	}
+	return messages, nil
+}
+
+// Get возвращает сообщение по ID
+func (s *MemoryStore) Get(ctx context.Context, id int64) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, err := s.message(id)
+	if err != nil {
+		return Message{}, err
+	}
+	return *msg, nil
+}
+
+// Resolve переводит сообщение в статус по действию и записывает действие в журнал
+func (s *MemoryStore) Resolve(ctx context.Context, id int64, entry AuditEntry) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := resolvedStatus(entry.Action)
+	if !ok {
+		return Message{}, fmt.Errorf("unknown resolution %q", entry.Action)
+	}
+	msg, err := s.message(id)
+	if err != nil {
+		return Message{}, err
+	}
+	if msg.Status != StatusPending {
+		return Message{}, ErrResolved
+	}
+
+	now := time.Now().UTC()
+	msg.Status = status
+	msg.ResolvedAt = &now
+	entry.MessageID = id
+	s.addAudit(entry)
+	return *msg, nil
+}
+
+// Audit записывает действие в журнал
+func (s *MemoryStore) Audit(ctx context.Context, entry AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.message(entry.MessageID); err != nil {
+		return err
+	}
+	s.addAudit(entry)
+	return nil
+}
+
+// History возвращает журнал действий с сообщением
+func (s *MemoryStore) History(ctx context.Context, id int64) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.message(id); err != nil {
+		return nil, err
+	}
+	var entries []AuditEntry
+	for _, entry := range s.audit {
+		if entry.MessageID == id {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// message возвращает сообщение по ID, вызывается под блокировкой
+func (s *MemoryStore) message(id int64) (*Message, error) {
+	if id < 1 || id > int64(len(s.messages)) {
+		return nil, ErrNotFound
+	}
+	return &s.messages[id-1], nil
+}
+
+// addAudit добавляет запись в журнал, вызывается под блокировкой
+func (s *MemoryStore) addAudit(entry AuditEntry) {
+	entry.ID = int64(len(s.audit) + 1)
+	entry.Value = append([]byte(nil), entry.Value...)
+	entry.CreatedAt = time.Now().UTC()
+	s.audit = append(s.audit, entry)
+}
@@ -0,0 +1,224 @@
+package deadletter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PostgresStore хранилище отложенных сообщений в таблицах сервиса. Сервисы могут
+// работать с общей базой данных, поэтому у каждого свои таблицы, созданные его миграциями:
+//
+//	CREATE TABLE <table> (
+//		id BIGSERIAL PRIMARY KEY,
+//		kind VARCHAR(50) NOT NULL,
+//		topic VARCHAR(255) NOT NULL,
+//		message_key BYTEA,
+//		message_value BYTEA NOT NULL,
+//		reason TEXT NOT NULL,
+//		attempts INT NOT NULL DEFAULT 0,
+//		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+//		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+//		resolved_at TIMESTAMP
+//	);
+//
+//	CREATE TABLE <table>_audit (
+//		id BIGSERIAL PRIMARY KEY,
+//		message_id BIGINT NOT NULL REFERENCES <table> (id),
+//		action VARCHAR(20) NOT NULL,
+//		actor VARCHAR(255) NOT NULL,
+//		reason TEXT,
+//		edited_value BYTEA,
+//		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+//	);
+type PostgresStore struct {
+	db         *sql.DB
+	table      string
+	auditTable string
+}
+
+// NewPostgresStore создает хранилище поверх таблицы table и журнала table_audit
+func NewPostgresStore(db *sql.DB, table string) *PostgresStore {
+	return &PostgresStore{db: db, table: table, auditTable: table + "_audit"}
+}
+
+// messageColumns колонки сообщения в порядке scanMessage
+const messageColumns = "id, kind, topic, message_key, message_value, reason, attempts, status, created_at, resolved_at"
+
+// rowScanner общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage читает сообщение из строки с колонками messageColumns
+func scanMessage(row rowScanner) (Message, error) {
+	var msg Message
+	var resolvedAt sql.NullTime
+	err := row.Scan(&msg.ID, &msg.Kind, &msg.Topic, &msg.Key, &msg.Value, &msg.Reason, &msg.Attempts, &msg.Status, &msg.CreatedAt, &resolvedAt)
+	if resolvedAt.Valid {
+		msg.ResolvedAt = &resolvedAt.Time
+	}
+	return msg, err
+}
+
+// Add сохраняет сообщение в таблицу
+func (s *PostgresStore) Add(ctx context.Context, msg Message) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (kind, topic, message_key, message_value, reason, attempts)
+		VALUES ($1, $2, $3, $4, $5, $6)`, s.table),
+		msg.Kind, msg.Topic, msg.Key, msg.Value, msg.Reason, msg.Attempts)
+	if err != nil {
+		return fmt.Errorf("could not save message from %s: %v", msg.Topic, err)
+	}
+	return nil
+}
+
+// List возвращает сообщения, начиная с новых
+func (s *PostgresStore) List(ctx context.Context, filter Filter) ([]Message, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Kind != "" {
+		args = append(args, filter.Kind)
+		conditions = append(conditions, fmt.Sprintf("kind = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", messageColumns, s.table)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not list messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan message: %v", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// Get возвращает сообщение по ID
+func (s *PostgresStore) Get(ctx context.Context, id int64) (Message, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE id = $1", messageColumns, s.table), id)
+	msg, err := scanMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, ErrNotFound
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("could not get message %d: %v", id, err)
+	}
+	return msg, nil
+}
+
+// Resolve переводит сообщение в статус по действию и записывает действие в журнал в одной транзакции
+func (s *PostgresStore) Resolve(ctx context.Context, id int64, entry AuditEntry) (Message, error) {
+	status, ok := resolvedStatus(entry.Action)
+	if !ok {
+		return Message{}, fmt.Errorf("unknown resolution %q", entry.Action)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Message{}, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Условие на статус не дает двум администраторам разобрать сообщение дважды
+	row := tx.QueryRowContext(ctx, fmt.Sprintf(`
+		UPDATE %s SET status = $1, resolved_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = $3
+		RETURNING %s`, s.table, messageColumns), status, id, StatusPending)
+	msg, err := scanMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)", s.table), id).Scan(&exists)
+		if err != nil {
+			return Message{}, fmt.Errorf("could not get message %d: %v", id, err)
+		}
+		if !exists {
+			return Message{}, ErrNotFound
+		}
+		return Message{}, ErrResolved
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("could not resolve message %d: %v", id, err)
+	}
+
+	entry.MessageID = id
+	if err := s.insertAudit(ctx, tx, entry); err != nil {
+		return Message{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Message{}, fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return msg, nil
+}
+
+// Audit записывает действие в журнал
+func (s *PostgresStore) Audit(ctx context.Context, entry AuditEntry) error {
+	if _, err := s.Get(ctx, entry.MessageID); err != nil {
+		return err
+	}
+	return s.insertAudit(ctx, s.db, entry)
+}
+
+// execer общий интерфейс *sql.DB и *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertAudit добавляет запись в журнал
+func (s *PostgresStore) insertAudit(ctx context.Context, db execer, entry AuditEntry) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (message_id, action, actor, reason, edited_value)
+		VALUES ($1, $2, $3, $4, $5)`, s.auditTable),
+		entry.MessageID, entry.Action, entry.Actor, entry.Reason, entry.Value)
+	if err != nil {
+		return fmt.Errorf("could not record %s of message %d: %v", entry.Action, entry.MessageID, err)
+	}
+	return nil
+}
+
+// History возвращает журнал действий с сообщением
+func (s *PostgresStore) History(ctx context.Context, id int64) ([]AuditEntry, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, message_id, action, actor, COALESCE(reason, ''), edited_value, created_at
+		FROM %s
+		WHERE message_id = $1
+		ORDER BY id`, s.auditTable), id)
+	if err != nil {
+		return nil, fmt.Errorf("could not get history of message %d: %v", id, err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.MessageID, &entry.Action, &entry.Actor, &entry.Reason, &entry.Value, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan audit entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,170 @@
+// Package events типизированные события между order-service и payment-service.
+//
+// Каждое сообщение в Kafka — конверт Envelope с ID, типом и версией схемы события,
+// временем возникновения, сквозным ID (ID заказа) и содержимым. Разбор строгий:
+// неизвестные поля, пропущенные обязательные поля, неизвестные типы и версии
+// считаются ошибкой, и такое сообщение уходит в карантин, а не роняет обработчик.
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Команды order-service для payment-service
+const (
+	PaymentRequested = "payment_requested"
+	RefundRequested  = "refund_requested"
+	CaptureRequested = "capture_requested"
+)
+
+// Результаты оплаты, возврата и списания от payment-service
+const (
+	PaymentSucceeded = "payment_succeeded"
+	PaymentFailed    = "payment_failed"
+	RefundCompleted  = "refund_completed"
+	RefundFailed     = "refund_failed"
+	CaptureCompleted = "capture_completed"
+	CaptureFailed    = "capture_failed"
+	HoldExpired      = "hold_expired"
+)
+
+// versions последняя поддерживаемая версия схемы каждого типа событий.
+// Несовместимое изменение содержимого повышает версию, а обработчики
+// учатся разбирать новую версию раньше, чем ее начинают публиковать.
+var versions = map[string]int{
+	PaymentRequested: 1,
+	RefundRequested:  1,
+	CaptureRequested: 1,
+	PaymentSucceeded: 1,
+	PaymentFailed:    1,
+	RefundCompleted:  1,
+	RefundFailed:     1,
+	CaptureCompleted: 1,
+	CaptureFailed:    1,
+	HoldExpired:      1,
+}
+
+var (
+	// ErrMalformed возвращается для сообщения с некорректным конвертом или содержимым
+	ErrMalformed = errors.New("malformed event")
+	// ErrUnknownType возвращается для события неизвестного или неожиданного в топике типа
+	ErrUnknownType = errors.New("unknown event type")
+	// ErrUnsupportedVersion возвращается для события версии, которую сервис не умеет разбирать
+	ErrUnsupportedVersion = errors.New("unsupported event version")
+)
+
+// idNamespace пространство имен детерминированных ID событий
+var idNamespace = uuid.MustParse("8d0c7a57-64a4-4b55-9a3e-1f5d2c9e0b61")
+
+// Envelope конверт события
+type Envelope struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	Version       int             `json:"version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	CorrelationID string          `json:"correlation_id"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// Payload содержимое события, которое проверяет себя после разбора
+type Payload interface {
+	Validate() error
+}
+
+// New создает событие последней версии типа eventType. ID события выводится из типа и key,
+// поэтому повторная публикация того же события (например, после повторной доставки
+// команды) получает тот же ID.
+func New(eventType string, key string, correlationId string, payload Payload) (Envelope, error) {
+	version, ok := versions[eventType]
+	if !ok {
+		return Envelope{}, fmt.Errorf("%w: %q", ErrUnknownType, eventType)
+	}
+	if err := payload.Validate(); err != nil {
+		return Envelope{}, err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("could not marshal %s payload: %v", eventType, err)
+	}
+	return Envelope{
+		ID:            uuid.NewSHA1(idNamespace, []byte(eventType+"\x00"+key)).String(),
+		Type:          eventType,
+		Version:       version,
+		OccurredAt:    time.Now().UTC(),
+		CorrelationID: correlationId,
+		Payload:       body,
+	}, nil
+}
+
+// Decode строго разбирает конверт события и проверяет его тип и версию
+func Decode(data []byte) (Envelope, error) {
+	var event Envelope
+	if err := decodeStrict(data, &event); err != nil {
+		return Envelope{}, err
+	}
+
+	switch {
+	case event.ID == "":
+		return Envelope{}, fmt.Errorf("%w: id is required", ErrMalformed)
+	case event.Type == "":
+		return Envelope{}, fmt.Errorf("%w: type is required", ErrMalformed)
+	case event.OccurredAt.IsZero():
+		return Envelope{}, fmt.Errorf("%w: occurred_at is required", ErrMalformed)
+	case len(event.Payload) == 0 || bytes.Equal(event.Payload, []byte("null")):
+		return Envelope{}, fmt.Errorf("%w: payload is required", ErrMalformed)
+	}
+
+	latest, ok := versions[event.Type]
+	if !ok {
+		return Envelope{}, fmt.Errorf("%w: %q", ErrUnknownType, event.Type)
+	}
+	if event.Version < 1 || event.Version > latest {
+		return Envelope{}, fmt.Errorf("%w: %s version %d, supported up to %d", ErrUnsupportedVersion, event.Type, event.Version, latest)
+	}
+	return event, nil
+}
+
+// DecodePayload строго разбирает содержимое события в payload и проверяет его
+func (event Envelope) DecodePayload(payload Payload) error {
+	if err := decodeStrict(event.Payload, payload); err != nil {
+		return fmt.Errorf("%s payload: %w", event.Type, err)
+	}
+	if err := payload.Validate(); err != nil {
+		return fmt.Errorf("%s payload: %w", event.Type, err)
+	}
+	return nil
+}
+
+// Expect проверяет, что событие одного из типов, которые обрабатывает топик
+func (event Envelope) Expect(types ...string) error {
+	for _, eventType := range types {
+		if event.Type == eventType {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unexpected %q", ErrUnknownType, event.Type)
+}
+
+// decodeStrict разбирает ровно один JSON-объект без неизвестных полей
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("%w: unexpected data after the JSON object", ErrMalformed)
+	}
+	return nil
+}
+
+// Invalid сообщает, что сообщение нельзя обработать ни сейчас, ни при повторной доставке
+func Invalid(err error) bool {
+	return errors.Is(err, ErrMalformed) || errors.Is(err, ErrUnknownType) || errors.Is(err, ErrUnsupportedVersion)
+}
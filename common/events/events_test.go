@@ -0,0 +1,173 @@
+package events
+
+import (
+	"common/bus"
+	"common/deadletter"
+	"common/money"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	command := TransactionCommand{
+		TransactionID: "tx-1",
+		OrderID:       "order-1",
+		UserID:        "user-1",
+		Amount:        money.FromMinor(12345),
+		Currency:      money.Currency,
+	}
+	event, err := New(PaymentRequested, command.TransactionID, command.OrderID, command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != event.ID || decoded.Type != PaymentRequested || decoded.Version != 1 || decoded.CorrelationID != "order-1" {
+		t.Fatalf("decoded envelope = %+v, want %+v", decoded, event)
+	}
+	var got TransactionCommand
+	if err := decoded.DecodePayload(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != command {
+		t.Fatalf("payload = %+v, want %+v", got, command)
+	}
+
+	// Повторная публикация того же события получает тот же ID
+	again, err := New(PaymentRequested, command.TransactionID, command.OrderID, command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != event.ID {
+		t.Fatalf("republished event ID = %s, want %s", again.ID, event.ID)
+	}
+}
+
+func TestDecodeRejectsInvalidEnvelopes(t *testing.T) {
+	const payload = `{"transaction_id":"tx","order_id":"order","user_id":"user","amount":10.5,"currency":"RUB"}`
+	envelope := func(fields string) string {
+		return `{"id":"e","type":"payment_requested","version":1,"occurred_at":"2024-01-02T03:04:05Z","correlation_id":"order",` + fields + `}`
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"not json", `not json`, ErrMalformed},
+		{"legacy payload without envelope", payload, ErrMalformed},
+		{"unknown field", envelope(`"payload":` + payload + `,"extra":1`), ErrMalformed},
+		{"trailing data", envelope(`"payload":`+payload) + `{}`, ErrMalformed},
+		{"missing payload", envelope(`"payload":null`), ErrMalformed},
+		{"missing id", strings.Replace(envelope(`"payload":`+payload), `"id":"e"`, `"id":""`, 1), ErrMalformed},
+		{"unknown type", strings.Replace(envelope(`"payload":`+payload), "payment_requested", "payment_teleported", 1), ErrUnknownType},
+		{"future version", strings.Replace(envelope(`"payload":`+payload), `"version":1`, `"version":2`, 1), ErrUnsupportedVersion},
+		{"zero version", strings.Replace(envelope(`"payload":`+payload), `"version":1`, `"version":0`, 1), ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode([]byte(tt.data))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Decode error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodePayloadIsStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"unknown field", `{"transaction_id":"tx","order_id":"order","user_id":"user","amount":1,"currency":"RUB","bonus":1}`},
+		{"missing order id", `{"transaction_id":"tx","user_id":"user","amount":1,"currency":"RUB"}`},
+		{"wrong type", `{"transaction_id":"tx","order_id":"order","user_id":"user","amount":"lots","currency":"RUB"}`},
+		{"fractional kopecks", `{"transaction_id":"tx","order_id":"order","user_id":"user","amount":1.001,"currency":"RUB"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := Envelope{Type: PaymentRequested, Version: 1, Payload: json.RawMessage(tt.payload)}
+			var command TransactionCommand
+			if err := event.DecodePayload(&command); !errors.Is(err, ErrMalformed) {
+				t.Fatalf("DecodePayload error = %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
+
+func TestHandlerQuarantinesInvalidMessages(t *testing.T) {
+	ctx := context.Background()
+	quarantine := deadletter.NewMemoryStore()
+	failure := errors.New("database is down")
+
+	var handled []string
+	handle := Handler(quarantine, func(ctx context.Context, event Envelope) error {
+		if err := event.Expect(PaymentSucceeded, HoldExpired); err != nil {
+			return err
+		}
+		var result PaymentResult
+		if err := event.DecodePayload(&result); err != nil {
+			return err
+		}
+		if result.Reason == "fail" {
+			return failure
+		}
+		handled = append(handled, result.TransactionID)
+		return nil
+	})
+
+	message := func(eventType string, result PaymentResult) bus.Message {
+		event, err := New(eventType, result.TransactionID, result.OrderID, result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bus.Message{Topic: "payment_results", Value: data}
+	}
+	result := PaymentResult{TransactionID: "tx", OrderID: "order", UserID: "user", Amount: money.FromMinor(100), Currency: money.Currency}
+
+	if err := handle(ctx, message(PaymentSucceeded, result)); err != nil {
+		t.Fatalf("valid event: %v", err)
+	}
+	if err := handle(ctx, bus.Message{Topic: "payment_results", Value: []byte(`{"amount":"oops"}`)}); err != nil {
+		t.Fatalf("malformed message must be quarantined, got %v", err)
+	}
+	if err := handle(ctx, message(RefundCompleted, result)); err != nil {
+		t.Fatalf("unexpected event type must be quarantined, got %v", err)
+	}
+	// Сбой обработки корректного события не повод для карантина: сообщение доставят повторно
+	failing := result
+	failing.Reason = "fail"
+	if err := handle(ctx, message(PaymentSucceeded, failing)); !errors.Is(err, failure) {
+		t.Fatalf("processing failure = %v, want %v", err, failure)
+	}
+
+	if len(handled) != 1 || handled[0] != "tx" {
+		t.Fatalf("handled = %v, want the valid event only", handled)
+	}
+	quarantined, err := quarantine.List(ctx, deadletter.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 2 {
+		t.Fatalf("quarantined %d messages, want 2: %+v", len(quarantined), quarantined)
+	}
+	for _, msg := range quarantined {
+		if msg.Kind != deadletter.KindQuarantined || msg.Attempts != 1 || msg.Status != deadletter.StatusPending || msg.Topic != "payment_results" || msg.Reason == "" {
+			t.Fatalf("quarantined message = %+v", msg)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package events
+
+import (
+	"common/bus"
+	"common/deadletter"
+	"context"
+	"fmt"
+	"log"
+)
+
+// Handler возвращает обработчик шины, который разбирает конверт и передает событие в handle.
+// Сообщение, которое нельзя обработать (Invalid: конверт не разобрался, тип или версия
+// неизвестны, handle отверг содержимое), помещается в карантин и подтверждается, чтобы
+// не останавливать чтение топика. Если карантин недоступен, сообщение остается
+// неподтвержденным и будет доставлено повторно.
+func Handler(quarantine deadletter.Store, handle func(ctx context.Context, event Envelope) error) bus.Handler {
+	return func(ctx context.Context, msg bus.Message) error {
+		event, err := Decode(msg.Value)
+		if err == nil {
+			err = handle(ctx, event)
+		}
+		if !Invalid(err) {
+			return err
+		}
+
+		log.Printf("Quarantining message from %s: %v", msg.Topic, err)
+		err = quarantine.Add(ctx, deadletter.Message{
+			Kind:     deadletter.KindQuarantined,
+			Topic:    msg.Topic,
+			Key:      msg.Key,
+			Value:    msg.Value,
+			Reason:   err.Error(),
+			Attempts: 1,
+		})
+		if err != nil {
+			return fmt.Errorf("could not quarantine message from %s: %v", msg.Topic, err)
+		}
+		return nil
+	}
+}
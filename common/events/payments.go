@@ -0,0 +1,54 @@
+package events
+
+import (
+	"common/money"
+	"fmt"
+)
+
+// TransactionCommand содержимое команд payment_requested, refund_requested и capture_requested.
+// Сумма и валюта проверяются payment-service: некорректная команда получает отказ, а не карантин.
+type TransactionCommand struct {
+	TransactionID string       `json:"transaction_id"`
+	OrderID       string       `json:"order_id"`
+	UserID        string       `json:"user_id"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency"`
+}
+
+// Validate проверяет обязательные поля команды
+func (command TransactionCommand) Validate() error {
+	return requireFields(
+		"transaction_id", command.TransactionID,
+		"order_id", command.OrderID,
+		"user_id", command.UserID,
+	)
+}
+
+// PaymentResult содержимое результатов оплаты, возврата, списания и истечения холда
+type PaymentResult struct {
+	TransactionID string       `json:"transaction_id"`
+	OrderID       string       `json:"order_id"`
+	UserID        string       `json:"user_id"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency"`
+	Reason        string       `json:"reason,omitempty"`
+}
+
+// Validate проверяет обязательные поля результата
+func (result PaymentResult) Validate() error {
+	return requireFields(
+		"transaction_id", result.TransactionID,
+		"order_id", result.OrderID,
+		"user_id", result.UserID,
+	)
+}
+
+// requireFields проверяет, что поля не пустые. Аргументы — пары имя, значение.
+func requireFields(fields ...string) error {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] == "" {
+			return fmt.Errorf("%w: %s is required", ErrMalformed, fields[i])
+		}
+	}
+	return nil
+}
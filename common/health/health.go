@@ -0,0 +1,107 @@
+// Package health проверки живости и готовности сервиса и ожидание зависимостей при старте
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout сколько ждать ответа одной проверки готовности
+const checkTimeout = 2 * time.Second
+
+// Статусы в ответах /healthz и /readyz
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check проверяет одну зависимость и возвращает ошибку, если она недоступна
+type Check func(ctx context.Context) error
+
+// Report ответ /healthz и /readyz
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult результат одной проверки готовности
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Live отвечает на /healthz: процесс жив и обслуживает HTTP. Зависимости не проверяются,
+// чтобы недоступная база не приводила к перезапуску всех экземпляров сервиса.
+func Live(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, Report{Status: StatusOK}, http.StatusOK)
+}
+
+// Checker отвечает на /readyz: сервис готов принимать запросы, если прошли все проверки
+type Checker struct {
+	names  []string
+	checks []Check
+}
+
+// NewChecker создает пустой набор проверок готовности
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add добавляет проверку зависимости name
+func (c *Checker) Add(name string, check Check) {
+	c.names = append(c.names, name)
+	c.checks = append(c.checks, check)
+}
+
+// Run выполняет все проверки параллельно, каждую не дольше checkTimeout
+func (c *Checker) Run(ctx context.Context) Report {
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			started := time.Now()
+			err := check(ctx)
+			results[i] = CheckResult{Status: StatusOK, DurationMs: time.Since(started).Milliseconds()}
+			if err != nil {
+				results[i].Status = StatusUnavailable
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(results))}
+	for i, result := range results {
+		report.Checks[c.names[i]] = result
+		if result.Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+// ServeHTTP отвечает 200, если все проверки прошли, и 503 с подробностями иначе
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	sendJSON(w, report, status)
+}
+
+// sendJSON отвечает JSON-документом
+func sendJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckerReportsEveryCheck(t *testing.T) {
+	checker := NewChecker()
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	checker.Add("kafka", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	rec := httptest.NewRecorder()
+	checker.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || report.Status != StatusUnavailable {
+		t.Fatalf("status %d, report %+v", rec.Code, report)
+	}
+	if got := report.Checks["database"]; got.Status != StatusOK || got.Error != "" {
+		t.Fatalf("database = %+v", got)
+	}
+	if got := report.Checks["kafka"]; got.Status != StatusUnavailable || got.Error != "connection refused" {
+		t.Fatalf("kafka = %+v", got)
+	}
+
+	ready := NewChecker()
+	ready.Add("database", func(ctx context.Context) error { return nil })
+	rec = httptest.NewRecorder()
+	ready.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ready: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestWaitRetriesUntilAvailable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	attempts := 0
+	err := Wait(ctx, "database", func(ctx context.Context) error {
+		attempts++
+		if attempts < 2 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("Wait = %v after %d attempts, want nil after 2", err, attempts)
+	}
+
+	expired, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := Wait(expired, "kafka", func(ctx context.Context) error { return errors.New("connection refused") }); err == nil {
+		t.Fatal("Wait succeeded for an unavailable dependency")
+	}
+}
+
+func TestWorkersCheck(t *testing.T) {
+	ctx := context.Background()
+	var workers Workers
+	if err := workers.Check(ctx); err == nil {
+		t.Fatal("no workers started, want an error")
+	}
+	workers.Started("payment results consumer")
+	workers.Started("dead letter collector")
+	if err := workers.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	workers.Stopped("dead letter collector")
+	if err := workers.Check(ctx); err == nil || err.Error() != "stopped: dead letter collector" {
+		t.Fatalf("Check = %v", err)
+	}
+}
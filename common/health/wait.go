@@ -0,0 +1,37 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Задержки между попытками дождаться зависимости при старте
+const (
+	waitInitialBackoff = 500 * time.Millisecond
+	waitMaxBackoff     = 10 * time.Second
+)
+
+// Wait повторяет check с экспоненциальной задержкой, пока зависимость name не станет доступна.
+// Сервис стартует раньше базы и Kafka, поэтому первая неудачная проверка — не повод завершаться.
+// Возвращает последнюю ошибку, если ctx отменили или истек его срок.
+func Wait(ctx context.Context, name string, check Check) error {
+	backoff := waitInitialBackoff
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := check(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("%s is not available, retrying in %s: %v", name, backoff, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s is not available: %v", name, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, waitMaxBackoff)
+	}
+}
@@ -0,0 +1,53 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Workers отслеживает фоновые задачи, без которых сервис не готов, например подписчиков Kafka
+type Workers struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// Started отмечает, что задача name запущена
+func (w *Workers) Started(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running == nil {
+		w.running = make(map[string]bool)
+	}
+	w.running[name] = true
+}
+
+// Stopped отмечает, что задача name остановилась
+func (w *Workers) Stopped(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.running[name] = false
+}
+
+// Check возвращает ошибку, если задачи еще не запущены или какая-то из них остановилась
+func (w *Workers) Check(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.running) == 0 {
+		return errors.New("not started")
+	}
+	var stopped []string
+	for name, running := range w.running {
+		if !running {
+			stopped = append(stopped, name)
+		}
+	}
+	if len(stopped) > 0 {
+		sort.Strings(stopped)
+		return fmt.Errorf("stopped: %s", strings.Join(stopped, ", "))
+	}
+	return nil
+}
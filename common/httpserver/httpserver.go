@@ -0,0 +1,47 @@
+// Package httpserver запускает HTTP-сервер сервиса с плавной остановкой
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Serve обслуживает запросы на addr, пока не отменен ctx. После отмены сервер
+// перестает принимать соединения и ждет завершения начатых запросов не дольше
+// shutdownTimeout. Возвращает nil, если сервер остановлен по ctx и все запросы завершились.
+func Serve(ctx context.Context, addr string, handler http.Handler, shutdownTimeout time.Duration) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %v", addr, err)
+	}
+	return serve(ctx, listener, handler, shutdownTimeout)
+}
+
+func serve(ctx context.Context, listener net.Listener, handler http.Handler, shutdownTimeout time.Duration) error {
+	server := &http.Server{Handler: handler}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("could not serve HTTP: %v", err)
+	case <-ctx.Done():
+	}
+
+	// Начатые запросы дорабатывают со своим контекстом: его отменит только отключение клиента
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("could not finish in-flight requests: %v", err)
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("could not serve HTTP: %v", err)
+	}
+	return nil
+}
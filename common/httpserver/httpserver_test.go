@@ -0,0 +1,98 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeFinishesInFlightRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, listener, handler, 5*time.Second)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+	// Пока запрос не завершен, сервер не останавливается
+	select {
+	case err := <-served:
+		t.Fatalf("server stopped with a request in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	if got := <-responses; got.err != nil || got.body != "done" {
+		t.Fatalf("in-flight request: body %q, error %v", got.body, got.err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("serve returned %v, want nil", err)
+	}
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Fatal("server still accepts connections after shutdown")
+	}
+}
+
+func TestServeGivesUpAfterShutdownTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, listener, handler, 20*time.Millisecond)
+	}()
+	go http.Get("http://" + listener.Addr().String())
+
+	<-started
+	cancel()
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Fatal("serve returned nil with a request still in flight")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not give up after the shutdown timeout")
+	}
+}
@@ -0,0 +1,74 @@
+// Package metrics общие метрики Prometheus сервисов: HTTP-запросы и работа с базой.
+// Метрики Kafka собирает пакет bus, бизнес-метрики — сами сервисы.
+package metrics
+
+import (
+	"database/sql"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by mux route template, method and response status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Latency of repository operations, each of which may run several queries in one transaction.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation"})
+)
+
+// Middleware измеряет время обработки запросов. Маршрут записывается шаблоном
+// (/order/{user_id}), а не путем запроса, чтобы число рядов не зависело от числа пользователей.
+// Подключается через mux.Router.Use и видит только запросы, для которых нашелся маршрут.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		httpRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Observe(time.Since(started).Seconds())
+	})
+}
+
+// statusRecorder запоминает статус ответа
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap дает http.ResponseController доступ к исходному ResponseWriter
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// ObserveQuery записывает время операции с базой, начатой в started:
+//
+//	defer metrics.ObserveQuery("create_order", time.Now())
+func ObserveQuery(operation string, started time.Time) {
+	dbQueryDuration.WithLabelValues(operation).Observe(time.Since(started).Seconds())
+}
+
+// RegisterDB публикует состояние пула соединений db: открытые и занятые соединения, ожидание соединения
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
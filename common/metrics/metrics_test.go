@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareLabelsByRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/order/{user_id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["user_id"] == "missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}).Methods("GET")
+
+	for _, user := range []string{"alice", "bob", "missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/order/"+user, nil))
+	}
+
+	for _, tt := range []struct {
+		status string
+		want   uint64
+	}{
+		{"200", 2},
+		{"404", 1},
+	} {
+		if got := requestCount(t, "/order/{user_id}", "GET", tt.status); got != tt.want {
+			t.Errorf("status %s: %d requests observed, want %d", tt.status, got, tt.want)
+		}
+	}
+}
+
+// requestCount число запросов, попавших в гистограмму с указанными метками
+func requestCount(t *testing.T, labels ...string) uint64 {
+	t.Helper()
+	var metric dto.Metric
+	if err := httpRequestDuration.WithLabelValues(labels...).(prometheus.Histogram).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,78 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Usage описание подкоманды migrate
+const Usage = `usage: migrate <command>
+
+commands:
+  up         apply all pending migrations
+  down [N]   roll back the last N applied migrations (default 1)
+  status     list migrations and when they were applied
+  version    print the applied and the latest known schema version`
+
+// RunCommand выполняет подкоманду migrate с аргументами args и пишет результат в out
+func (m *Migrator) RunCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", Usage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up()
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintf(out, "%s schema is up to date at version %d\n", m.service, m.Latest())
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("down: %q is not a positive number of migrations", args[1])
+			}
+			steps = n
+		}
+		rolledBack, err := m.Down(steps)
+		for _, migration := range rolledBack {
+			fmt.Fprintf(out, "rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(rolledBack) == 0 {
+			fmt.Fprintf(out, "%s has no applied migrations to roll back\n", m.service)
+		}
+		return err
+
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d_%-30s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+
+	case "version":
+		version, err := m.Version()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s schema version %d, latest known %d\n", m.service, version, m.Latest())
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], Usage)
+	}
+}
@@ -0,0 +1,331 @@
+// Package migrate применяет версионированные SQL-миграции, встроенные в сервис.
+//
+// Миграция — пара файлов NNNN_name.up.sql и NNNN_name.down.sql. Примененные версии
+// хранятся в таблице schema_migrations с именем сервиса, поэтому сервисы с общей
+// базой данных ведут свои миграции независимо.
+//
+// Сервисы не создают схему при подключении к базе: ее применяет Up, вызванный подкомандой
+// migrate или при старте с автоматической миграцией, а Check не дает сервису запуститься
+// на схеме другой версии.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrSchemaTooNew возвращается, если база данных мигрирована более новой версией сервиса
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+	// ErrPendingMigrations возвращается, если в базе данных применены не все миграции
+	ErrPendingMigrations = errors.New("database schema has pending migrations")
+)
+
+// migrationFile разбирает имя файла миграции: версия, название и направление
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration одна версия схемы с SQL для применения и отката
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status миграция и время ее применения, nil для неприменённой
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator применяет и откатывает миграции одного сервиса
+type Migrator struct {
+	db         *sql.DB
+	service    string
+	migrations []Migration // по возрастанию версии
+}
+
+// Load читает миграции из каталога dir в fsys. У каждой версии должны быть
+// и up-, и down-скрипт, версии не должны повторяться.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected file %s in migrations, expected NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		if version <= 0 {
+			return nil, fmt.Errorf("migration %s: version must be positive", entry.Name())
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %s: %v", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down scripts", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// New создает Migrator для сервиса с миграциями из каталога dir в fsys
+func New(db *sql.DB, service string, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := Load(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no migrations found for %s", service)
+	}
+	return &Migrator{db: db, service: service, migrations: migrations}, nil
+}
+
+// Latest возвращает последнюю версию схемы, известную этой сборке сервиса
+func (m *Migrator) Latest() int {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version возвращает последнюю примененную версию схемы, 0 для пустой базы
+func (m *Migrator) Version() (int, error) {
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return 0, err
+	}
+	return maxVersion(applied), nil
+}
+
+// Check проверяет, что схема базы данных совпадает с версией сервиса
+func (m *Migrator) Check() error {
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return err
+	}
+
+	version := maxVersion(applied)
+	if version > m.Latest() {
+		return fmt.Errorf("%w: %s schema is at version %d, this binary knows up to %d", ErrSchemaTooNew, m.service, version, m.Latest())
+	}
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			return fmt.Errorf("%w: %s migration %04d_%s is not applied, run migrate up", ErrPendingMigrations, m.service, migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
+
+// Status возвращает все известные миграции с отметкой о применении
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up применяет все неприменённые миграции по возрастанию версии, каждую в своей транзакции
+func (m *Migrator) Up() ([]Migration, error) {
+	var done []Migration
+	err := m.locked(func(conn *sql.Conn) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if version := maxVersion(applied); version > m.Latest() {
+			return fmt.Errorf("%w: %s schema is at version %d, this binary knows up to %d", ErrSchemaTooNew, m.service, version, m.Latest())
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			err := m.apply(conn, migration.Up, func(tx *sql.Tx) error {
+				_, err := tx.Exec("INSERT INTO schema_migrations (service, version, name) VALUES ($1, $2, $3)", m.service, migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("could not apply migration %04d_%s: %v", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down откатывает steps последних примененных миграций, начиная с самой новой
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(func(conn *sql.Conn) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if version := maxVersion(applied); version > m.Latest() {
+			return fmt.Errorf("%w: %s schema is at version %d, roll it back with the binary that applied it", ErrSchemaTooNew, m.service, version)
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			err := m.apply(conn, migration.Down, func(tx *sql.Tx) error {
+				_, err := tx.Exec("DELETE FROM schema_migrations WHERE service = $1 AND version = $2", m.service, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("could not roll back migration %04d_%s: %v", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// queryer общий интерфейс *sql.DB и *sql.Conn для чтения schema_migrations
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// applied возвращает примененные версии сервиса со временем применения.
+// Пока schema_migrations не создана, ни одна версия не считается примененной.
+func (m *Migrator) applied(q queryer) (map[int]time.Time, error) {
+	ctx := context.Background()
+	applied := make(map[int]time.Time)
+
+	var exists bool
+	err := q.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("could not check schema_migrations: %v", err)
+	}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations WHERE service = $1", m.service)
+	if err != nil {
+		return nil, fmt.Errorf("could not read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("could not read schema_migrations: %v", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// apply выполняет скрипт миграции и запись в schema_migrations в одной транзакции
+func (m *Migrator) apply(conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockKey ключ advisory lock, общий для всех сервисов: они создают одну таблицу
+// schema_migrations и не должны делать это одновременно
+const lockKey = "schema_migrations"
+
+// locked выполняет fn под advisory lock, чтобы несколько экземпляров,
+// стартующих одновременно, не применяли миграции параллельно
+func (m *Migrator) locked(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get database connection: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", lockKey); err != nil {
+		return fmt.Errorf("could not lock migrations: %v", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", lockKey)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			service VARCHAR(100) NOT NULL,
+			version INT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (service, version)
+		)`)
+	if err != nil {
+		return fmt.Errorf("could not create schema_migrations: %v", err)
+	}
+
+	return fn(conn)
+}
+
+// maxVersion возвращает наибольшую примененную версию
+func maxVersion(applied map[int]time.Time) int {
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version
+}
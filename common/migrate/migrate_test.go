@@ -0,0 +1,232 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func TestLoadOrdersByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0010_tenth.up.sql":    {Data: []byte("up 10")},
+		"migrations/0010_tenth.down.sql":  {Data: []byte("down 10")},
+		"migrations/0002_second.up.sql":   {Data: []byte("up 2")},
+		"migrations/0002_second.down.sql": {Data: []byte("down 2")},
+		"migrations/0001_first.down.sql":  {Data: []byte("down 1")},
+		"migrations/0001_first.up.sql":    {Data: []byte("up 1")},
+	}
+	migrations, err := Load(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, m := range migrations {
+		got = append(got, fmt.Sprintf("%d_%s:%s/%s", m.Version, m.Name, m.Up, m.Down))
+	}
+	want := "1_first:up 1/down 1,2_second:up 2/down 2,10_tenth:up 10/down 10"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("Load = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestLoadRejectsInvalidMigrations(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+	}{
+		{"missing down", []string{"0001_init.up.sql"}},
+		{"missing up", []string{"0001_init.down.sql"}},
+		{"unexpected file", []string{"0001_init.up.sql", "0001_init.down.sql", "README.md"}},
+		{"zero version", []string{"0000_init.up.sql", "0000_init.down.sql"}},
+		{"two names", []string{"0001_init.up.sql", "0001_init.down.sql", "0001_other.up.sql", "0001_other.down.sql"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, file := range tt.files {
+				fsys["migrations/"+file] = &fstest.MapFile{Data: []byte("SELECT 1")}
+			}
+			if _, err := Load(fsys, "migrations"); err == nil {
+				t.Fatalf("Load accepted %v", tt.files)
+			}
+		})
+	}
+}
+
+// testMigrations миграции, каждая из которых опирается на предыдущую,
+// поэтому применить их можно только по порядку
+var testMigrations = []struct{ name, up, down string }{
+	{"create", "CREATE TABLE %s (id INT PRIMARY KEY)", "DROP TABLE %s"},
+	{"name", "ALTER TABLE %s ADD COLUMN name TEXT", "ALTER TABLE %s DROP COLUMN name"},
+	{"seed", "INSERT INTO %s (id, name) VALUES (1, 'seed')", "DELETE FROM %s WHERE id = 1"},
+}
+
+// testMigrator подключается к PostgreSQL из TEST_DATABASE_URL и возвращает
+// конструктор Migrator, знающего первые latest миграций из testMigrations.
+// Миграции работают с уникальной для теста таблицей, которая вместе с
+// записями schema_migrations теста удаляется после него.
+func testMigrator(t *testing.T) (*sql.DB, string, func(latest int) *Migrator) {
+	t.Helper()
+	connStr := os.Getenv("TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	table := service + "_items"
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS " + table)
+		db.Exec("DELETE FROM schema_migrations WHERE service = $1", service)
+		db.Close()
+	})
+
+	newMigrator := func(latest int) *Migrator {
+		t.Helper()
+		fsys := fstest.MapFS{}
+		for i, migration := range testMigrations[:latest] {
+			base := fmt.Sprintf("m/%04d_%s", i+1, migration.name)
+			fsys[base+".up.sql"] = &fstest.MapFile{Data: []byte(fmt.Sprintf(migration.up, table))}
+			fsys[base+".down.sql"] = &fstest.MapFile{Data: []byte(fmt.Sprintf(migration.down, table))}
+		}
+		m, err := New(db, service, fsys, "m")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	return db, table, newMigrator
+}
+
+func TestUpAppliesInOrderOnce(t *testing.T) {
+	db, table, newMigrator := testMigrator(t)
+	m := newMigrator(3)
+
+	if err := m.Check(); !errors.Is(err, ErrPendingMigrations) {
+		t.Fatalf("Check on empty schema = %v, want ErrPendingMigrations", err)
+	}
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 3 || applied[0].Version != 1 || applied[1].Version != 2 || applied[2].Version != 3 {
+		t.Fatalf("Up applied %+v, want versions 1, 2, 3", applied)
+	}
+	if version, err := m.Version(); err != nil || version != 3 {
+		t.Fatalf("Version = %d, %v; want 3", version, err)
+	}
+	if err := m.Check(); err != nil {
+		t.Fatalf("Check after Up = %v", err)
+	}
+
+	// Повторный запуск ничего не применяет
+	applied, err = m.Up()
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("second Up = %+v, %v; want nothing applied", applied, err)
+	}
+	var rows int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&rows); err != nil || rows != 1 {
+		t.Fatalf("seed rows = %d, %v; want 1", rows, err)
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Fatalf("migration %d is not marked applied", status.Version)
+		}
+	}
+}
+
+func TestUpContinuesFromAppliedVersion(t *testing.T) {
+	_, _, newMigrator := testMigrator(t)
+
+	if applied, err := newMigrator(1).Up(); err != nil || len(applied) != 1 {
+		t.Fatalf("Up with one migration = %+v, %v", applied, err)
+	}
+
+	// Новая сборка применяет только недостающие миграции
+	applied, err := newMigrator(3).Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || applied[0].Version != 2 || applied[1].Version != 3 {
+		t.Fatalf("Up applied %+v, want versions 2 and 3", applied)
+	}
+
+	// Старая сборка не запускается на более новой схеме
+	if err := newMigrator(1).Check(); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("Check with an older binary = %v, want ErrSchemaTooNew", err)
+	}
+	if _, err := newMigrator(2).Up(); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("Up with an older binary = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestDownRollsBackNewestFirst(t *testing.T) {
+	_, _, newMigrator := testMigrator(t)
+	m := newMigrator(3)
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	rolledBack, err := m.Down(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rolledBack) != 2 || rolledBack[0].Version != 3 || rolledBack[1].Version != 2 {
+		t.Fatalf("Down rolled back %+v, want versions 3 and 2", rolledBack)
+	}
+	if version, err := m.Version(); err != nil || version != 1 {
+		t.Fatalf("Version after Down = %d, %v; want 1", version, err)
+	}
+
+	// После отката миграции применяются снова
+	if applied, err := m.Up(); err != nil || len(applied) != 2 {
+		t.Fatalf("Up after Down = %+v, %v", applied, err)
+	}
+}
+
+func TestConcurrentUpAppliesOnce(t *testing.T) {
+	_, _, newMigrator := testMigrator(t)
+
+	// Экземпляры сервиса стартуют одновременно, advisory lock пропускает их по одному
+	var wg sync.WaitGroup
+	applied := make([]int, 4)
+	errs := make([]error, 4)
+	for i := range applied {
+		m := newMigrator(3)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, err := m.Up()
+			applied[i], errs[i] = len(done), err
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range applied {
+		if errs[i] != nil {
+			t.Fatalf("Up %d: %v", i, errs[i])
+		}
+		total += applied[i]
+	}
+	if total != 3 {
+		t.Fatalf("concurrent Up applied %d migrations in total, want 3", total)
+	}
+}
@@ -0,0 +1,176 @@
+// Package money описывает точное представление денежных сумм, общее для всех сервисов.
+// Суммы хранятся как целое число минимальных единиц валюты, в JSON и Kafka
+// передаются десятичным числом, а в Postgres хранятся в колонках NUMERIC.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currency код валюты, в которой ведутся все счета
+const Currency = "RUB"
+
+// Scale количество знаков после запятой в сумме Currency
+const Scale = 2
+
+// minorPerUnit количество минимальных единиц в одной единице валюты
+const minorPerUnit = 100
+
+var (
+	// ErrInvalidAmount возвращается для строки, которая не является десятичной суммой
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrTooPrecise возвращается для суммы с большим числом знаков после запятой, чем допускает валюта
+	ErrTooPrecise = fmt.Errorf("amount has more than %d decimal places", Scale)
+	// ErrUnsupportedCurrency возвращается для валюты, отличной от Currency
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+)
+
+// Amount денежная сумма в минимальных единицах Currency (копейках)
+type Amount int64
+
+// FromMinor создает сумму из количества минимальных единиц
+func FromMinor(minor int64) Amount {
+	return Amount(minor)
+}
+
+// Minor возвращает сумму в минимальных единицах
+func (a Amount) Minor() int64 {
+	return int64(a)
+}
+
+// Float64 возвращает сумму в единицах валюты. Результат приближенный,
+// он годится для метрик, но не для расчетов.
+func (a Amount) Float64() float64 {
+	return float64(a) / minorPerUnit
+}
+
+// IsPositive сообщает, что сумма больше нуля
+func (a Amount) IsPositive() bool {
+	return a > 0
+}
+
+// Parse разбирает десятичную запись суммы, например "10", "-0.5" или "1234.56".
+// Экспоненциальная запись отклоняется с ErrInvalidAmount, а значащие знаки после запятой
+// сверх Scale — с ErrTooPrecise: сумма не округляется молча. Parse вызывается и из
+// UnmarshalJSON, поэтому тело запроса с такой суммой не разбирается, и обработчики
+// отвечают на него 400 еще до вызова сервиса.
+func Parse(s string) (Amount, error) {
+	digits := s
+	negative := false
+	if strings.HasPrefix(digits, "-") {
+		negative = true
+		digits = digits[1:]
+	}
+
+	whole, fraction, hasPoint := strings.Cut(digits, ".")
+	if whole == "" || (hasPoint && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(fraction) > Scale {
+		if strings.Trim(fraction[Scale:], "0") != "" {
+			return 0, fmt.Errorf("%w: %q", ErrTooPrecise, s)
+		}
+		fraction = fraction[:Scale]
+	}
+	fraction += strings.Repeat("0", Scale-len(fraction))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > (math.MaxInt64-minorPerUnit)/minorPerUnit {
+		return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, s)
+	}
+	cents, _ := strconv.ParseInt(fraction, 10, 64)
+
+	minor := units*minorPerUnit + cents
+	if negative {
+		minor = -minor
+	}
+	return Amount(minor), nil
+}
+
+// String возвращает сумму с Scale знаками после запятой, например "10.50"
+func (a Amount) String() string {
+	minor := int64(a)
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+	}
+	abs := uint64(minor)
+	if minor < 0 {
+		abs = uint64(-(minor + 1)) + 1
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/minorPerUnit, abs%minorPerUnit)
+}
+
+// MarshalJSON кодирует сумму JSON-числом без потери точности
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON принимает сумму JSON-числом или строкой
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Value передает сумму в Postgres десятичной строкой для колонок NUMERIC
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan читает сумму из колонки NUMERIC
+func (a *Amount) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case int64:
+		*a = Amount(v * minorPerUnit)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// ValidateCurrency проверяет код валюты из запроса или сообщения.
+// Пустой код означает Currency.
+func ValidateCurrency(code string) error {
+	if code != "" && code != Currency {
+		return fmt.Errorf("%w: %q", ErrUnsupportedCurrency, code)
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
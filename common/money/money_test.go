@@ -0,0 +1,187 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Amount
+		wantErr error
+	}{
+		{"0", 0, nil},
+		{"10", 1000, nil},
+		{"10.5", 1050, nil},
+		{"1234.56", 123456, nil},
+		{"0.01", 1, nil},
+		{"-0.5", -50, nil},
+		{"-12.34", -1234, nil},
+		// Нули после второго знака не меняют сумму
+		{"1.230", 123, nil},
+		{"1.2300000", 123, nil},
+		{"92233720368547757", 9223372036854775700, nil},
+
+		{"1.001", 0, ErrTooPrecise},
+		{"0.005", 0, ErrTooPrecise},
+		{"-1.999", 0, ErrTooPrecise},
+
+		{"", 0, ErrInvalidAmount},
+		{"-", 0, ErrInvalidAmount},
+		{".", 0, ErrInvalidAmount},
+		{"1.", 0, ErrInvalidAmount},
+		{".5", 0, ErrInvalidAmount},
+		{"+1", 0, ErrInvalidAmount},
+		{"--1", 0, ErrInvalidAmount},
+		{"1e3", 0, ErrInvalidAmount},
+		{"1,5", 0, ErrInvalidAmount},
+		{" 1", 0, ErrInvalidAmount},
+		{"1.2.3", 0, ErrInvalidAmount},
+		{"ten", 0, ErrInvalidAmount},
+		{"92233720368547758", 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Parse(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		want   string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1050, "10.50"},
+		{123456, "1234.56"},
+		{-5, "-0.05"},
+		{-1234, "-12.34"},
+		{math.MaxInt64, "92233720368547758.07"},
+		{math.MinInt64, "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.amount.String(); got != tt.want {
+				t.Fatalf("Amount(%d).String() = %q, want %q", int64(tt.amount), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFloat64(t *testing.T) {
+	for amount, want := range map[Amount]float64{0: 0, 1050: 10.5, -1: -0.01} {
+		if got := amount.Float64(); got != want {
+			t.Fatalf("Amount(%d).Float64() = %v, want %v", int64(amount), got, want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Amount
+		wantErr error
+	}{
+		{"number", `10.5`, 1050, nil},
+		{"integer", `10`, 1000, nil},
+		{"negative", `-3.25`, -325, nil},
+		{"string", `"10.50"`, 1050, nil},
+		{"negative string", `"-0.01"`, -1, nil},
+		{"trailing zeros", `1.500`, 150, nil},
+		{"too precise number", `1.001`, 0, ErrTooPrecise},
+		{"too precise string", `"1.001"`, 0, ErrTooPrecise},
+		{"exponent", `1e2`, 0, ErrInvalidAmount},
+		{"bool", `true`, 0, ErrInvalidAmount},
+		{"empty string", `""`, 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Amount Amount `json:"amount"`
+			}
+			err := json.Unmarshal([]byte(`{"amount":`+tt.data+`}`), &got)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Unmarshal(%s) error = %v, want %v", tt.data, err, tt.wantErr)
+			}
+			if got.Amount != tt.want {
+				t.Fatalf("Unmarshal(%s) = %d, want %d", tt.data, got.Amount, tt.want)
+			}
+		})
+	}
+
+	// null оставляет сумму без изменений
+	amount := Amount(700)
+	if err := json.Unmarshal([]byte(`null`), &amount); err != nil || amount != 700 {
+		t.Fatalf("Unmarshal(null) = %d, %v; want the amount unchanged", amount, err)
+	}
+
+	// Сумма кодируется числом с двумя знаками и читается обратно без потерь
+	data, err := json.Marshal(map[string]Amount{"amount": -1050})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":-10.50}` {
+		t.Fatalf("Marshal = %s, want {\"amount\":-10.50}", data)
+	}
+	var decoded map[string]Amount
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded["amount"] != -1050 {
+		t.Fatalf("round trip = %v, %v; want -1050", decoded, err)
+	}
+}
+
+func TestValueScan(t *testing.T) {
+	value, err := Amount(1050).Value()
+	if err != nil || value != "10.50" {
+		t.Fatalf("Value() = %v, %v; want \"10.50\"", value, err)
+	}
+
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Amount
+		wantErr bool
+	}{
+		{"numeric bytes", []byte("12.30"), 1230, false},
+		{"numeric string", "12.3", 1230, false},
+		{"negative numeric", []byte("-0.07"), -7, false},
+		{"integer", int64(5), 500, false},
+		{"too precise", "1.005", 0, true},
+		{"float", 1.5, 0, true},
+		{"null", nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Amount
+			err := got.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan(%v) error = %v, want error %v", tt.src, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Scan(%v) = %d, want %d", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCurrency(t *testing.T) {
+	for _, code := range []string{"", Currency} {
+		if err := ValidateCurrency(code); err != nil {
+			t.Fatalf("ValidateCurrency(%q) = %v", code, err)
+		}
+	}
+	if err := ValidateCurrency("USD"); !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Fatalf("ValidateCurrency(USD) = %v, want ErrUnsupportedCurrency", err)
+	}
+}
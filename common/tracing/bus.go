@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"common/bus"
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"maps"
+)
+
+// Publisher добавляет в заголовки каждого сообщения контекст трассировки,
+// в которой оно опубликовано
+func Publisher(publisher bus.Publisher) bus.Publisher {
+	return tracingPublisher{publisher: publisher}
+}
+
+type tracingPublisher struct {
+	publisher bus.Publisher
+}
+
+// Publish публикует сообщения в спане публикации, дочерние спаны обработки начнутся от него
+func (p tracingPublisher) Publish(ctx context.Context, msgs ...bus.Message) error {
+	if len(msgs) == 0 {
+		return p.publisher.Publish(ctx, msgs...)
+	}
+	ctx, span := StartPublish(ctx, msgs[0].Topic, len(msgs))
+
+	traced := make([]bus.Message, len(msgs))
+	for i, msg := range msgs {
+		// Заголовки вызывающего не меняются: сообщение могут опубликовать еще раз в другой трассировке
+		headers := maps.Clone(msg.Headers)
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		maps.Copy(headers, Inject(ctx))
+		msg.Headers = headers
+		traced[i] = msg
+	}
+
+	err := p.publisher.Publish(ctx, traced...)
+	End(span, err)
+	return err
+}
+
+// StartPublish начинает спан публикации count сообщений в topic. Publisher начинает
+// его сам; отдельно он нужен тем, кто публикует в одной пачке сообщения разных трассировок.
+func StartPublish(ctx context.Context, topic string, count int) (context.Context, trace.Span) {
+	return Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", topic),
+			attribute.Int("messaging.batch.message_count", count),
+		),
+	)
+}
+
+// Close закрывает исходный publisher
+func (p tracingPublisher) Close() error {
+	return p.publisher.Close()
+}
+
+// Subscriber продолжает трассировку из заголовков сообщения: обработка
+// каждого сообщения, вместе с повторами, становится спаном этой трассировки
+func Subscriber(subscriber bus.Subscriber) bus.Subscriber {
+	return tracingSubscriber{subscriber: subscriber}
+}
+
+type tracingSubscriber struct {
+	subscriber bus.Subscriber
+}
+
+// Subscribe передает сообщения топика в handle, каждое в своем спане
+func (s tracingSubscriber) Subscribe(ctx context.Context, topic string, handle bus.Handler) error {
+	return s.subscriber.Subscribe(ctx, topic, func(ctx context.Context, msg bus.Message) error {
+		ctx, span := Start(Extract(ctx, msg.Headers), topic+" process",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination.name", topic),
+			),
+		)
+		err := handle(ctx, msg)
+		End(span, err)
+		return err
+	})
+}
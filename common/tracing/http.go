@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Handler начинает серверный спан для каждого входящего запроса. Если в запросе есть
+// заголовок traceparent, спан продолжает трассировку вызывающего сервиса.
+func Handler(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.request", otelhttp.WithPropagators(propagator))
+}
+
+// Middleware называет серверный спан по шаблону маршрута mux, например GET /order/{user_id}.
+// Подключается через mux.Router.Use к роутеру, обернутому в Handler.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + template)
+				span.SetAttributes(attribute.String("http.route", template))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Transport начинает клиентский спан для каждого исходящего запроса
+// и передает контекст трассировки в заголовке traceparent
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base, otelhttp.WithPropagators(propagator))
+}
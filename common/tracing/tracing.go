@@ -0,0 +1,87 @@
+// Package tracing распределенные трассировки OpenTelemetry. Контекст трассировки
+// передается в формате W3C Trace Context: в HTTP-заголовке traceparent, в заголовках
+// сообщений Kafka и в записях outbox, поэтому заказ от запроса к gateway до результата
+// оплаты виден одной трассировкой.
+package tracing
+
+import (
+	"common/configutil"
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation имя, под которым спаны этого пакета попадают в трассировку
+const instrumentation = "common/tracing"
+
+// propagator записывает и читает контекст трассировки в формате W3C
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Setup настраивает экспорт трассировок сервиса service и возвращает функцию,
+// которая при остановке отправляет накопленные спаны. Без экспортера (none)
+// спаны не записываются, но контекст трассировки по-прежнему передается дальше.
+func Setup(ctx context.Context, service string, cfg configutil.Tracing) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s trace exporter: %v", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", service)))
+	if err != nil {
+		return nil, fmt.Errorf("could not describe service %s for tracing: %v", service, err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Inject возвращает контекст трассировки ctx в виде заголовков traceparent и tracestate
+// или nil, если ctx не относится ни к какой трассировке
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Extract возвращает ctx, продолжающий трассировку из заголовков, записанных Inject
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier(headers))
+}
+
+// Start начинает спан name, дочерний по отношению к спану в ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, opts...)
+}
+
+// End завершает спан и отмечает в нем ошибку err, если она есть
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"common/bus"
+	"context"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// recordSpans записывает спаны, завершенные в тесте
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}
+
+func TestMessagesContinueTrace(t *testing.T) {
+	recorder := recordSpans(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	b := bus.NewMemoryBus()
+	publisher := Publisher(b)
+	handled := make(chan trace.SpanContext, 1)
+	go Subscriber(b.Subscriber("group")).Subscribe(ctx, "orders", func(ctx context.Context, msg bus.Message) error {
+		handled <- trace.SpanContextFromContext(ctx)
+		return nil
+	})
+
+	requestCtx, request := Start(ctx, "request")
+	headers := map[string]string{"origin": "test"}
+	if err := publisher.Publish(requestCtx, bus.Message{Topic: "orders", Value: []byte("{}"), Headers: headers}); err != nil {
+		t.Fatal(err)
+	}
+	request.End()
+	if err := b.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer := <-handled
+	if consumer.TraceID() != request.SpanContext().TraceID() {
+		t.Fatalf("consumer trace %s, want %s", consumer.TraceID(), request.SpanContext().TraceID())
+	}
+	if len(headers) != 1 {
+		t.Fatalf("publisher modified the caller's headers: %v", headers)
+	}
+	published := b.Messages("orders")
+	if len(published) != 1 || published[0].Headers["traceparent"] == "" || published[0].Headers["origin"] != "test" {
+		t.Fatalf("published = %+v, want original headers and traceparent", published)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	publish, process := spans["orders publish"], spans["orders process"]
+	if publish == nil || process == nil {
+		t.Fatalf("recorded spans %v, want publish and process spans", spans)
+	}
+	if publish.Parent().SpanID() != request.SpanContext().SpanID() || process.Parent().SpanID() != publish.SpanContext().SpanID() {
+		t.Fatal("process span is not a child of the publish span within the request trace")
+	}
+}
+
+func TestHTTPRequestsContinueTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	var server trace.SpanContext
+	r.HandleFunc("/order/{user_id}", func(w http.ResponseWriter, r *http.Request) {
+		server = trace.SpanContextFromContext(r.Context())
+	}).Methods("GET")
+	upstream := httptest.NewServer(Handler(r))
+	defer upstream.Close()
+
+	ctx, request := Start(context.Background(), "request")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+"/order/alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	request.End()
+
+	if server.TraceID() != request.SpanContext().TraceID() {
+		t.Fatalf("server trace %s, want %s", server.TraceID(), request.SpanContext().TraceID())
+	}
+	named := false
+	for _, span := range recorder.Ended() {
+		if span.Name() == "GET /order/{user_id}" && span.SpanKind() == trace.SpanKindServer {
+			named = true
+		}
+	}
+	if !named {
+		t.Fatal("server span is not named after the route")
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	if headers := Inject(context.Background()); headers != nil {
+		t.Fatalf("Inject without a trace = %v, want nil", headers)
+	}
+
+	recordSpans(t)
+	ctx, span := Start(context.Background(), "request")
+	defer span.End()
+	restored := trace.SpanContextFromContext(Extract(context.Background(), Inject(ctx)))
+	if !restored.IsRemote() || restored.TraceID() != span.SpanContext().TraceID() || restored.SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("restored span context %+v, want %+v", restored, span.SpanContext())
+	}
+}
@@ -0,0 +1,628 @@
+// Package e2e сквозные тесты order-service и payment-service: оба сервиса работают
+// в одном процессе поверх хранилищ в памяти и общей шины bus.MemoryBus, которая
+// повторно доставляет каждое сообщение, как Kafka после падения подписчика.
+package e2e
+
+import (
+	"bytes"
+	"common/bus"
+	"common/configutil"
+	"common/deadletter"
+	"common/events"
+	"common/money"
+	"common/tracing"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	orderapp "order-service/app"
+	paymentapp "payment-service/app"
+	"strings"
+	"testing"
+	"time"
+)
+
+const defaultHoldTTL = time.Hour
+
+// env два сервиса, связанные шиной в памяти
+type env struct {
+	t       *testing.T
+	bus     *bus.MemoryBus
+	orders  *orderapp.App
+	payment *paymentapp.App
+	router  *mux.Router
+}
+
+// newEnv запускает оба сервиса. Холды по заказам живут holdTTL.
+func newEnv(t *testing.T, holdTTL time.Duration) *env {
+	t.Helper()
+
+	b := bus.NewMemoryBus()
+	b.Redeliveries = 1
+	topics := configutil.DefaultTopics()
+
+	e := &env{
+		t:       t,
+		bus:     b,
+		orders:  orderapp.NewInMemory(b, b.Subscriber("order-service"), orderapp.Config{Topics: topics, Retry: retryPolicy("order-service")}),
+		payment: paymentapp.NewInMemory(b, b.Subscriber("payment-service"), paymentapp.Config{Topics: topics, Retry: retryPolicy("payment-service"), HoldTTL: holdTTL}),
+		router:  mux.NewRouter(),
+	}
+	e.orders.Routes(e.router)
+	e.payment.Routes(e.router)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		e.orders.Wait()
+		e.payment.Wait()
+		b.Close()
+	})
+	e.orders.Start(ctx)
+	e.payment.Start(ctx)
+	return e
+}
+
+// retryPolicy быстрые повторы и dead-letter топик группы group
+func retryPolicy(group string) bus.RetryPolicy {
+	return bus.RetryPolicy{
+		MaxAttempts:     3,
+		InitialBackoff:  time.Millisecond,
+		MaxBackoff:      time.Millisecond,
+		DeadLetterTopic: deadLetterTopic(group),
+	}
+}
+
+// deadLetterTopic dead-letter топик группы, как в configutil.DefaultKafka
+func deadLetterTopic(group string) string {
+	return group + ".dlq"
+}
+
+// do выполняет HTTP-запрос к сервисам и разбирает ответ в out
+func (e *env) do(method, path string, body interface{}, wantStatus int, out interface{}) {
+	e.t.Helper()
+	e.doAs("", method, path, body, wantStatus, out)
+}
+
+// doAs выполняет запрос к admin API от имени администратора actor
+func (e *env) doAs(actor, method, path string, body interface{}, wantStatus int, out interface{}) {
+	e.t.Helper()
+
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			e.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &reqBody)
+	if actor != "" {
+		req.Header.Set(deadletter.ActorHeader, actor)
+	}
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	if rec.Code != wantStatus {
+		e.t.Fatalf("%s %s: status %d, want %d: %s", method, path, rec.Code, wantStatus, rec.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			e.t.Fatalf("%s %s: could not decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+}
+
+// settle отправляет outbox order-service и ждет, пока оба сервиса обработают все события
+func (e *env) settle() {
+	e.t.Helper()
+
+	if _, err := e.orders.RelayOutbox(context.Background()); err != nil {
+		e.t.Fatal(err)
+	}
+	e.wait()
+}
+
+// wait ждет, пока оба сервиса обработают все опубликованные события, не отправляя outbox
+func (e *env) wait() {
+	e.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.bus.WaitIdle(ctx); err != nil {
+		e.t.Fatalf("events were not processed: %v", err)
+	}
+}
+
+// openAccount создает счет пользователя с начальным балансом
+func (e *env) openAccount(userId string, amount money.Amount) {
+	e.t.Helper()
+	e.do("POST", "/payment/"+userId, nil, http.StatusCreated, nil)
+	e.do("PUT", "/payment/"+userId+"/deposit", map[string]interface{}{"amount": amount}, http.StatusOK, nil)
+}
+
+// createOrder создает заказ и возвращает его ID
+func (e *env) createOrder(userId string, amount money.Amount) string {
+	e.t.Helper()
+	var orderId string
+	e.do("POST", "/order/"+userId, map[string]interface{}{"amount": amount}, http.StatusOK, &orderId)
+	return orderId
+}
+
+// expectStatus проверяет статус заказа
+func (e *env) expectStatus(userId, orderId, want string) {
+	e.t.Helper()
+	var order struct {
+		Status string `json:"status"`
+	}
+	e.do("GET", fmt.Sprintf("/order/%s/%s", userId, orderId), nil, http.StatusOK, &order)
+	if order.Status != want {
+		e.t.Fatalf("order %s status = %s, want %s", orderId, order.Status, want)
+	}
+}
+
+// expectBalance проверяет баланс по журналу и сумму холдов
+func (e *env) expectBalance(userId string, ledger, held money.Amount) {
+	e.t.Helper()
+	var balance struct {
+		Ledger    money.Amount `json:"ledger"`
+		Held      money.Amount `json:"held"`
+		Available money.Amount `json:"available"`
+	}
+	e.do("GET", "/payment/"+userId, nil, http.StatusOK, &balance)
+	if balance.Ledger != ledger || balance.Held != held || balance.Available != ledger-held {
+		e.t.Fatalf("balance of %s = %+v, want ledger %s, held %s", userId, balance, ledger, held)
+	}
+}
+
+func rub(rubles int64) money.Amount {
+	return money.FromMinor(rubles * 100)
+}
+
+func TestOrderPaidAndFulfilled(t *testing.T) {
+	e := newEnv(t, defaultHoldTTL)
+	e.openAccount("alice", rub(100))
+
+	orderId := e.createOrder("alice", rub(60))
+	e.expectStatus("alice", orderId, "created")
+	e.settle()
+
+	// Оплата резервирует сумму холдом, баланс по журналу не меняется
+	e.expectStatus("alice", orderId, "paid")
+	e.expectBalance("alice", rub(100), rub(60))
+
+	e.do("POST", fmt.Sprintf("/order/alice/%s/fulfill", orderId), nil, http.StatusOK, nil)
+	e.settle()
+
+	e.expectStatus("alice", orderId, "fulfilled")
+	e.expectBalance("alice", rub(40), 0)
+}
+
+func TestOrderPaymentFailed(t *testing.T) {
+	e := newEnv(t, defaultHoldTTL)
+	e.openAccount("bob", rub(10))
+
+	orderId := e.createOrder("bob", rub(60))
+	e.settle()
+
+	e.expectStatus("bob", orderId, "payment_failed")
+	e.expectBalance("bob", rub(10), 0)
+
+	// Заказ пользователя без счета тоже получает отказ
+	orderId = e.createOrder("carol", rub(1))
+	e.settle()
+	e.expectStatus("carol", orderId, "payment_failed")
+}
+
+func TestPaidOrderCancelledAndRefunded(t *testing.T) {
+	e := newEnv(t, defaultHoldTTL)
+	e.openAccount("dave", rub(100))
+
+	orderId := e.createOrder("dave", rub(30))
+	e.settle()
+	e.expectStatus("dave", orderId, "paid")
+
+	e.do("POST", fmt.Sprintf("/order/dave/%s/cancel", orderId), nil, http.StatusOK, nil)
+	e.expectStatus("dave", orderId, "refund_requested")
+	e.settle()
+
+	e.expectStatus("dave", orderId, "refunded")
+	e.expectBalance("dave", rub(100), 0)
+
+	// Команды и результаты по счету публикуются с ID пользователя в ключе и попадают в одну партицию
+	topics := configutil.DefaultTopics()
+	for _, topic := range []string{topics.PaymentTransactions, topics.PaymentRefunds, topics.PaymentResults} {
+		msgs := e.bus.Messages(topic)
+		if len(msgs) == 0 {
+			t.Fatalf("nothing published to %s", topic)
+		}
+		for _, msg := range msgs {
+			if string(msg.Key) != "dave" {
+				t.Fatalf("message in %s has key %q, want the user ID", topic, msg.Key)
+			}
+		}
+	}
+}
+
+func TestLateResultsForClosedOrdersAreIgnored(t *testing.T) {
+	e := newEnv(t, defaultHoldTTL)
+	e.openAccount("frank", rub(50))
+
+	// Отказ в оплате приходит, когда заказ уже отменен
+	declined := e.createOrder("frank", rub(80))
+	e.do("POST", fmt.Sprintf("/order/frank/%s/cancel", declined), nil, http.StatusOK, nil)
+	e.settle()
+	e.expectStatus("frank", declined, "cancelled")
+
+	// Оплата приходит после отмены и возвращается, затем ее доставляют еще раз
+	paid := e.createOrder("frank", rub(20))
+	e.do("POST", fmt.Sprintf("/order/frank/%s/cancel", paid), nil, http.StatusOK, nil)
+	e.settle()
+	e.settle()
+	e.expectStatus("frank", paid, "refunded")
+	e.expectBalance("frank", rub(50), 0)
+
+	topic := configutil.DefaultTopics().PaymentResults
+	for _, msg := range e.bus.Messages(topic) {
+		event, err := events.Decode(msg.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Type == events.PaymentSucceeded {
+			if err := e.bus.Publish(context.Background(), msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	e.settle()
+	e.expectStatus("frank", paid, "refunded")
+
+	dead, err := e.orders.DeadLetters().List(context.Background(), deadletter.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range dead {
+		t.Errorf("result for a closed order was dead-lettered: %s", msg.Reason)
+	}
+}
+
+func TestExpiredHoldCancelsOrder(t *testing.T) {
+	// Холд истекает сразу после оплаты
+	e := newEnv(t, time.Nanosecond)
+	e.openAccount("erin", rub(100))
+
+	orderId := e.createOrder("erin", rub(70))
+	e.settle()
+	e.expectStatus("erin", orderId, "paid")
+
+	if _, err := e.payment.ExpireHolds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	e.settle()
+
+	e.expectStatus("erin", orderId, "cancelled")
+	e.expectBalance("erin", rub(100), 0)
+
+	// Выполнить заказ после снятия холда уже нельзя
+	e.do("POST", fmt.Sprintf("/order/erin/%s/fulfill", orderId), nil, http.StatusConflict, nil)
+}
+
+func TestFailedCaptureIsVisible(t *testing.T) {
+	e := newEnv(t, time.Nanosecond)
+	e.openAccount("gina", rub(100))
+
+	orderId := e.createOrder("gina", rub(70))
+	e.settle()
+	e.do("POST", fmt.Sprintf("/order/gina/%s/fulfill", orderId), nil, http.StatusOK, nil)
+
+	// Холд истекает раньше, чем payment-service получает команду на списание
+	if _, err := e.payment.ExpireHolds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	e.settle()
+
+	e.expectStatus("gina", orderId, "capture_failed")
+	e.expectBalance("gina", rub(100), 0)
+}
+
+func TestInvalidMessagesAreQuarantined(t *testing.T) {
+	e := newEnv(t, defaultHoldTTL)
+	e.openAccount("frank", rub(100))
+	topics := configutil.DefaultTopics()
+
+	// Команда без конверта и результат будущей версии схемы не останавливают чтение топиков
+	err := e.bus.Publish(context.Background(),
+		bus.Message{Topic: topics.PaymentTransactions, Value: []byte(`{"transaction_id":"tx","amount":"a lot"}`)},
+		bus.Message{Topic: topics.PaymentResults, Value: []byte(`{"id":"e","type":"payment_succeeded","version":99,` +
+			`"occurred_at":"2024-01-02T03:04:05Z","correlation_id":"order","payload":{}}`)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orderId := e.createOrder("frank", rub(25))
+	e.settle()
+	e.expectStatus("frank", orderId, "paid")
+
+	for service, store := range map[string]deadletter.Store{"order-service": e.orders.DeadLetters(), "payment-service": e.payment.DeadLetters()} {
+		quarantined, err := store.List(context.Background(), deadletter.Filter{Kind: deadletter.KindQuarantined})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Повторная доставка может отложить то же сообщение еще раз
+		if len(quarantined) == 0 {
+			t.Fatalf("%s quarantined nothing", service)
+		}
+		for _, msg := range quarantined {
+			if msg.Kind != deadletter.KindQuarantined || msg.Reason == "" {
+				t.Fatalf("%s quarantined %+v", service, msg)
+			}
+		}
+	}
+}
+
+func TestFailingMessagesAreDeadLettered(t *testing.T) {
+	e := newEnv(t, defaultHoldTTL)
+	topics := configutil.DefaultTopics()
+
+	// Результат оплаты корректен, но заказа нет: обработка падает при каждой попытке
+	result := events.PaymentResult{TransactionID: "unknown", OrderID: "unknown", UserID: "grace", Amount: rub(5), Currency: money.Currency}
+	event, err := events.New(events.PaymentSucceeded, result.TransactionID, result.OrderID, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.bus.Publish(context.Background(), bus.Message{Topic: topics.PaymentResults, Value: body}); err != nil {
+		t.Fatal(err)
+	}
+	e.settle()
+
+	deadLetters := e.bus.Messages(deadLetterTopic("order-service"))
+	if len(deadLetters) == 0 {
+		t.Fatal("the failing payment result was not dead-lettered")
+	}
+	dead := deadLetters[0]
+	if !bytes.Equal(dead.Value, body) || dead.Headers[bus.HeaderOriginalTopic] != topics.PaymentResults ||
+		dead.Headers[bus.HeaderAttempts] != "3" || dead.Headers[bus.HeaderError] == "" {
+		t.Fatalf("dead letter = %+v", dead)
+	}
+
+	// order-service сохраняет сообщения из своего dead-letter топика для разбора
+	stored, err := e.orders.DeadLetters().List(context.Background(), deadletter.Filter{Kind: deadletter.KindDeadLettered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) == 0 || stored[0].Topic != topics.PaymentResults || stored[0].Attempts != 3 || !bytes.Equal(stored[0].Value, body) {
+		t.Fatalf("stored dead letters = %+v", stored)
+	}
+
+	// Топик продолжает читаться после сообщения, отправленного в dead-letter топик
+	e.openAccount("grace", rub(10))
+	orderId := e.createOrder("grace", rub(5))
+	e.settle()
+	e.expectStatus("grace", orderId, "paid")
+
+	// Заказа так и нет, администратор отбрасывает сообщение
+	path := fmt.Sprintf("/admin/dead-letters/%d", stored[0].ID)
+	e.doAs("admin", "POST", path+"/discard", map[string]string{}, http.StatusBadRequest, nil)
+	var discarded deadletter.MessageSummary
+	e.doAs("admin", "POST", path+"/discard", map[string]string{"reason": "order never existed"}, http.StatusOK, &discarded)
+	if discarded.Status != deadletter.StatusDiscarded {
+		t.Fatalf("discarded message = %+v", discarded)
+	}
+	e.doAs("admin", "POST", path+"/requeue", nil, http.StatusConflict, nil)
+}
+
+func TestQuarantinedMessageIsRequeuedByAdmin(t *testing.T) {
+	e := newEnv(t, defaultHoldTTL)
+	topics := configutil.DefaultTopics()
+
+	// Outbox не отправляется: заказ ждет результата оплаты
+	orderId := e.createOrder("heidi", rub(15))
+
+	// Результат оплаты опубликован по схеме, которую order-service еще не знает
+	result := events.PaymentResult{TransactionID: "tx-heidi", OrderID: orderId, UserID: "heidi", Amount: rub(15), Currency: money.Currency}
+	event, err := events.New(events.PaymentSucceeded, result.TransactionID, result.OrderID, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.Version = 2
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.bus.Publish(context.Background(), bus.Message{Topic: topics.PaymentResults, Key: []byte("heidi"), Value: body}); err != nil {
+		t.Fatal(err)
+	}
+	e.wait()
+	e.expectStatus("heidi", orderId, "created")
+
+	// Без имени администратора admin API не отвечает
+	e.do("GET", "/admin/dead-letters", nil, http.StatusBadRequest, nil)
+	var pending []deadletter.MessageSummary
+	e.doAs("admin", "GET", "/admin/dead-letters?status=pending&kind=quarantined", nil, http.StatusOK, &pending)
+	if len(pending) == 0 || pending[0].Topic != topics.PaymentResults {
+		t.Fatalf("pending dead letters = %+v", pending)
+	}
+	path := fmt.Sprintf("/admin/dead-letters/%d", pending[0].ID)
+
+	var details deadletter.MessageDetails
+	e.doAs("admin", "GET", path, nil, http.StatusOK, &details)
+	var original events.Envelope
+	if err := json.Unmarshal(details.Value, &original); err != nil || original.Version != 2 || original.CorrelationID != orderId {
+		t.Fatalf("dead letter value = %s: %v", details.Value, err)
+	}
+
+	// Администратор возвращает сообщение, исправив версию схемы
+	original.Version = 1
+	edited, err := json.Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requeued deadletter.MessageSummary
+	e.doAs("admin", "POST", path+"/requeue", deadletter.RequeueRequest{Reason: "schema version fixed", Value: edited}, http.StatusOK, &requeued)
+	if requeued.Status != deadletter.StatusRequeued || requeued.ResolvedAt == nil {
+		t.Fatalf("requeued message = %+v", requeued)
+	}
+	e.wait()
+	e.expectStatus("heidi", orderId, "paid")
+
+	// Журнал хранит, кто и как разбирал сообщение
+	e.doAs("auditor", "GET", path, nil, http.StatusOK, &details)
+	var actions []string
+	for _, entry := range details.History {
+		actions = append(actions, entry.Action+":"+entry.Actor)
+	}
+	requeue := details.History[1]
+	if strings.Join(actions, ",") != "viewed:admin,requeued:admin,viewed:auditor" ||
+		requeue.Reason != "schema version fixed" || !bytes.Equal(requeue.Value, edited) {
+		t.Fatalf("history = %+v", details.History)
+	}
+}
+
+func TestLedgerAdminRequiresActor(t *testing.T) {
+	e := newEnv(t, defaultHoldTTL)
+	e.openAccount("ivan", rub(100))
+	adjustment := map[string]interface{}{"amount": -rub(30), "reason": "chargeback"}
+
+	// Корректировки и сверка доступны только администратору и только по admin-пути
+	e.do("POST", "/admin/payment/ivan/adjustments", adjustment, http.StatusBadRequest, nil)
+	e.do("GET", "/admin/payment/ivan/audit", nil, http.StatusBadRequest, nil)
+	e.do("GET", "/admin/ledger/drift", nil, http.StatusBadRequest, nil)
+	e.doAs("admin", "POST", "/payment/ivan/adjustments", adjustment, http.StatusNotFound, nil)
+	e.expectBalance("ivan", rub(100), 0)
+
+	e.doAs("admin", "POST", "/admin/payment/ivan/adjustments", adjustment, http.StatusOK, nil)
+	e.expectBalance("ivan", rub(70), 0)
+	var audit struct {
+		Drift money.Amount `json:"drift"`
+	}
+	e.doAs("auditor", "GET", "/admin/payment/ivan/audit", nil, http.StatusOK, &audit)
+	if audit.Drift != 0 {
+		t.Fatalf("drift after adjustment = %s", audit.Drift)
+	}
+
+	// Проводка корректировки хранит, кто ее сделал
+	var page struct {
+		Transactions []struct {
+			Kind   string `json:"kind"`
+			Actor  string `json:"actor"`
+			Reason string `json:"description"`
+		} `json:"transactions"`
+	}
+	e.do("GET", "/payment/ivan/transactions?limit=1", nil, http.StatusOK, &page)
+	if len(page.Transactions) != 1 || page.Transactions[0].Kind != "adjustment" ||
+		page.Transactions[0].Actor != "admin" || page.Transactions[0].Reason != "chargeback" {
+		t.Fatalf("transactions = %+v, want the adjustment by admin", page.Transactions)
+	}
+}
+
+func TestConsumersReportReadiness(t *testing.T) {
+	e := newEnv(t, defaultHoldTTL)
+	ctx := context.Background()
+
+	if err := e.orders.CheckConsumers(ctx); err != nil {
+		t.Fatalf("order-service consumers: %v", err)
+	}
+	if err := e.payment.CheckConsumers(ctx); err != nil {
+		t.Fatalf("payment-service consumers: %v", err)
+	}
+
+	// Сервис, у которого подписчики еще не запущены, не готов
+	idle := orderapp.NewInMemory(e.bus, e.bus.Subscriber("idle"), orderapp.Config{Topics: configutil.DefaultTopics(), Retry: retryPolicy("idle")})
+	if err := idle.CheckConsumers(ctx); err == nil {
+		t.Fatal("consumers of a service that was not started are reported as running")
+	}
+}
+
+func TestBusinessMetrics(t *testing.T) {
+	e := newEnv(t, defaultHoldTTL)
+	names := []string{"orders_created_total", "orders_paid_total", "orders_payment_failed_total", "payment_deposited_rubles_total"}
+	before := metricValues(t, names...)
+
+	e.openAccount("dave", rub(100))
+	paid := e.createOrder("dave", rub(60))
+	failed := e.createOrder("dave", rub(100))
+	e.settle()
+	e.expectStatus("dave", paid, "paid")
+	e.expectStatus("dave", failed, "payment_failed")
+	// Повторная доставка результатов оплаты не учитывается второй раз
+	e.settle()
+
+	after := metricValues(t, names...)
+	for name, want := range map[string]float64{
+		"orders_created_total":           2,
+		"orders_paid_total":              1,
+		"orders_payment_failed_total":    1,
+		"payment_deposited_rubles_total": 100,
+	} {
+		if got := after[name] - before[name]; got != want {
+			t.Errorf("%s grew by %v, want %v", name, got, want)
+		}
+	}
+}
+
+// metricValues текущие значения счетчиков из реестра Prometheus по умолчанию
+func metricValues(t *testing.T, names ...string) map[string]float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64, len(names))
+	for _, family := range families {
+		for _, name := range names {
+			if family.GetName() == name && len(family.GetMetric()) == 1 {
+				values[name] = family.GetMetric()[0].GetCounter().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+func TestOrderFlowIsOneTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	e := newEnv(t, defaultHoldTTL)
+	e.openAccount("erin", rub(100))
+
+	// Запрос на создание заказа приходит от gateway в его трассировке
+	ctx, request := tracing.Start(context.Background(), "gateway request")
+	body, err := json.Marshal(map[string]interface{}{"amount": rub(60)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/order/erin", bytes.NewReader(body))
+	for name, value := range tracing.Inject(ctx) {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	tracing.Handler(e.router).ServeHTTP(rec, req)
+	request.End()
+	var orderId string
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &orderId) != nil {
+		t.Fatalf("create order: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Outbox отправляется позже отдельной задачей, но продолжает трассировку запроса
+	e.settle()
+	e.expectStatus("erin", orderId, "paid")
+
+	traced := make(map[string]bool)
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() == request.SpanContext().TraceID() {
+			traced[span.Name()] = true
+		}
+	}
+	for _, name := range []string{"payment_transactions publish", "payment_transactions process", "payment_results publish", "payment_results process"} {
+		if !traced[name] {
+			t.Errorf("span %q is not part of the request trace, got %v", name, traced)
+		}
+	}
+}
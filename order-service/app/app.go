@@ -0,0 +1,130 @@
+// Package app собирает order-service из хранилища заказов и шины сообщений.
+// Используется из main и из сквозных тестов, которым нужен сервис без Postgres и Kafka.
+package app
+
+import (
+	"common/bus"
+	"common/configutil"
+	"common/deadletter"
+	"common/health"
+	"common/tracing"
+	"context"
+	"github.com/gorilla/mux"
+	"log"
+	"order-service/internal/handler"
+	"order-service/internal/repository"
+	"order-service/internal/service"
+	"sync"
+)
+
+// Config настройки обмена сообщениями order-service
+type Config struct {
+	Topics configutil.Topics
+	// Retry повторы обработки результатов оплаты, после которых сообщение уходит в Retry.DeadLetterTopic
+	Retry bus.RetryPolicy
+}
+
+// App order-service: HTTP-обработчики, relay outbox и обработка результатов оплаты
+type App struct {
+	svc         *service.OrderService
+	relay       *service.OutboxRelay
+	handler     *handler.OrderHandler
+	admin       *deadletter.Handler
+	deadLetters deadletter.Store
+	subscriber  bus.Subscriber
+	cfg         Config
+	background  sync.WaitGroup
+	consumers   health.Workers
+}
+
+// New собирает сервис поверх store, публикующий команды через publisher
+// и читающий результаты оплаты через subscriber. Сообщения, которые не удалось
+// разобрать или обработать за cfg.Retry.MaxAttempts попыток, сохраняются в deadLetters.
+func New(store repository.OrderStore, deadLetters deadletter.Store, publisher bus.Publisher, subscriber bus.Subscriber, cfg Config) *App {
+	// Сообщения переносят контекст трассировки между сервисами.
+	// Relay продолжает трассировку каждой записи outbox сам и получает исходный publisher.
+	relay := service.NewOutboxRelay(store, publisher, cfg.Topics)
+	publisher, subscriber = tracing.Publisher(publisher), tracing.Subscriber(subscriber)
+	svc := service.NewOrderService(store, deadLetters, bus.WithRetry(subscriber, cfg.Retry, publisher), cfg.Topics)
+	return &App{
+		svc:         svc,
+		relay:       relay,
+		handler:     handler.NewOrderHandler(svc),
+		admin:       deadletter.NewHandler(deadletter.NewAdmin(deadLetters, publisher)),
+		deadLetters: deadLetters,
+		subscriber:  subscriber,
+		cfg:         cfg,
+	}
+}
+
+// NewInMemory собирает сервис с хранилищами в памяти
+func NewInMemory(publisher bus.Publisher, subscriber bus.Subscriber, cfg Config) *App {
+	return New(repository.NewMemoryOrderRepository(), deadletter.NewMemoryStore(), publisher, subscriber, cfg)
+}
+
+// Routes регистрирует маршруты API заказов
+func (app *App) Routes(r *mux.Router) {
+	h := app.handler
+	r.HandleFunc("/order/{user_id}", h.CreateOrder).Methods("POST")
+	r.HandleFunc("/orders/{user_id}", h.GetOrders).Methods("GET")
+	r.HandleFunc("/order/{user_id}/{order_id}", h.GetOrderStatus).Methods("GET")
+	r.HandleFunc("/order/{user_id}/{order_id}/history", h.GetOrderHistory).Methods("GET")
+	r.HandleFunc("/order/{user_id}/{order_id}/cancel", h.CancelOrder).Methods("POST")
+	r.HandleFunc("/order/{user_id}/{order_id}/fulfill", h.FulfillOrder).Methods("POST")
+
+	// Разбор отложенных сообщений, через api-gateway не публикуется
+	r.PathPrefix("/admin/dead-letters").Handler(app.admin)
+}
+
+// Start запускает фоновую отправку outbox, обработку результатов оплаты
+// и сохранение сообщений из dead-letter топика до отмены ctx
+func (app *App) Start(ctx context.Context) {
+	app.run(func() { app.relay.Run(ctx) })
+	app.consume("payment results consumer", func() error {
+		return app.svc.ConsumePaymentResults(ctx)
+	})
+	app.consume("dead letter collector", func() error {
+		return deadletter.Collect(ctx, app.subscriber, app.cfg.Retry.DeadLetterTopic, app.deadLetters)
+	})
+}
+
+// CheckConsumers проверка готовности: все подписчики запущены и работают
+func (app *App) CheckConsumers(ctx context.Context) error {
+	return app.consumers.Check(ctx)
+}
+
+// Wait ждет, пока фоновые задачи остановятся после отмены контекста Start.
+// Подписчики перед остановкой дообрабатывают начатые сообщения и фиксируют смещения.
+func (app *App) Wait() {
+	app.background.Wait()
+}
+
+// run запускает фоновую задачу, которую дожидается Wait
+func (app *App) run(task func()) {
+	app.background.Add(1)
+	go func() {
+		defer app.background.Done()
+		task()
+	}()
+}
+
+// consume запускает подписчика name в фоне и отмечает, пока он работает
+func (app *App) consume(name string, subscribe func() error) {
+	app.consumers.Started(name)
+	app.run(func() {
+		defer app.consumers.Stopped(name)
+		if err := subscribe(); err != nil {
+			log.Printf("%s stopped: %v", name, err)
+		}
+	})
+}
+
+// DeadLetters возвращает хранилище сообщений, отложенных без обработки
+func (app *App) DeadLetters() deadletter.Store {
+	return app.deadLetters
+}
+
+// RelayOutbox отправляет накопившиеся записи outbox, не дожидаясь очередного опроса
+func (app *App) RelayOutbox(ctx context.Context) (int, error) {
+	return app.relay.RelayOnce(ctx)
+}
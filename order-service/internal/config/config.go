@@ -0,0 +1,77 @@
+// Package config настройки order-service
+package config
+
+import (
+	"common/configutil"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config настройки order-service: значения по умолчанию, затем JSON-файл из CONFIG_FILE,
+// затем переменные окружения
+type Config struct {
+	Port     int                 `json:"port"`
+	Database configutil.Database `json:"database"`
+	Kafka    configutil.Kafka    `json:"kafka"`
+	Topics   configutil.Topics   `json:"topics"`
+	Tracing  configutil.Tracing  `json:"tracing"`
+
+	// StartupTimeout сколько ждать доступности базы и Kafka при старте
+	StartupTimeout configutil.Duration `json:"startup_timeout"`
+	// ShutdownTimeout сколько ждать завершения начатых HTTP-запросов при остановке
+	ShutdownTimeout configutil.Duration `json:"shutdown_timeout"`
+
+	// AutoMigrate применяет миграции схемы при старте. Без него сервис
+	// только проверяет версию схемы, а миграции применяются подкомандой migrate.
+	AutoMigrate bool `json:"auto_migrate"`
+}
+
+// Load загружает и проверяет настройки order-service
+func Load() (Config, error) {
+	cfg := Config{
+		Port:     8083,
+		Database: configutil.DefaultDatabase(),
+		Kafka:    configutil.DefaultKafka("order-service"),
+		Topics:   configutil.DefaultTopics(),
+		Tracing:  configutil.DefaultTracing(),
+
+		StartupTimeout:  configutil.Duration(2 * time.Minute),
+		ShutdownTimeout: configutil.Duration(30 * time.Second),
+		AutoMigrate:     true,
+	}
+	if err := configutil.LoadFile(&cfg); err != nil {
+		return Config{}, err
+	}
+
+	var env configutil.Env
+	env.Int(&cfg.Port, "HTTP_PORT")
+	cfg.Database.FromEnv(&env)
+	cfg.Kafka.FromEnv(&env)
+	cfg.Topics.FromEnv(&env)
+	cfg.Tracing.FromEnv(&env)
+	env.Duration(&cfg.StartupTimeout, "STARTUP_TIMEOUT")
+	env.Duration(&cfg.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+	env.Bool(&cfg.AutoMigrate, "AUTO_MIGRATE")
+	if err := env.Err(); err != nil {
+		return Config{}, fmt.Errorf("invalid environment: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate проверяет все настройки и возвращает все найденные ошибки сразу
+func (cfg Config) Validate() error {
+	return errors.Join(
+		configutil.ValidatePort("HTTP_PORT", cfg.Port),
+		cfg.Database.Validate(),
+		cfg.Kafka.Validate(),
+		cfg.Topics.Validate(),
+		cfg.Tracing.Validate(),
+		configutil.ValidatePositiveDuration("STARTUP_TIMEOUT", cfg.StartupTimeout),
+		configutil.ValidatePositiveDuration("SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout),
+	)
+}
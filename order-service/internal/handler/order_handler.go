@@ -1,9 +1,13 @@
 package handler
 
 import (
+	"common/money"
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
 	"net/http"
+	"order-service/internal/model"
+	"order-service/internal/repository"
 	"order-service/internal/service"
 )
 
@@ -12,10 +16,11 @@ type OrderHandler struct {
 }
 
 type Order struct {
-	ID     string  `json:"id,omitempty"`
-	UserID string  `json:"user_id"`
-	Amount float64 `json:"amount"`
-	Status string  `json:"status,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	UserID   string       `json:"user_id"`
+	Amount   money.Amount `json:"amount" swaggertype:"number"` // Не более двух знаков после запятой
+	Currency string       `json:"currency,omitempty"`          // Необязательно, только RUB
+	Status   string       `json:"status,omitempty"`
 }
 
 type Error struct {
@@ -43,11 +48,19 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	var req Order
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, "Invalid request", http.StatusBadRequest)
+		sendError(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := money.ValidateCurrency(req.Currency); err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	order, err := h.svc.CreateOrder(userId, req.Amount)
+	order, err := h.svc.CreateOrder(r.Context(), userId, req.Amount)
+	if errors.Is(err, service.ErrInvalidAmount) {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		sendError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -68,7 +81,7 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 func (h *OrderHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
 	userId := mux.Vars(r)["user_id"]
 
-	orders, err := h.svc.GetOrders(userId)
+	orders, err := h.svc.GetOrders(r.Context(), userId)
 	if err != nil {
 		sendError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -85,13 +98,18 @@ func (h *OrderHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
 // @Param user_id path string true "User ID"
 // @Param order_id path string true "Order ID"
 // @Success 200 {object} Order
+// @Failure 404 {object} Error
 // @Failure 500 {object} Error
 // @Router /order/{user_id}/{order_id} [get]
 func (h *OrderHandler) GetOrderStatus(w http.ResponseWriter, r *http.Request) {
 	userId := mux.Vars(r)["user_id"]
 	orderId := mux.Vars(r)["order_id"]
 
-	status, err := h.svc.GetOrderStatus(userId, orderId)
+	status, err := h.svc.GetOrderStatus(r.Context(), userId, orderId)
+	if errors.Is(err, repository.ErrOrderNotFound) {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		sendError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -100,6 +118,98 @@ func (h *OrderHandler) GetOrderStatus(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, Order{Status: status})
 }
 
+// GetOrderHistory godoc
+// @Summary Get order status history
+// @Description Get all status transitions for specific order
+// @Tags orders
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param order_id path string true "Order ID"
+// @Success 200 {array} model.StatusChange
+// @Failure 404 {object} Error
+// @Failure 500 {object} Error
+// @Router /order/{user_id}/{order_id}/history [get]
+func (h *OrderHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	orderId := mux.Vars(r)["order_id"]
+
+	history, err := h.svc.GetOrderHistory(r.Context(), userId, orderId)
+	if errors.Is(err, repository.ErrOrderNotFound) {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, history)
+}
+
+// CancelOrder godoc
+// @Summary Cancel order
+// @Description Cancel order. Unpaid order becomes cancelled, for a paid order the reserved amount is released or refunded and the order stays refund_requested until payment service confirms
+// @Tags orders
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param order_id path string true "Order ID"
+// @Success 200 {object} Order
+// @Failure 404 {object} Error
+// @Failure 409 {object} Error
+// @Failure 500 {object} Error
+// @Router /order/{user_id}/{order_id}/cancel [post]
+func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	orderId := mux.Vars(r)["order_id"]
+
+	status, err := h.svc.CancelOrder(r.Context(), userId, orderId)
+	switch {
+	case errors.Is(err, repository.ErrOrderNotFound):
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, model.ErrIllegalTransition):
+		sendError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Order{ID: orderId, UserID: userId, Status: string(status)})
+}
+
+// FulfillOrder godoc
+// @Summary Fulfill order
+// @Description Mark a paid order as fulfilled. The amount reserved for the order is captured by the payment service
+// @Tags orders
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param order_id path string true "Order ID"
+// @Success 200 {object} Order
+// @Failure 404 {object} Error
+// @Failure 409 {object} Error
+// @Failure 500 {object} Error
+// @Router /order/{user_id}/{order_id}/fulfill [post]
+func (h *OrderHandler) FulfillOrder(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	orderId := mux.Vars(r)["order_id"]
+
+	status, err := h.svc.FulfillOrder(r.Context(), userId, orderId)
+	switch {
+	case errors.Is(err, repository.ErrOrderNotFound):
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, model.ErrIllegalTransition):
+		sendError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendResponse(w, Order{ID: orderId, UserID: userId, Status: string(status)})
+}
+
 func sendResponse(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// OrderStatus статус заказа в его жизненном цикле
+type OrderStatus string
+
+const (
+	StatusCreated         OrderStatus = "created"
+	StatusAwaitingPayment OrderStatus = "awaiting_payment"
+	StatusPaid            OrderStatus = "paid"
+	StatusPaymentFailed   OrderStatus = "payment_failed"
+	StatusCancelled       OrderStatus = "cancelled"
+	StatusRefundRequested OrderStatus = "refund_requested"
+	StatusRefunded        OrderStatus = "refunded"
+	StatusFulfilled       OrderStatus = "fulfilled"
+	StatusCaptureFailed   OrderStatus = "capture_failed"
+)
+
+// ErrIllegalTransition возвращается при попытке перехода, запрещенного машиной состояний
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// transitions допустимые переходы между статусами заказа.
+// Результат оплаты может прийти раньше, чем relay отметит заказ как awaiting_payment,
+// поэтому из created также разрешены paid и payment_failed.
+// Отмененный заказ переходит в refunded, если оплата успела пройти и была возвращена.
+// Оплаченный заказ отменяется, если холд с его суммой истек до выполнения заказа.
+// Выполненный заказ переходит в capture_failed, если списать оплату не удалось,
+// и остается в нем до ручного разбора.
+var transitions = map[OrderStatus][]OrderStatus{
+	StatusCreated:         {StatusAwaitingPayment, StatusPaid, StatusPaymentFailed, StatusCancelled},
+	StatusAwaitingPayment: {StatusPaid, StatusPaymentFailed, StatusCancelled},
+	StatusPaid:            {StatusRefundRequested, StatusFulfilled, StatusCancelled},
+	StatusPaymentFailed:   {StatusCancelled},
+	StatusRefundRequested: {StatusRefunded},
+	StatusCancelled:       {StatusRefunded},
+	StatusFulfilled:       {StatusCaptureFailed},
+}
+
+// CanTransition проверяет, разрешен ли переход из статуса from в статус to
+func CanTransition(from, to OrderStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsClosed проверяет, что заказ закрыт: отменен или по нему возвращены средства.
+// Результаты оплаты, пришедшие для закрытого заказа, уже ничего не меняют.
+func IsClosed(status OrderStatus) bool {
+	return status == StatusCancelled || status == StatusRefunded
+}
+
+// StatusChange запись истории статусов заказа
+type StatusChange struct {
+	FromStatus  OrderStatus `json:"from_status,omitempty"`
+	ToStatus    OrderStatus `json:"to_status"`
+	Reason      string      `json:"reason,omitempty"`
+	SourceEvent string      `json:"source_event,omitempty"`
+	ChangedAt   time.Time   `json:"changed_at"`
+}
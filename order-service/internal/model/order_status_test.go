@@ -0,0 +1,58 @@
+package model
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[OrderStatus][]OrderStatus{
+		StatusCreated:         {StatusAwaitingPayment, StatusPaid, StatusPaymentFailed, StatusCancelled},
+		StatusAwaitingPayment: {StatusPaid, StatusPaymentFailed, StatusCancelled},
+		StatusPaid:            {StatusRefundRequested, StatusFulfilled, StatusCancelled},
+		StatusPaymentFailed:   {StatusCancelled},
+		StatusRefundRequested: {StatusRefunded},
+		StatusCancelled:       {StatusRefunded},
+		StatusFulfilled:       {StatusCaptureFailed},
+		// Из конечных статусов переходов нет
+		StatusRefunded:      nil,
+		StatusCaptureFailed: nil,
+	}
+	statuses := []OrderStatus{
+		StatusCreated, StatusAwaitingPayment, StatusPaid, StatusPaymentFailed,
+		StatusCancelled, StatusRefundRequested, StatusRefunded, StatusFulfilled, StatusCaptureFailed,
+	}
+
+	for _, from := range statuses {
+		next, ok := allowed[from]
+		if !ok {
+			t.Fatalf("status %s is missing from the test table", from)
+		}
+		for _, to := range statuses {
+			want := false
+			for _, status := range next {
+				want = want || status == to
+			}
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	// Неизвестные статусы никуда не переходят, и в них нельзя перейти
+	if CanTransition("unknown", StatusCreated) || CanTransition(StatusCreated, "unknown") {
+		t.Error("transition with an unknown status is allowed")
+	}
+}
+
+func TestIsClosed(t *testing.T) {
+	for status, want := range map[OrderStatus]bool{
+		StatusCancelled:       true,
+		StatusRefunded:        true,
+		StatusCreated:         false,
+		StatusPaid:            false,
+		StatusRefundRequested: false,
+		StatusFulfilled:       false,
+	} {
+		if got := IsClosed(status); got != want {
+			t.Errorf("IsClosed(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
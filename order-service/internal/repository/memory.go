@@ -0,0 +1,353 @@
+package repository
+
+import (
+	"common/money"
+	"common/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"order-service/internal/model"
+	"sync"
+	"time"
+)
+
+// MemoryOrderRepository хранит заказы в памяти процесса с той же семантикой, что и OrderRepository.
+// Все операции выполняются под одной блокировкой, в том числе вызов publish в RelayPendingOutbox,
+// поэтому publish не должен обращаться к самому хранилищу.
+type MemoryOrderRepository struct {
+	mu      sync.Mutex
+	orders  map[string]*memoryOrder
+	ordered []string // ID заказов в порядке создания
+	history map[string][]model.StatusChange
+	outbox  []*memoryOutboxMessage // в порядке создания
+}
+
+// memoryOrder строка таблицы orders
+type memoryOrder struct {
+	userId            string
+	amount            money.Amount
+	orderStatus       model.OrderStatus
+	transactionStatus string
+}
+
+// memoryOutboxMessage строка таблицы transaction_outbox
+type memoryOutboxMessage struct {
+	OutboxMessage
+	sent      bool
+	failed    bool // отклонена relay и больше не отправляется
+	lastError string
+}
+
+// pending проверяет, что запись еще ждет отправки
+func (msg *memoryOutboxMessage) pending() bool {
+	return !msg.sent && !msg.failed
+}
+
+// NewMemoryOrderRepository создает пустое хранилище заказов в памяти
+func NewMemoryOrderRepository() *MemoryOrderRepository {
+	return &MemoryOrderRepository{
+		orders:  make(map[string]*memoryOrder),
+		history: make(map[string][]model.StatusChange),
+	}
+}
+
+// CreateOrder создает новый заказ для пользователя вместе с командой на оплату в outbox
+func (repo *MemoryOrderRepository) CreateOrder(ctx context.Context, userId string, amount money.Amount) (string, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	orderId := uuid.New().String()
+	repo.orders[orderId] = &memoryOrder{
+		userId:            userId,
+		amount:            amount,
+		orderStatus:       model.StatusCreated,
+		transactionStatus: "pending",
+	}
+	repo.ordered = append(repo.ordered, orderId)
+	repo.recordStatusChange(orderId, "", model.StatusCreated, "order created", "create_order")
+	repo.outbox = append(repo.outbox, &memoryOutboxMessage{OutboxMessage: OutboxMessage{
+		TransactionID: orderId,
+		OrderID:       orderId,
+		EventType:     OutboxPaymentRequested,
+		UserID:        userId,
+		Amount:        amount,
+		TraceContext:  tracing.Inject(ctx),
+	}})
+	return orderId, nil
+}
+
+// GetOrders получает все заказы для пользователя
+func (repo *MemoryOrderRepository) GetOrders(ctx context.Context, userId string) ([]map[string]interface{}, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var orders []map[string]interface{}
+	for _, orderId := range repo.ordered {
+		order := repo.orders[orderId]
+		if order.userId != userId {
+			continue
+		}
+		orders = append(orders, map[string]interface{}{
+			"order_id":           orderId,
+			"amount":             order.amount,
+			"currency":           money.Currency,
+			"order_status":       string(order.orderStatus),
+			"transaction_status": order.transactionStatus,
+		})
+	}
+	return orders, nil
+}
+
+// GetOrderStatus получает статус заказа по user_id и order_id
+func (repo *MemoryOrderRepository) GetOrderStatus(ctx context.Context, userId string, orderId string) (string, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	order, err := repo.userOrder(userId, orderId)
+	if err != nil {
+		return "", err
+	}
+	return string(order.orderStatus), nil
+}
+
+// GetOrderStatusByID получает статус заказа по order_id
+func (repo *MemoryOrderRepository) GetOrderStatusByID(ctx context.Context, orderId string) (model.OrderStatus, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	order, ok := repo.orders[orderId]
+	if !ok {
+		return "", ErrOrderNotFound
+	}
+	return order.orderStatus, nil
+}
+
+// RelayPendingOutbox передает в publish одной пачкой до limit неотправленных записей outbox
+// в порядке создания. Отклоненные publish записи больше не отправляются. Если publish
+// завершился ошибкой, у остальных записей пачки увеличивается счетчик попыток.
+func (repo *MemoryOrderRepository) RelayPendingOutbox(ctx context.Context, limit int, publish OutboxPublisher) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var pending []*memoryOutboxMessage
+	batch := make([]OutboxMessage, 0, limit)
+	for _, msg := range repo.outbox {
+		if len(batch) == limit {
+			break
+		}
+		if msg.pending() {
+			pending = append(pending, msg)
+			batch = append(batch, msg.OutboxMessage)
+		}
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	rejected, publishErr := publish(batch)
+	sent := 0
+	for _, msg := range pending {
+		if reason, ok := rejected[msg.TransactionID]; ok {
+			msg.failed = true
+			msg.Attempts++
+			msg.lastError = reason.Error()
+			continue
+		}
+		if publishErr != nil {
+			msg.Attempts++
+			msg.lastError = publishErr.Error()
+			continue
+		}
+
+		msg.sent = true
+		msg.lastError = ""
+
+		if msg.EventType == OutboxPaymentRequested {
+			// Результат оплаты мог опередить relay, тогда заказ уже не в статусе created
+			_, err := repo.transition(StatusTransition{
+				OrderID:     msg.OrderID,
+				To:          model.StatusAwaitingPayment,
+				Reason:      "payment requested",
+				SourceEvent: OutboxPaymentRequested,
+			})
+			if err != nil && !errors.Is(err, model.ErrIllegalTransition) {
+				return sent, err
+			}
+		}
+		sent++
+	}
+	return sent, publishErr
+}
+
+// CountPendingOutbox возвращает число неотправленных записей outbox
+func (repo *MemoryOrderRepository) CountPendingOutbox(ctx context.Context) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	count := 0
+	for _, msg := range repo.outbox {
+		if msg.pending() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// TransitionOrderStatus переводит заказ в новый статус по правилам машины состояний.
+// Повторный переход в текущий статус ничего не меняет и возвращает false.
+func (repo *MemoryOrderRepository) TransitionOrderStatus(ctx context.Context, t StatusTransition) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	return repo.transition(t)
+}
+
+// CancelOrder отменяет заказ пользователя и возвращает его новый статус.
+// Для оплаченного заказа в outbox добавляется команда на возврат средств.
+func (repo *MemoryOrderRepository) CancelOrder(ctx context.Context, userId string, orderId string) (model.OrderStatus, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	order, err := repo.userOrder(userId, orderId)
+	if err != nil {
+		return "", err
+	}
+
+	transition := StatusTransition{
+		OrderID:     orderId,
+		To:          model.StatusCancelled,
+		Reason:      "cancelled by user",
+		SourceEvent: "cancel_order",
+	}
+	switch order.orderStatus {
+	case model.StatusCancelled, model.StatusRefundRequested:
+		// Повторная отмена ничего не меняет
+		return order.orderStatus, nil
+	case model.StatusPaid:
+		transition.To = model.StatusRefundRequested
+		transition.TransactionStatus = "refund_requested"
+	}
+
+	if _, err := repo.transition(transition); err != nil {
+		return "", err
+	}
+	if transition.To == model.StatusRefundRequested {
+		repo.addOrderCommand(ctx, OutboxRefundRequested, orderId, userId, order.amount)
+	}
+	return transition.To, nil
+}
+
+// FulfillOrder отмечает оплаченный заказ выполненным и добавляет в outbox
+// команду на списание зарезервированной суммы. Повторный вызов ничего не меняет.
+func (repo *MemoryOrderRepository) FulfillOrder(ctx context.Context, userId string, orderId string) (model.OrderStatus, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	order, err := repo.userOrder(userId, orderId)
+	if err != nil {
+		return "", err
+	}
+	if order.orderStatus == model.StatusFulfilled {
+		return order.orderStatus, nil
+	}
+
+	transition := StatusTransition{
+		OrderID:           orderId,
+		To:                model.StatusFulfilled,
+		TransactionStatus: "capture_requested",
+		Reason:            "order fulfilled",
+		SourceEvent:       "fulfill_order",
+	}
+	if _, err := repo.transition(transition); err != nil {
+		return "", err
+	}
+	repo.addOrderCommand(ctx, OutboxCaptureRequested, orderId, userId, order.amount)
+	return transition.To, nil
+}
+
+// RequestRefund добавляет команду на возврат средств по заказу, не меняя его статус
+func (repo *MemoryOrderRepository) RequestRefund(ctx context.Context, orderId string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	order, ok := repo.orders[orderId]
+	if !ok {
+		return ErrOrderNotFound
+	}
+	repo.addOrderCommand(ctx, OutboxRefundRequested, orderId, order.userId, order.amount)
+	order.transactionStatus = "refund_requested"
+	return nil
+}
+
+// GetOrderHistory возвращает историю статусов заказа пользователя в хронологическом порядке
+func (repo *MemoryOrderRepository) GetOrderHistory(ctx context.Context, userId string, orderId string) ([]model.StatusChange, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, err := repo.userOrder(userId, orderId); err != nil {
+		return nil, err
+	}
+	return append([]model.StatusChange{}, repo.history[orderId]...), nil
+}
+
+// userOrder находит заказ пользователя
+func (repo *MemoryOrderRepository) userOrder(userId string, orderId string) (*memoryOrder, error) {
+	order, ok := repo.orders[orderId]
+	if !ok || order.userId != userId {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// transition меняет статус заказа, вызывается под блокировкой
+func (repo *MemoryOrderRepository) transition(t StatusTransition) (bool, error) {
+	order, ok := repo.orders[t.OrderID]
+	if !ok {
+		return false, ErrOrderNotFound
+	}
+
+	from := order.orderStatus
+	if from == t.To {
+		return false, nil
+	}
+	if !model.CanTransition(from, t.To) {
+		return false, fmt.Errorf("%w: %s -> %s", model.ErrIllegalTransition, from, t.To)
+	}
+
+	order.orderStatus = t.To
+	if t.TransactionStatus != "" {
+		order.transactionStatus = t.TransactionStatus
+	}
+	repo.recordStatusChange(t.OrderID, from, t.To, t.Reason, t.SourceEvent)
+	return true, nil
+}
+
+// addOrderCommand добавляет в outbox команду по заказу, если ее там еще нет
+func (repo *MemoryOrderRepository) addOrderCommand(ctx context.Context, eventType string, orderId string, userId string, amount money.Amount) {
+	transactionId := orderCommandID(orderId, eventType)
+	for _, msg := range repo.outbox {
+		if msg.TransactionID == transactionId {
+			return
+		}
+	}
+	repo.outbox = append(repo.outbox, &memoryOutboxMessage{OutboxMessage: OutboxMessage{
+		TransactionID: transactionId,
+		OrderID:       orderId,
+		EventType:     eventType,
+		UserID:        userId,
+		Amount:        amount,
+		TraceContext:  tracing.Inject(ctx),
+	}})
+}
+
+// recordStatusChange добавляет запись в историю статусов заказа
+func (repo *MemoryOrderRepository) recordStatusChange(orderId string, from model.OrderStatus, to model.OrderStatus, reason string, sourceEvent string) {
+	repo.history[orderId] = append(repo.history[orderId], model.StatusChange{
+		FromStatus:  from,
+		ToStatus:    to,
+		Reason:      reason,
+		SourceEvent: sourceEvent,
+		ChangedAt:   time.Now().UTC(),
+	})
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"common/migrate"
+	"database/sql"
+	"embed"
+)
+
+// migrationFiles версионированная схема order-service, см. migrations/
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewMigrator возвращает мигратор схемы order-service
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	return migrate.New(db, "order-service", migrationFiles, "migrations")
+}
+
+// DeadLettersTable таблица сообщений, отложенных order-service без обработки, см. deadletter.PostgresStore
+const DeadLettersTable = "order_dead_letters"
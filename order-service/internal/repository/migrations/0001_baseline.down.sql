@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS order_status_history;
+DROP TABLE IF EXISTS transaction_outbox;
+DROP TABLE IF EXISTS orders;
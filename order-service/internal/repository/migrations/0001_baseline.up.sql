@@ -0,0 +1,52 @@
+-- Схема order-service на момент перехода на миграции. Все операторы идемпотентны,
+-- поэтому миграция применяется и к пустой базе, и к базе, созданной прежним InitDB.
+
+CREATE TABLE IF NOT EXISTS orders (
+	order_id UUID PRIMARY KEY,           -- Используем UUID для уникальности
+	user_id VARCHAR(255),
+	amount NUMERIC(18, 2),
+	order_status VARCHAR(50) DEFAULT 'created',
+	transaction_status VARCHAR(50) DEFAULT 'pending',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS transaction_outbox (
+	transaction_id UUID PRIMARY KEY,
+	user_id VARCHAR(255),
+	amount NUMERIC(18, 2),
+	status VARCHAR(50) DEFAULT 'pending',
+	attempts INT DEFAULT 0,
+	last_error TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	sent_at TIMESTAMP,
+	order_id UUID,
+	event_type VARCHAR(50) DEFAULT 'payment_requested'
+);
+
+-- Колонки relay для баз, созданных до его появления
+ALTER TABLE transaction_outbox ADD COLUMN IF NOT EXISTS attempts INT DEFAULT 0;
+ALTER TABLE transaction_outbox ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE transaction_outbox ADD COLUMN IF NOT EXISTS sent_at TIMESTAMP;
+ALTER TABLE transaction_outbox ADD COLUMN IF NOT EXISTS order_id UUID;
+ALTER TABLE transaction_outbox ADD COLUMN IF NOT EXISTS event_type VARCHAR(50) DEFAULT 'payment_requested';
+
+-- Точные суммы для баз, созданных с колонками FLOAT
+ALTER TABLE orders ALTER COLUMN amount TYPE NUMERIC(18, 2);
+ALTER TABLE transaction_outbox ALTER COLUMN amount TYPE NUMERIC(18, 2);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_outbox_pending
+	ON transaction_outbox (created_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+	id BIGSERIAL PRIMARY KEY,
+	order_id UUID NOT NULL REFERENCES orders (order_id),
+	from_status VARCHAR(50),
+	to_status VARCHAR(50) NOT NULL,
+	reason TEXT,
+	source_event VARCHAR(100),
+	changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order
+	ON order_status_history (order_id, changed_at);
@@ -0,0 +1,2 @@
+-- Список заказов пользователя выбирается по user_id
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders (user_id);
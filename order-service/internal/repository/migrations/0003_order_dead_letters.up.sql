@@ -0,0 +1,10 @@
+-- Сообщения из Kafka, которые order-service не смог разобрать и отложил для разбора вручную
+CREATE TABLE IF NOT EXISTS order_dead_letters (
+	id BIGSERIAL PRIMARY KEY,
+	kind VARCHAR(50) NOT NULL,
+	topic VARCHAR(255) NOT NULL,
+	message_key BYTEA,
+	message_value BYTEA NOT NULL,
+	reason TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
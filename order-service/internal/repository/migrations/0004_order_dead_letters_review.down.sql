@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS order_dead_letters_audit;
+DROP INDEX IF EXISTS idx_order_dead_letters_status;
+ALTER TABLE order_dead_letters
+	DROP COLUMN IF EXISTS resolved_at,
+	DROP COLUMN IF EXISTS status,
+	DROP COLUMN IF EXISTS attempts;
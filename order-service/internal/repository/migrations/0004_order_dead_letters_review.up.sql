@@ -0,0 +1,19 @@
+-- Отложенные сообщения разбираются через admin API: число попыток обработки и результат разбора
+ALTER TABLE order_dead_letters
+	ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+	ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	ADD COLUMN resolved_at TIMESTAMP;
+
+-- Admin API выбирает сообщения по статусу разбора
+CREATE INDEX IF NOT EXISTS idx_order_dead_letters_status ON order_dead_letters (status);
+
+-- Журнал действий администраторов с отложенными сообщениями
+CREATE TABLE IF NOT EXISTS order_dead_letters_audit (
+	id BIGSERIAL PRIMARY KEY,
+	message_id BIGINT NOT NULL REFERENCES order_dead_letters (id),
+	action VARCHAR(20) NOT NULL,
+	actor VARCHAR(255) NOT NULL,
+	reason TEXT,
+	edited_value BYTEA,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
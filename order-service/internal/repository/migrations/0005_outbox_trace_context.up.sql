@@ -0,0 +1,2 @@
+-- Контекст трассировки запроса, создавшего запись: relay продолжает ту же трассировку при публикации
+ALTER TABLE transaction_outbox ADD COLUMN trace_context TEXT;
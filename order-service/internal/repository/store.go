@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"common/money"
+	"context"
+	"order-service/internal/model"
+)
+
+// OrderStore хранилище заказов, истории их статусов и transaction_outbox.
+// Реализации: OrderRepository поверх PostgreSQL и MemoryOrderRepository в памяти
+// с той же семантикой; их поведение проверяет набор тестов storetest.
+type OrderStore interface {
+	CreateOrder(ctx context.Context, userId string, amount money.Amount) (string, error)
+	GetOrders(ctx context.Context, userId string) ([]map[string]interface{}, error)
+	GetOrderStatus(ctx context.Context, userId string, orderId string) (string, error)
+	GetOrderStatusByID(ctx context.Context, orderId string) (model.OrderStatus, error)
+	RelayPendingOutbox(ctx context.Context, limit int, publish OutboxPublisher) (int, error)
+	CountPendingOutbox(ctx context.Context) (int, error)
+	TransitionOrderStatus(ctx context.Context, t StatusTransition) (bool, error)
+	CancelOrder(ctx context.Context, userId string, orderId string) (model.OrderStatus, error)
+	FulfillOrder(ctx context.Context, userId string, orderId string) (model.OrderStatus, error)
+	RequestRefund(ctx context.Context, orderId string) error
+	GetOrderHistory(ctx context.Context, userId string, orderId string) ([]model.StatusChange, error)
+}
+
+var (
+	_ OrderStore = (*OrderRepository)(nil)
+	_ OrderStore = (*MemoryOrderRepository)(nil)
+)
@@ -0,0 +1,71 @@
+package repository_test
+
+import (
+	"common/money"
+	"context"
+	"order-service/internal/repository"
+	"order-service/internal/repository/storetest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMemoryOrderRepository(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) repository.OrderStore {
+		return repository.NewMemoryOrderRepository()
+	})
+}
+
+// TestOrderRepository запускает тот же набор на PostgreSQL из TEST_DATABASE_URL.
+// Таблицы сервиса очищаются перед каждым тестом, поэтому база должна быть отдельной.
+func TestOrderRepository(t *testing.T) {
+	connStr := os.Getenv("TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 30*time.Second)
+	defer cancel()
+	db, err := repository.InitDB(ctx, connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := repository.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	newStore := func(t *testing.T) repository.OrderStore {
+		if _, err := db.Exec("TRUNCATE orders, order_status_history, transaction_outbox"); err != nil {
+			t.Fatal(err)
+		}
+		return repository.NewOrderRepository(db)
+	}
+	storetest.Run(t, newStore)
+
+	// Испорченный контекст трассировки не мешает отправить запись
+	t.Run("CorruptTraceContext", func(t *testing.T) {
+		store := newStore(t)
+		orderId, err := store.CreateOrder(t.Context(), "user", money.FromMinor(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("UPDATE transaction_outbox SET trace_context = '[\"not a map\"]' WHERE order_id = $1", orderId); err != nil {
+			t.Fatal(err)
+		}
+
+		var relayed []repository.OutboxMessage
+		sent, err := store.RelayPendingOutbox(t.Context(), 10, func(batch []repository.OutboxMessage) (map[string]error, error) {
+			relayed = append(relayed, batch...)
+			return nil, nil
+		})
+		if sent != 1 || err != nil || len(relayed) != 1 || relayed[0].TraceContext != nil {
+			t.Fatalf("RelayPendingOutbox = %d, %v, %+v; want the message without trace context", sent, err, relayed)
+		}
+	})
+}
@@ -0,0 +1,461 @@
+// Package storetest набор тестов, которому должна удовлетворять любая реализация
+// repository.OrderStore. Один и тот же набор запускается для PostgreSQL и для
+// хранилища в памяти, поэтому их поведение не расходится.
+package storetest
+
+import (
+	"common/money"
+	"errors"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"order-service/internal/model"
+	"order-service/internal/repository"
+	"sync"
+	"testing"
+)
+
+// Run запускает набор тестов. newStore вызывается для каждого теста и должен
+// возвращать пустое хранилище.
+func Run(t *testing.T, newStore func(t *testing.T) repository.OrderStore) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store repository.OrderStore)
+	}{
+		{"CreateOrder", testCreateOrder},
+		{"OrderNotFound", testOrderNotFound},
+		{"RelayPendingOutbox", testRelayPendingOutbox},
+		{"RelayPublishFailure", testRelayPublishFailure},
+		{"RelayRejectedMessage", testRelayRejectedMessage},
+		{"RelayLimit", testRelayLimit},
+		{"OutboxTraceContext", testOutboxTraceContext},
+		{"TransitionOrderStatus", testTransitionOrderStatus},
+		{"CancelOrder", testCancelOrder},
+		{"FulfillOrder", testFulfillOrder},
+		{"RequestRefund", testRequestRefund},
+		{"ConcurrentTransitions", testConcurrentTransitions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+func testCreateOrder(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+	orderId := createOrder(t, store, userId, money.FromMinor(12345))
+
+	status, err := store.GetOrderStatus(t.Context(), userId, orderId)
+	if err != nil || status != string(model.StatusCreated) {
+		t.Fatalf("GetOrderStatus = %q, %v; want created", status, err)
+	}
+	byId, err := store.GetOrderStatusByID(t.Context(), orderId)
+	if err != nil || byId != model.StatusCreated {
+		t.Fatalf("GetOrderStatusByID = %q, %v; want created", byId, err)
+	}
+
+	orders, err := store.GetOrders(t.Context(), userId)
+	if err != nil {
+		t.Fatalf("GetOrders: %v", err)
+	}
+	if len(orders) != 1 {
+		t.Fatalf("GetOrders returned %d orders, want 1", len(orders))
+	}
+	want := map[string]interface{}{
+		"order_id":           orderId,
+		"amount":             money.FromMinor(12345),
+		"currency":           money.Currency,
+		"order_status":       string(model.StatusCreated),
+		"transaction_status": "pending",
+	}
+	for key, value := range want {
+		if orders[0][key] != value {
+			t.Errorf("order[%q] = %v, want %v", key, orders[0][key], value)
+		}
+	}
+
+	other, err := store.GetOrders(t.Context(), newUserID())
+	if err != nil || len(other) != 0 {
+		t.Fatalf("GetOrders for another user = %v, %v; want no orders", other, err)
+	}
+
+	expectHistory(t, store, userId, orderId, model.StatusCreated)
+}
+
+func testOrderNotFound(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+	orderId := createOrder(t, store, userId, money.FromMinor(100))
+	missing := uuid.New().String()
+
+	if _, err := store.GetOrderStatus(t.Context(), userId, missing); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("GetOrderStatus of a missing order: %v, want ErrOrderNotFound", err)
+	}
+	if _, err := store.GetOrderStatus(t.Context(), newUserID(), orderId); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("GetOrderStatus of another user's order: %v, want ErrOrderNotFound", err)
+	}
+	if _, err := store.GetOrderStatusByID(t.Context(), missing); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("GetOrderStatusByID: %v, want ErrOrderNotFound", err)
+	}
+	if _, err := store.GetOrderHistory(t.Context(), newUserID(), orderId); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("GetOrderHistory: %v, want ErrOrderNotFound", err)
+	}
+	if _, err := store.CancelOrder(t.Context(), newUserID(), orderId); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("CancelOrder: %v, want ErrOrderNotFound", err)
+	}
+	if _, err := store.FulfillOrder(t.Context(), userId, missing); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("FulfillOrder: %v, want ErrOrderNotFound", err)
+	}
+	if err := store.RequestRefund(t.Context(), missing); !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("RequestRefund: %v, want ErrOrderNotFound", err)
+	}
+	_, err := store.TransitionOrderStatus(t.Context(), repository.StatusTransition{OrderID: missing, To: model.StatusPaid})
+	if !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("TransitionOrderStatus: %v, want ErrOrderNotFound", err)
+	}
+}
+
+func testRelayPendingOutbox(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+	first := createOrder(t, store, userId, money.FromMinor(100))
+	second := createOrder(t, store, userId, money.FromMinor(200))
+
+	messages := relayAll(t, store)
+	if len(messages) != 2 {
+		t.Fatalf("relayed %d messages, want 2", len(messages))
+	}
+	for i, want := range []struct {
+		orderId string
+		amount  money.Amount
+	}{{first, money.FromMinor(100)}, {second, money.FromMinor(200)}} {
+		msg := messages[i]
+		if msg.TransactionID != want.orderId || msg.OrderID != want.orderId || msg.EventType != repository.OutboxPaymentRequested ||
+			msg.UserID != userId || msg.Amount != want.amount || msg.Attempts != 0 {
+			t.Errorf("message %d = %+v, want payment request for order %s", i, msg, want.orderId)
+		}
+		expectStatus(t, store, want.orderId, model.StatusAwaitingPayment)
+	}
+
+	if again := relayAll(t, store); len(again) != 0 {
+		t.Fatalf("sent messages were relayed again: %+v", again)
+	}
+	expectHistory(t, store, userId, first, model.StatusCreated, model.StatusAwaitingPayment)
+}
+
+func testRelayPublishFailure(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+	first := createOrder(t, store, userId, money.FromMinor(100))
+	second := createOrder(t, store, userId, money.FromMinor(200))
+
+	// Пачка публикуется целиком, поэтому после ошибки ни одна запись не считается отправленной
+	publishErr := errors.New("broker unavailable")
+	sent, err := store.RelayPendingOutbox(t.Context(), 10, func([]repository.OutboxMessage) (map[string]error, error) { return nil, publishErr })
+	if sent != 0 || !errors.Is(err, publishErr) {
+		t.Fatalf("RelayPendingOutbox = %d, %v; want 0 and the publish error", sent, err)
+	}
+	expectStatus(t, store, first, model.StatusCreated)
+	expectPendingOutbox(t, store, 2)
+
+	messages := relayAll(t, store)
+	if len(messages) != 2 || messages[0].OrderID != first || messages[1].OrderID != second ||
+		messages[0].Attempts != 1 || messages[1].Attempts != 1 {
+		t.Fatalf("relayed %+v, want both failed messages with one attempt", messages)
+	}
+	expectStatus(t, store, first, model.StatusAwaitingPayment)
+	expectStatus(t, store, second, model.StatusAwaitingPayment)
+}
+
+func testRelayRejectedMessage(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+	poison := createOrder(t, store, userId, money.FromMinor(100))
+	healthy := createOrder(t, store, userId, money.FromMinor(200))
+
+	// Отклоненная запись не мешает отправить остальные и больше не выбирается
+	sent, err := store.RelayPendingOutbox(t.Context(), 10, func(batch []repository.OutboxMessage) (map[string]error, error) {
+		if len(batch) != 2 {
+			t.Errorf("publish got %d messages, want 2", len(batch))
+		}
+		return map[string]error{poison: errors.New("unknown event type")}, nil
+	})
+	if sent != 1 || err != nil {
+		t.Fatalf("RelayPendingOutbox = %d, %v; want 1", sent, err)
+	}
+	expectStatus(t, store, poison, model.StatusCreated)
+	expectStatus(t, store, healthy, model.StatusAwaitingPayment)
+	expectPendingOutbox(t, store, 0)
+	if again := relayAll(t, store); len(again) != 0 {
+		t.Fatalf("rejected message was relayed again: %+v", again)
+	}
+}
+
+func testRelayLimit(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+	for i := 0; i < 3; i++ {
+		createOrder(t, store, userId, money.FromMinor(100))
+	}
+
+	expectPendingOutbox(t, store, 3)
+	sent, err := store.RelayPendingOutbox(t.Context(), 2, func(batch []repository.OutboxMessage) (map[string]error, error) {
+		if len(batch) != 2 {
+			t.Errorf("publish got %d messages, want 2", len(batch))
+		}
+		return nil, nil
+	})
+	if sent != 2 || err != nil {
+		t.Fatalf("RelayPendingOutbox = %d, %v; want 2", sent, err)
+	}
+	expectPendingOutbox(t, store, 1)
+	if rest := relayAll(t, store); len(rest) != 1 {
+		t.Fatalf("relayed %d messages after the limit, want 1", len(rest))
+	}
+	expectPendingOutbox(t, store, 0)
+}
+
+func testOutboxTraceContext(t *testing.T, store repository.OrderStore) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	traceId, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanId, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	traced := trace.ContextWithSpanContext(t.Context(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceId,
+		SpanID:     spanId,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	userId := newUserID()
+	if _, err := store.CreateOrder(traced, userId, money.FromMinor(100)); err != nil {
+		t.Fatal(err)
+	}
+	createOrder(t, store, userId, money.FromMinor(200))
+
+	// Запись outbox продолжает трассировку создавшего ее запроса
+	messages := relayAll(t, store)
+	if len(messages) != 2 {
+		t.Fatalf("relayed %d messages, want 2", len(messages))
+	}
+	if got := messages[0].TraceContext["traceparent"]; got != traceparent {
+		t.Fatalf("traceparent = %q, want %q", got, traceparent)
+	}
+	if messages[1].TraceContext != nil {
+		t.Fatalf("order created outside a trace has trace context %v", messages[1].TraceContext)
+	}
+}
+
+func testTransitionOrderStatus(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+	orderId := createOrder(t, store, userId, money.FromMinor(100))
+
+	changed, err := store.TransitionOrderStatus(t.Context(), repository.StatusTransition{
+		OrderID:           orderId,
+		To:                model.StatusPaid,
+		TransactionStatus: "completed",
+		Reason:            "payment succeeded",
+		SourceEvent:       "payment_result",
+	})
+	if !changed || err != nil {
+		t.Fatalf("TransitionOrderStatus to paid = %v, %v; want true", changed, err)
+	}
+	orders, err := store.GetOrders(t.Context(), userId)
+	if err != nil || len(orders) != 1 || orders[0]["transaction_status"] != "completed" {
+		t.Fatalf("GetOrders = %v, %v; want transaction_status completed", orders, err)
+	}
+
+	changed, err = store.TransitionOrderStatus(t.Context(), repository.StatusTransition{OrderID: orderId, To: model.StatusPaid})
+	if changed || err != nil {
+		t.Fatalf("repeated transition = %v, %v; want false and no error", changed, err)
+	}
+
+	_, err = store.TransitionOrderStatus(t.Context(), repository.StatusTransition{OrderID: orderId, To: model.StatusPaymentFailed})
+	if !errors.Is(err, model.ErrIllegalTransition) {
+		t.Fatalf("paid -> payment_failed: %v, want ErrIllegalTransition", err)
+	}
+	expectStatus(t, store, orderId, model.StatusPaid)
+
+	history := expectHistory(t, store, userId, orderId, model.StatusCreated, model.StatusPaid)
+	if last := history[1]; last.FromStatus != model.StatusCreated || last.Reason != "payment succeeded" || last.SourceEvent != "payment_result" {
+		t.Fatalf("history entry = %+v, want the payment transition", last)
+	}
+}
+
+func testCancelOrder(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+
+	unpaid := createOrder(t, store, userId, money.FromMinor(100))
+	relayAll(t, store)
+	status, err := store.CancelOrder(t.Context(), userId, unpaid)
+	if status != model.StatusCancelled || err != nil {
+		t.Fatalf("CancelOrder of an unpaid order = %q, %v; want cancelled", status, err)
+	}
+	if messages := relayAll(t, store); len(messages) != 0 {
+		t.Fatalf("cancelling an unpaid order queued %+v", messages)
+	}
+
+	paid := createOrder(t, store, userId, money.FromMinor(250))
+	relayAll(t, store)
+	transition(t, store, paid, model.StatusPaid)
+
+	for i := 0; i < 2; i++ {
+		status, err = store.CancelOrder(t.Context(), userId, paid)
+		if status != model.StatusRefundRequested || err != nil {
+			t.Fatalf("CancelOrder of a paid order = %q, %v; want refund_requested", status, err)
+		}
+	}
+	messages := relayAll(t, store)
+	if len(messages) != 1 {
+		t.Fatalf("cancelling a paid order twice queued %d messages, want 1", len(messages))
+	}
+	refund := messages[0]
+	if refund.EventType != repository.OutboxRefundRequested || refund.OrderID != paid || refund.TransactionID == paid ||
+		refund.UserID != userId || refund.Amount != money.FromMinor(250) {
+		t.Fatalf("refund message = %+v", refund)
+	}
+	expectHistory(t, store, userId, paid, model.StatusCreated, model.StatusAwaitingPayment, model.StatusPaid, model.StatusRefundRequested)
+}
+
+func testFulfillOrder(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+	orderId := createOrder(t, store, userId, money.FromMinor(300))
+	relayAll(t, store)
+
+	if _, err := store.FulfillOrder(t.Context(), userId, orderId); !errors.Is(err, model.ErrIllegalTransition) {
+		t.Fatalf("FulfillOrder of an unpaid order: %v, want ErrIllegalTransition", err)
+	}
+
+	transition(t, store, orderId, model.StatusPaid)
+	for i := 0; i < 2; i++ {
+		status, err := store.FulfillOrder(t.Context(), userId, orderId)
+		if status != model.StatusFulfilled || err != nil {
+			t.Fatalf("FulfillOrder = %q, %v; want fulfilled", status, err)
+		}
+	}
+
+	messages := relayAll(t, store)
+	if len(messages) != 1 || messages[0].EventType != repository.OutboxCaptureRequested ||
+		messages[0].OrderID != orderId || messages[0].Amount != money.FromMinor(300) {
+		t.Fatalf("relayed %+v, want one capture request", messages)
+	}
+	orders, err := store.GetOrders(t.Context(), userId)
+	if err != nil || orders[0]["transaction_status"] != "capture_requested" {
+		t.Fatalf("GetOrders = %v, %v; want transaction_status capture_requested", orders, err)
+	}
+}
+
+func testRequestRefund(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+	orderId := createOrder(t, store, userId, money.FromMinor(100))
+	relayAll(t, store)
+	transition(t, store, orderId, model.StatusCancelled)
+
+	for i := 0; i < 2; i++ {
+		if err := store.RequestRefund(t.Context(), orderId); err != nil {
+			t.Fatalf("RequestRefund: %v", err)
+		}
+	}
+	messages := relayAll(t, store)
+	if len(messages) != 1 || messages[0].EventType != repository.OutboxRefundRequested {
+		t.Fatalf("relayed %+v, want one refund request", messages)
+	}
+	expectStatus(t, store, orderId, model.StatusCancelled)
+
+	orders, err := store.GetOrders(t.Context(), userId)
+	if err != nil || orders[0]["transaction_status"] != "refund_requested" {
+		t.Fatalf("GetOrders = %v, %v; want transaction_status refund_requested", orders, err)
+	}
+}
+
+func testConcurrentTransitions(t *testing.T, store repository.OrderStore) {
+	userId := newUserID()
+	orderId := createOrder(t, store, userId, money.FromMinor(100))
+
+	const workers = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	changes := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			changed, err := store.TransitionOrderStatus(t.Context(), repository.StatusTransition{OrderID: orderId, To: model.StatusPaid})
+			if err != nil {
+				t.Errorf("TransitionOrderStatus: %v", err)
+			}
+			if changed {
+				mu.Lock()
+				changes++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if changes != 1 {
+		t.Fatalf("%d concurrent transitions changed the order, want exactly 1", changes)
+	}
+	expectHistory(t, store, userId, orderId, model.StatusCreated, model.StatusPaid)
+}
+
+// newUserID возвращает уникальный ID пользователя, чтобы тесты не видели чужих заказов
+func newUserID() string {
+	return "user-" + uuid.New().String()
+}
+
+func createOrder(t *testing.T, store repository.OrderStore, userId string, amount money.Amount) string {
+	t.Helper()
+	orderId, err := store.CreateOrder(t.Context(), userId, amount)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	return orderId
+}
+
+func transition(t *testing.T, store repository.OrderStore, orderId string, to model.OrderStatus) {
+	t.Helper()
+	if _, err := store.TransitionOrderStatus(t.Context(), repository.StatusTransition{OrderID: orderId, To: to}); err != nil {
+		t.Fatalf("TransitionOrderStatus to %s: %v", to, err)
+	}
+}
+
+// relayAll отправляет все ожидающие записи outbox и возвращает их
+func relayAll(t *testing.T, store repository.OrderStore) []repository.OutboxMessage {
+	t.Helper()
+	var messages []repository.OutboxMessage
+	_, err := store.RelayPendingOutbox(t.Context(), 100, func(batch []repository.OutboxMessage) (map[string]error, error) {
+		messages = append(messages, batch...)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("RelayPendingOutbox: %v", err)
+	}
+	return messages
+}
+
+func expectPendingOutbox(t *testing.T, store repository.OrderStore, want int) {
+	t.Helper()
+	count, err := store.CountPendingOutbox(t.Context())
+	if err != nil || count != want {
+		t.Fatalf("pending outbox messages = %d, %v; want %d", count, err, want)
+	}
+}
+
+func expectStatus(t *testing.T, store repository.OrderStore, orderId string, want model.OrderStatus) {
+	t.Helper()
+	status, err := store.GetOrderStatusByID(t.Context(), orderId)
+	if err != nil || status != want {
+		t.Fatalf("order status = %q, %v; want %s", status, err, want)
+	}
+}
+
+func expectHistory(t *testing.T, store repository.OrderStore, userId string, orderId string, want ...model.OrderStatus) []model.StatusChange {
+	t.Helper()
+	history, err := store.GetOrderHistory(t.Context(), userId, orderId)
+	if err != nil {
+		t.Fatalf("GetOrderHistory: %v", err)
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d entries %+v, want %v", len(history), history, want)
+	}
+	for i, status := range want {
+		if history[i].ToStatus != status {
+			t.Fatalf("history[%d] = %s, want %s", i, history[i].ToStatus, status)
+		}
+	}
+	return history
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Бизнес-метрики order-service, доступны на /metrics
+var (
+	ordersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Orders created.",
+	})
+	ordersPaid = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_paid_total",
+		Help: "Orders moved to paid after a successful payment.",
+	})
+	ordersPaymentFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_payment_failed_total",
+		Help: "Orders moved to payment_failed, for example because of insufficient funds.",
+	})
+	ordersCaptureFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_capture_failed_total",
+		Help: "Fulfilled orders moved to capture_failed because the payment could not be captured.",
+	})
+	outboxPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "outbox_pending_messages",
+		Help: "transaction_outbox records waiting to be published to Kafka.",
+	})
+	outboxRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "outbox_rejected_total",
+		Help: "transaction_outbox records marked failed because they can never be published.",
+	})
+)
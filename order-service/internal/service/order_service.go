@@ -1,110 +1,220 @@
 package service
 
 import (
+	"common/bus"
+	"common/configutil"
+	"common/deadletter"
+	"common/events"
+	"common/money"
 	"context"
-	"encoding/json"
-	"github.com/segmentio/kafka-go"
+	"errors"
+	"fmt"
 	"log"
+	"order-service/internal/model"
 	"order-service/internal/repository"
 )
 
+// ErrInvalidAmount возвращается для заказа с неположительной суммой
+var ErrInvalidAmount = errors.New("order amount must be positive")
+
 type OrderService struct {
-	repo *repository.OrderRepository
+	repo       repository.OrderStore
+	quarantine deadletter.Store // результаты оплаты, которые не удалось разобрать
+	subscriber bus.Subscriber
+	topics     configutil.Topics
 }
 
-func NewOrderService(repo *repository.OrderRepository) *OrderService {
-	return &OrderService{repo}
+func NewOrderService(repo repository.OrderStore, quarantine deadletter.Store, subscriber bus.Subscriber, topics configutil.Topics) *OrderService {
+	return &OrderService{repo: repo, quarantine: quarantine, subscriber: subscriber, topics: topics}
 }
 
-func (svc *OrderService) CreateOrder(userId string, amount float64) (string, error) {
-	orderId, err := svc.repo.CreateOrder(userId, amount)
+func (svc *OrderService) CreateOrder(ctx context.Context, userId string, amount money.Amount) (string, error) {
+	if !amount.IsPositive() {
+		return "", ErrInvalidAmount
+	}
+
+	// Сообщение в Kafka отправит OutboxRelay, поэтому создание заказа не зависит от брокера
+	orderId, err := svc.repo.CreateOrder(ctx, userId, amount)
 	if err != nil {
 		return "", err
 	}
 
-	err = publishTransactionToKafka(orderId, userId, amount)
+	ordersCreated.Inc()
+	return orderId, nil
+}
+
+func (svc *OrderService) GetOrders(ctx context.Context, userId string) ([]map[string]interface{}, error) {
+	return svc.repo.GetOrders(ctx, userId)
+}
+
+func (svc *OrderService) GetOrderStatus(ctx context.Context, userId string, orderId string) (string, error) {
+	return svc.repo.GetOrderStatus(ctx, userId, orderId)
+}
+
+func (svc *OrderService) GetOrderHistory(ctx context.Context, userId string, orderId string) ([]model.StatusChange, error) {
+	return svc.repo.GetOrderHistory(ctx, userId, orderId)
+}
+
+// CancelOrder отменяет заказ. Для оплаченного заказа запрашивается возврат средств,
+// и заказ остается в refund_requested до подтверждения от payment-service.
+func (svc *OrderService) CancelOrder(ctx context.Context, userId string, orderId string) (model.OrderStatus, error) {
+	status, err := svc.repo.CancelOrder(ctx, userId, orderId)
 	if err != nil {
 		return "", err
 	}
 
-	err = svc.repo.UpdateTransactionStatus(orderId, "processed")
+	log.Printf("Order %s cancellation: %s", orderId, status)
+	return status, nil
+}
+
+// FulfillOrder отмечает оплаченный заказ выполненным. Зарезервированная сумма
+// списывается payment-service по команде из transaction_outbox.
+func (svc *OrderService) FulfillOrder(ctx context.Context, userId string, orderId string) (model.OrderStatus, error) {
+	status, err := svc.repo.FulfillOrder(ctx, userId, orderId)
 	if err != nil {
 		return "", err
 	}
 
-	return orderId, nil
+	log.Printf("Order %s fulfillment: %s", orderId, status)
+	return status, nil
 }
 
-func (svc *OrderService) GetOrders(userId string) ([]map[string]interface{}, error) {
-	return svc.repo.GetOrders(userId)
+// ConsumePaymentResults слушает результаты оплаты от payment-service
+// и переводит заказы в новые статусы, пока не отменен ctx
+func (svc *OrderService) ConsumePaymentResults(ctx context.Context) error {
+	return svc.subscriber.Subscribe(ctx, svc.topics.PaymentResults, events.Handler(svc.quarantine, svc.handlePaymentResult))
 }
 
-func (svc *OrderService) GetOrderStatus(userId string, orderId string) (string, error) {
-	return svc.repo.GetOrderStatus(userId, orderId)
+// handlePaymentResult разбирает и применяет одно событие из топика payment_results.
+// Ошибка разбора отправляет сообщение в карантин.
+func (svc *OrderService) handlePaymentResult(ctx context.Context, event events.Envelope) error {
+	err := event.Expect(
+		events.PaymentSucceeded, events.PaymentFailed,
+		events.RefundCompleted, events.RefundFailed,
+		events.CaptureCompleted, events.CaptureFailed,
+		events.HoldExpired,
+	)
+	if err != nil {
+		return err
+	}
+	var result events.PaymentResult
+	if err := event.DecodePayload(&result); err != nil {
+		return err
+	}
+
+	// Ошибка обработки повторяется по политике подписчика, а затем сообщение уходит в dead-letter топик
+	return svc.ProcessPaymentResult(ctx, event.Type, result)
 }
 
-func (svc *OrderService) ProcessTransactionMessageFromKafka() {
-	// Kafka reader для получения сообщений из топика
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{"kafka:9093"}, // хост Kafka
-		Topic:   "payment_transactions", // топик
-		GroupID: "order-service",        // группа подписчиков
-	})
-
-	for {
-		// Чтение сообщения из Kafka, используя контекст
-		ctx := context.Background() // создаём контекст
-		msg, err := reader.ReadMessage(ctx)
-		if err != nil {
-			log.Printf("error reading message from Kafka: %v", err)
-			continue
+// ProcessPaymentResult переводит заказ в новый статус по результату оплаты или возврата
+func (svc *OrderService) ProcessPaymentResult(ctx context.Context, eventType string, result events.PaymentResult) error {
+	orderId := result.OrderID
+	transition := repository.StatusTransition{
+		OrderID:     orderId,
+		Reason:      result.Reason,
+		SourceEvent: eventType,
+	}
+	switch eventType {
+	case events.PaymentSucceeded:
+		transition.To, transition.TransactionStatus = model.StatusPaid, "succeeded"
+	case events.PaymentFailed:
+		// Причина отказа (например, insufficient_funds) сохраняется как статус транзакции
+		transition.To, transition.TransactionStatus = model.StatusPaymentFailed, "failed"
+		if result.Reason != "" {
+			transition.TransactionStatus = result.Reason
 		}
-
-		var message map[string]interface{}
-		err = json.Unmarshal(msg.Value, &message)
-		if err != nil {
-			log.Printf("error unmarshaling message: %v", err)
-			continue
+	case events.RefundCompleted:
+		transition.To, transition.TransactionStatus = model.StatusRefunded, "refunded"
+	case events.RefundFailed:
+		// Заказ остается в refund_requested, возврат требует ручного разбора
+		log.Printf("Refund %s for order %s failed: %s", result.TransactionID, orderId, result.Reason)
+		return nil
+	case events.HoldExpired:
+		// Заказ не был выполнен, пока сумма оставалась зарезервированной
+		transition.To, transition.TransactionStatus = model.StatusCancelled, "expired"
+	case events.CaptureCompleted:
+		log.Printf("Payment for order %s captured", orderId)
+		return nil
+	case events.CaptureFailed:
+		// Заказ уже выполнен, а списать оплату не удалось, например холд истек раньше списания.
+		// Заказ переходит в capture_failed, чтобы его нашли и разобрали вручную.
+		log.Printf("Capture %s for order %s failed: %s", result.TransactionID, orderId, result.Reason)
+		transition.To, transition.TransactionStatus = model.StatusCaptureFailed, "capture_failed"
+		if result.Reason != "" {
+			transition.TransactionStatus = result.Reason
 		}
+	default:
+		return fmt.Errorf("unknown payment result type %q", eventType)
+	}
 
-		// Обработка транзакции
-		transactionId := message["transaction_id"].(string)
-		userId := message["user_id"].(string)
-		amount := message["amount"].(float64)
+	changed, err := svc.repo.TransitionOrderStatus(ctx, transition)
+	if errors.Is(err, model.ErrIllegalTransition) {
+		switch eventType {
+		case events.PaymentSucceeded:
+			// Оплата прошла после отмены заказа: возвращаем средства
+			return svc.compensateLatePayment(ctx, orderId)
+		case events.HoldExpired:
+			// Заказ успели выполнить или отменить, его списание или возврат уже запрошены
+			log.Printf("Ignoring expired hold for order %s: %v", orderId, err)
+			return nil
+		}
+		return svc.ignoreIfClosed(ctx, eventType, orderId, err)
+	}
+	if err != nil {
+		return fmt.Errorf("could not apply %s to order %s: %v", eventType, orderId, err)
+	}
 
-		err = svc.repo.ProcessTransaction(transactionId, userId, amount)
-		if err != nil {
-			log.Printf("error processing transaction: %v", err)
-		} else {
-			log.Printf("Processed transaction %s", transactionId)
+	if changed {
+		log.Printf("Order %s is %s", orderId, transition.To)
+		// Повторная доставка события не меняет статус и не учитывается
+		switch transition.To {
+		case model.StatusPaid:
+			ordersPaid.Inc()
+		case model.StatusPaymentFailed:
+			ordersPaymentFailed.Inc()
+		case model.StatusCaptureFailed:
+			ordersCaptureFailed.Inc()
 		}
+	} else {
+		log.Printf("%s for order %s already applied", eventType, orderId)
 	}
+	return nil
 }
 
-func publishTransactionToKafka(orderId string, userId string, amount float64) error {
-	writer := kafka.NewWriter(kafka.WriterConfig{
-		Brokers: []string{"kafka:9093"},
-		Topic:   "payment_transactions",
-	})
-
-	message := map[string]interface{}{
-		"transaction_id": orderId,
-		"user_id":        userId,
-		"amount":         amount,
+// compensateLatePayment запрашивает возврат оплаты, пришедшей для уже отмененного заказа
+func (svc *OrderService) compensateLatePayment(ctx context.Context, orderId string) error {
+	status, err := svc.repo.GetOrderStatusByID(ctx, orderId)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case model.StatusCancelled:
+	case model.StatusRefundRequested, model.StatusRefunded:
+		// Возврат уже запрошен или выполнен, оплату доставили повторно
+		log.Printf("Refund for order %s already requested, ignoring repeated %s", orderId, events.PaymentSucceeded)
+		return nil
+	default:
+		return fmt.Errorf("could not apply %s to order %s in status %s", events.PaymentSucceeded, orderId, status)
 	}
 
-	body, err := json.Marshal(message)
-	if err != nil {
+	if err := svc.repo.RequestRefund(ctx, orderId); err != nil {
 		return err
 	}
+	log.Printf("Order %s was paid after cancellation, refund requested", orderId)
+	return nil
+}
 
-	err = writer.WriteMessages(context.Background(), kafka.Message{
-		Value: body,
-	})
+// ignoreIfClosed пропускает результат, который пришел, когда заказ уже закрыт,
+// например отказ в оплате после отмены заказа или повторное подтверждение возврата.
+// Для незакрытого заказа возвращает исходную ошибку перехода, чтобы результат разобрали.
+func (svc *OrderService) ignoreIfClosed(ctx context.Context, eventType string, orderId string, transitionErr error) error {
+	status, err := svc.repo.GetOrderStatusByID(ctx, orderId)
 	if err != nil {
 		return err
 	}
-
-	log.Printf("Sent transaction %s to Kafka", orderId)
+	if !model.IsClosed(status) {
+		return fmt.Errorf("could not apply %s to order %s: %v", eventType, orderId, transitionErr)
+	}
+	log.Printf("Ignoring %s for order %s in status %s", eventType, orderId, status)
 	return nil
 }
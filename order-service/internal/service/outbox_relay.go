@@ -0,0 +1,157 @@
+package service
+
+import (
+	"common/bus"
+	"common/configutil"
+	"common/events"
+	"common/money"
+	"common/tracing"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"order-service/internal/repository"
+	"time"
+)
+
+const (
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 100
+)
+
+// OutboxRelay периодически вычитывает записи transaction_outbox в статусе 'pending',
+// публикует их в шину и помечает как 'sent'
+type OutboxRelay struct {
+	repo      repository.OrderStore
+	publisher bus.Publisher
+	topics    map[string]string // топик для каждого типа событий outbox
+}
+
+// NewOutboxRelay создает relay, публикующий через publisher. Трассировку каждой записи
+// relay продолжает сам, поэтому publisher не должен быть обернут tracing.Publisher:
+// тот отнес бы всю пачку к одной трассировке.
+func NewOutboxRelay(repo repository.OrderStore, publisher bus.Publisher, topics configutil.Topics) *OutboxRelay {
+	// Топик задается в каждом сообщении в зависимости от типа события
+	return &OutboxRelay{
+		repo:      repo,
+		publisher: publisher,
+		topics: map[string]string{
+			repository.OutboxPaymentRequested: topics.PaymentTransactions,
+			repository.OutboxRefundRequested:  topics.PaymentRefunds,
+			repository.OutboxCaptureRequested: topics.PaymentCaptures,
+		},
+	}
+}
+
+// Run опрашивает outbox, пока не отменен ctx
+func (relay *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sent, err := relay.RelayOnce(ctx)
+		if err != nil {
+			log.Printf("outbox relay error: %v", err)
+		}
+		if sent > 0 {
+			log.Printf("Outbox relay sent %d messages", sent)
+		}
+		relay.observeBacklog(ctx)
+	}
+}
+
+// observeBacklog обновляет метрику числа записей outbox, ожидающих отправки
+func (relay *OutboxRelay) observeBacklog(ctx context.Context) {
+	pending, err := relay.repo.CountPendingOutbox(ctx)
+	if err != nil {
+		log.Printf("outbox relay error: %v", err)
+		return
+	}
+	outboxPending.Set(float64(pending))
+}
+
+// RelayOnce отправляет одну пачку pending-записей и возвращает число отправленных.
+// Вся пачка публикуется одним вызовом Publish: шина сама собирает ее в запросы к брокеру
+// и повторяет их при ошибках, а неотправленная пачка будет повторена на следующем тике.
+func (relay *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	return relay.repo.RelayPendingOutbox(ctx, outboxBatchSize, func(batch []repository.OutboxMessage) (map[string]error, error) {
+		return relay.publish(ctx, batch)
+	})
+}
+
+// publish отправляет пачку записей outbox в шину. Каждая запись публикуется в спане,
+// продолжающем трассировку создавшего ее запроса. Записи, из которых нельзя собрать
+// сообщение, не отправляются и возвращаются в rejected, чтобы не блокировать остальные.
+func (relay *OutboxRelay) publish(ctx context.Context, batch []repository.OutboxMessage) (rejected map[string]error, err error) {
+	messages := make([]bus.Message, 0, len(batch))
+	spans := make([]trace.Span, 0, len(batch))
+	defer func() {
+		for _, span := range spans {
+			tracing.End(span, err)
+		}
+	}()
+
+	rejected = map[string]error{}
+	sending := make([]repository.OutboxMessage, 0, len(batch))
+	for _, msg := range batch {
+		message, err := relay.message(msg)
+		if err != nil {
+			log.Printf("Rejected outbox message %s: %v", msg.TransactionID, err)
+			rejected[msg.TransactionID] = err
+			outboxRejected.Inc()
+			continue
+		}
+		msgCtx, span := tracing.StartPublish(tracing.Extract(ctx, msg.TraceContext), message.Topic, 1)
+		spans = append(spans, span)
+		message.Headers = tracing.Inject(msgCtx)
+		messages = append(messages, message)
+		sending = append(sending, msg)
+	}
+	if len(messages) == 0 {
+		return rejected, nil
+	}
+
+	if err := relay.publisher.Publish(ctx, messages...); err != nil {
+		return rejected, fmt.Errorf("error sending %d outbox messages: %v", len(messages), err)
+	}
+	for _, msg := range sending {
+		log.Printf("Sent %s %s", msg.EventType, msg.TransactionID)
+	}
+	return rejected, nil
+}
+
+// message собирает сообщение шины для записи outbox
+func (relay *OutboxRelay) message(msg repository.OutboxMessage) (bus.Message, error) {
+	topic, ok := relay.topics[msg.EventType]
+	if !ok {
+		return bus.Message{}, fmt.Errorf("unknown outbox event type %q", msg.EventType)
+	}
+
+	// ID события выводится из ID записи, поэтому повторная отправка записи не порождает новое событие
+	event, err := events.New(msg.EventType, msg.TransactionID, msg.OrderID, events.TransactionCommand{
+		TransactionID: msg.TransactionID,
+		OrderID:       msg.OrderID,
+		UserID:        msg.UserID,
+		Amount:        msg.Amount,
+		Currency:      money.Currency,
+	})
+	if err != nil {
+		return bus.Message{}, err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return bus.Message{}, fmt.Errorf("error marshaling message: %v", err)
+	}
+
+	// Ключ — пользователь: команды одного типа по его счету попадают в одну партицию своего топика
+	// и обрабатываются по порядку. Списания, возвраты и подтверждения идут в разные топики,
+	// поэтому порядок между командами разных типов не гарантируется.
+	return bus.Message{Topic: topic, Key: []byte(msg.UserID), Value: body}, nil
+}
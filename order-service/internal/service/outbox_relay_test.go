@@ -0,0 +1,53 @@
+package service
+
+import (
+	"common/bus"
+	"common/configutil"
+	"common/money"
+	"context"
+	"order-service/internal/model"
+	"order-service/internal/repository"
+	"testing"
+)
+
+// poisonStore подмешивает в каждую пачку outbox запись с неизвестным типом события
+type poisonStore struct {
+	*repository.MemoryOrderRepository
+	rejected map[string]error
+}
+
+func (store *poisonStore) RelayPendingOutbox(ctx context.Context, limit int, publish repository.OutboxPublisher) (int, error) {
+	return store.MemoryOrderRepository.RelayPendingOutbox(ctx, limit, func(batch []repository.OutboxMessage) (map[string]error, error) {
+		poison := repository.OutboxMessage{TransactionID: "poison", OrderID: "poison", EventType: "unknown"}
+		rejected, err := publish(append([]repository.OutboxMessage{poison}, batch...))
+		store.rejected = rejected
+		return rejected, err
+	})
+}
+
+func TestRelaySkipsUnpublishableMessage(t *testing.T) {
+	store := &poisonStore{MemoryOrderRepository: repository.NewMemoryOrderRepository()}
+	orderId, err := store.CreateOrder(t.Context(), "user", money.FromMinor(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memoryBus := bus.NewMemoryBus()
+	topics := configutil.DefaultTopics()
+	relay := NewOutboxRelay(store, memoryBus, topics)
+
+	sent, err := relay.RelayOnce(t.Context())
+	if sent != 1 || err != nil {
+		t.Fatalf("RelayOnce = %d, %v; want 1", sent, err)
+	}
+	if _, ok := store.rejected["poison"]; !ok || len(store.rejected) != 1 {
+		t.Fatalf("rejected = %v, want only the poison message", store.rejected)
+	}
+	if messages := memoryBus.Messages(topics.PaymentTransactions); len(messages) != 1 {
+		t.Fatalf("published %d payment requests, want 1", len(messages))
+	}
+	status, err := store.GetOrderStatusByID(t.Context(), orderId)
+	if err != nil || status != model.StatusAwaitingPayment {
+		t.Fatalf("order status = %s, %v; want %s", status, err, model.StatusAwaitingPayment)
+	}
+}
@@ -1,14 +1,27 @@
 package main
 
 import (
+	"common/bus"
+	"common/deadletter"
+	"common/health"
+	"common/httpserver"
+	"common/metrics"
+	"common/tracing"
+	"context"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"
 	"log"
 	"net/http"
+	"order-service/app"
 	_ "order-service/docs"
-	"order-service/internal/handler"
+	"order-service/internal/config"
 	"order-service/internal/repository"
-	"order-service/internal/service"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 // @title Order Service API
@@ -17,26 +30,127 @@ import (
 // @host localhost:8083
 // @BasePath /
 func main() {
-	db, err := repository.InitDB()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Не удалось загрузить конфигурацию: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Контекст трассировки передается между сервисами всегда, спаны экспортируются по настройкам
+	shutdownTracing, err := tracing.Setup(ctx, "order-service", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Не удалось настроить трассировку: %v", err)
+	}
+
+	// Postgres и Kafka могут подниматься дольше сервиса: ждем их с повторами, но не дольше StartupTimeout
+	startupCtx, cancelStartup := context.WithTimeout(ctx, time.Duration(cfg.StartupTimeout))
+	defer cancelStartup()
+	db, err := repository.InitDB(startupCtx, cfg.Database.ConnString())
 	if err != nil {
 		log.Fatalf("Не удалось инициализировать базу данных: %v", err)
 	}
 
-	// Инициализация сервисов и обработчиков
-	orderRepo := repository.NewOrderRepository(db)
-	orderSvc := service.NewOrderService(orderRepo)
-	orderHandler := handler.NewOrderHandler(orderSvc)
+	// "order-service migrate <command>" применяет или откатывает миграции и завершает работу
+	migrator, err := repository.NewMigrator(db)
+	if err != nil {
+		log.Fatalf("Не удалось загрузить миграции: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrator.RunCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Ошибка миграции: %v", err)
+		}
+		return
+	}
+	if cfg.AutoMigrate {
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Fatalf("Не удалось применить миграции: %v", err)
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+	}
+	// Сервис не запускается на схеме другой версии
+	if err := migrator.Check(); err != nil {
+		log.Fatalf("Схема базы данных не совпадает с версией сервиса: %v", err)
+	}
+
+	// Инициализация сервиса поверх Postgres и Kafka
+	checkKafka := func(ctx context.Context) error { return bus.CheckBrokers(ctx, cfg.Kafka.Brokers) }
+	if err := health.Wait(startupCtx, "kafka", checkKafka); err != nil {
+		log.Fatalf("Kafka недоступна: %v", err)
+	}
+
+	// Один продюсер на весь сервис: outbox relay, dead-letter топик и admin API публикуют через него
+	publisher, err := bus.NewKafkaPublisher(cfg.Kafka.Brokers, bus.ProducerConfig{
+		Acks:         cfg.Kafka.Producer.Acks,
+		BatchSize:    cfg.Kafka.Producer.BatchSize,
+		BatchTimeout: time.Duration(cfg.Kafka.Producer.BatchTimeout),
+		Compression:  cfg.Kafka.Producer.Compression,
+		MaxAttempts:  cfg.Kafka.Producer.MaxAttempts,
+	})
+	if err != nil {
+		log.Fatalf("Не удалось создать продюсер Kafka: %v", err)
+	}
+	deadLetters := deadletter.NewPostgresStore(db, repository.DeadLettersTable)
+	orderApp := app.New(repository.NewOrderRepository(db), deadLetters, publisher, bus.NewKafkaSubscriber(cfg.Kafka.Brokers, cfg.Kafka.ConsumerGroup, cfg.Kafka.ConsumerWorkers), app.Config{
+		Topics: cfg.Topics,
+		// Сообщение, которое не удалось обработать за несколько попыток, уходит в dead-letter топик
+		Retry: bus.RetryPolicy{
+			MaxAttempts:     cfg.Kafka.Retry.MaxAttempts,
+			InitialBackoff:  time.Duration(cfg.Kafka.Retry.InitialBackoff),
+			MaxBackoff:      time.Duration(cfg.Kafka.Retry.MaxBackoff),
+			DeadLetterTopic: cfg.Kafka.DeadLetterTopic,
+		},
+	})
+
+	// Фоновая отправка транзакций из outbox и обработка результатов оплаты от payment-service
+	orderApp.Start(ctx)
+
+	// Сервис готов, когда доступны база и Kafka и работают подписчики
+	readiness := health.NewChecker()
+	readiness.Add("database", db.PingContext)
+	readiness.Add("kafka", checkKafka)
+	readiness.Add("consumers", orderApp.CheckConsumers)
 
 	r := mux.NewRouter()
+	// Время обработки запросов по маршрутам для /metrics
+	r.Use(metrics.Middleware)
+	r.Use(tracing.Middleware)
 
 	r.PathPrefix("/swagger/").Handler(http.StripPrefix("/swagger", swaggerFiles.Handler))
 
+	metrics.RegisterDB(db, "order-service")
+	r.Handle("/metrics", promhttp.Handler())
+	r.HandleFunc("/healthz", health.Live).Methods("GET")
+	r.Handle("/readyz", readiness).Methods("GET")
+
 	// Маршруты API для заказов
-	r.HandleFunc("/order/{user_id}", orderHandler.CreateOrder).Methods("POST")
-	r.HandleFunc("/orders/{user_id}", orderHandler.GetOrders).Methods("GET")
-	r.HandleFunc("/order/{user_id}/{order_id}", orderHandler.GetOrderStatus).Methods("GET")
+	orderApp.Routes(r)
+
+	// Запуск сервера. По SIGINT/SIGTERM сервер перестает принимать запросы и дожидается начатых
+	addr := fmt.Sprintf(":%d", cfg.Port)
+	log.Printf("Order service started on %s", addr)
+	serveErr := httpserver.Serve(ctx, addr, tracing.Handler(r), time.Duration(cfg.ShutdownTimeout))
 
-	// Запуск сервера
-	log.Println("Order service started on :8083")
-	log.Fatal(http.ListenAndServe(":8083", r))
+	// Остановка в обратном порядке: фоновые задачи фиксируют обработанные сообщения,
+	// продюсер отправляет накопленные, и только потом закрывается база
+	log.Printf("Order service stopping")
+	stop()
+	orderApp.Wait()
+	if err := publisher.Close(); err != nil {
+		log.Printf("Failed to close Kafka producer: %v", err)
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+	if serveErr != nil {
+		log.Fatalf("HTTP server failed: %v", serveErr)
+	}
+	log.Printf("Order service stopped")
 }
@@ -0,0 +1,142 @@
+// Package app собирает payment-service из хранилища платежей и шины сообщений.
+// Используется из main и из сквозных тестов, которым нужен сервис без Postgres и Kafka.
+package app
+
+import (
+	"common/bus"
+	"common/configutil"
+	"common/deadletter"
+	"common/health"
+	"common/tracing"
+	"context"
+	"github.com/gorilla/mux"
+	"log"
+	"payment-service/internal/handler"
+	"payment-service/internal/repository"
+	"payment-service/internal/service"
+	"sync"
+	"time"
+)
+
+// Config настройки обмена сообщениями payment-service
+type Config struct {
+	Topics configutil.Topics
+	// Retry повторы обработки команд, после которых сообщение уходит в Retry.DeadLetterTopic
+	Retry bus.RetryPolicy
+	// HoldTTL время, через которое холд по заказу снимается
+	HoldTTL time.Duration
+}
+
+// App payment-service: HTTP-обработчики, обработка команд order-service и снятие истекших холдов
+type App struct {
+	svc         *service.PaymentService
+	handler     *handler.PaymentHandler
+	admin       *deadletter.Handler
+	deadLetters deadletter.Store
+	subscriber  bus.Subscriber
+	cfg         Config
+	background  sync.WaitGroup
+	consumers   health.Workers
+}
+
+// New собирает сервис поверх store, читающий команды через subscriber
+// и публикующий результаты оплаты через publisher. Команды, которые не удалось
+// разобрать или обработать за cfg.Retry.MaxAttempts попыток, сохраняются в deadLetters.
+func New(store repository.PaymentStore, deadLetters deadletter.Store, publisher bus.Publisher, subscriber bus.Subscriber, cfg Config) *App {
+	// Сообщения переносят контекст трассировки между сервисами
+	publisher, subscriber = tracing.Publisher(publisher), tracing.Subscriber(subscriber)
+	svc := service.NewPaymentService(store, deadLetters, publisher, bus.WithRetry(subscriber, cfg.Retry, publisher), cfg.Topics, cfg.HoldTTL)
+	return &App{
+		svc:         svc,
+		handler:     handler.NewPaymentHandler(svc),
+		admin:       deadletter.NewHandler(deadletter.NewAdmin(deadLetters, publisher)),
+		deadLetters: deadLetters,
+		subscriber:  subscriber,
+		cfg:         cfg,
+	}
+}
+
+// NewInMemory собирает сервис с хранилищами в памяти
+func NewInMemory(publisher bus.Publisher, subscriber bus.Subscriber, cfg Config) *App {
+	return New(repository.NewMemoryPaymentRepository(), deadletter.NewMemoryStore(), publisher, subscriber, cfg)
+}
+
+// Routes регистрирует маршруты API платежей
+func (app *App) Routes(r *mux.Router) {
+	h := app.handler
+	r.HandleFunc("/payment/{user_id}", h.CreateAccount).Methods("POST")
+	r.HandleFunc("/payment/{user_id}", h.GetBalance).Methods("GET")
+	r.HandleFunc("/payment/{user_id}/deposit", h.Deposit).Methods("PUT")
+	r.HandleFunc("/payment/{user_id}/withdraw", h.Withdraw).Methods("PUT")
+	r.HandleFunc("/payment/{user_id}/transfer", h.Transfer).Methods("POST")
+	r.HandleFunc("/payment/{user_id}/transactions", h.ListTransactions).Methods("GET")
+
+	// Admin API через api-gateway не публикуется, каждый запрос передает имя администратора.
+	// Журнал проводок: корректировки и сверка для финансового аудита
+	r.HandleFunc("/admin/payment/{user_id}/adjustments", h.RequireAdmin(h.Adjust)).Methods("POST")
+	r.HandleFunc("/admin/payment/{user_id}/audit", h.RequireAdmin(h.AuditAccount)).Methods("GET")
+	r.HandleFunc("/admin/ledger/drift", h.RequireAdmin(h.FindLedgerDrift)).Methods("GET")
+
+	// Разбор отложенных сообщений
+	r.PathPrefix("/admin/dead-letters").Handler(app.admin)
+}
+
+// Start запускает обработку команд order-service, снятие истекших холдов
+// и сохранение сообщений из dead-letter топика до отмены ctx
+func (app *App) Start(ctx context.Context) {
+	consumers := map[string]func(context.Context) error{
+		"transactions": app.svc.ConsumeTransactions,
+		"refunds":      app.svc.ConsumeRefunds,
+		"captures":     app.svc.ConsumeCaptures,
+	}
+	for name, consume := range consumers {
+		app.consume(name+" consumer", func() error {
+			return consume(ctx)
+		})
+	}
+	app.run(func() { app.svc.RunHoldExpiry(ctx) })
+	app.consume("dead letter collector", func() error {
+		return deadletter.Collect(ctx, app.subscriber, app.cfg.Retry.DeadLetterTopic, app.deadLetters)
+	})
+}
+
+// CheckConsumers проверка готовности: все подписчики запущены и работают
+func (app *App) CheckConsumers(ctx context.Context) error {
+	return app.consumers.Check(ctx)
+}
+
+// Wait ждет, пока фоновые задачи остановятся после отмены контекста Start.
+// Подписчики перед остановкой дообрабатывают начатые сообщения и фиксируют смещения.
+func (app *App) Wait() {
+	app.background.Wait()
+}
+
+// run запускает фоновую задачу, которую дожидается Wait
+func (app *App) run(task func()) {
+	app.background.Add(1)
+	go func() {
+		defer app.background.Done()
+		task()
+	}()
+}
+
+// consume запускает подписчика name в фоне и отмечает, пока он работает
+func (app *App) consume(name string, subscribe func() error) {
+	app.consumers.Started(name)
+	app.run(func() {
+		defer app.consumers.Stopped(name)
+		if err := subscribe(); err != nil {
+			log.Printf("%s stopped: %v", name, err)
+		}
+	})
+}
+
+// DeadLetters возвращает хранилище сообщений, отложенных без обработки
+func (app *App) DeadLetters() deadletter.Store {
+	return app.deadLetters
+}
+
+// ExpireHolds снимает истекшие холды, не дожидаясь очередного опроса
+func (app *App) ExpireHolds(ctx context.Context) (int, error) {
+	return app.svc.ExpireHoldsOnce(ctx)
+}
@@ -15,8 +15,422 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/dead-letters": {
+            "get": {
+                "description": "Сообщения, которые не удалось разобрать или обработать, начиная с новых",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Список отложенных сообщений",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Администратор",
+                        "name": "X-Admin-User",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "quarantined или dead_lettered",
+                        "name": "kind",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "pending, requeued или discarded",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы, по умолчанию 50, не больше 500",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/deadletter.MessageSummary"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/dead-letters/{id}": {
+            "get": {
+                "description": "Содержимое сообщения и журнал действий с ним. Просмотр записывается в журнал",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Отложенное сообщение",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Администратор",
+                        "name": "X-Admin-User",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID сообщения",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.MessageDetails"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/dead-letters/{id}/discard": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Отбросить сообщение",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Администратор",
+                        "name": "X-Admin-User",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID сообщения",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Причина",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.DiscardRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.MessageSummary"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/dead-letters/{id}/requeue": {
+            "post": {
+                "description": "Публикует сообщение в исходный топик, исходным или исправленным, и отмечает его возвращенным",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Вернуть сообщение в топик",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Администратор",
+                        "name": "X-Admin-User",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID сообщения",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Причина и исправленное сообщение",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.RequeueRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.MessageSummary"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/deadletter.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/ledger/drift": {
+            "get": {
+                "description": "Возвращает аккаунты, баланс которых расходится с журналом, и несбалансированные проводки",
+                "tags": [
+                    "ledger"
+                ],
+                "summary": "Найти расхождения с журналом проводок",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Администратор",
+                        "name": "X-Admin-User",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.LedgerDrift"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/payment/{user_id}/adjustments": {
+            "post": {
+                "description": "Зачисляет или списывает сумму с записью корректирующей проводки в журнал",
+                "tags": [
+                    "ledger"
+                ],
+                "summary": "Ручная корректировка баланса",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Администратор",
+                        "name": "X-Admin-User",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Сумма и основание корректировки",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.AdjustmentRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/payment/{user_id}/audit": {
+            "get": {
+                "description": "Возвращает сохраненный баланс, баланс по журналу проводок и расхождение между ними",
+                "tags": [
+                    "ledger"
+                ],
+                "summary": "Сверить баланс с журналом проводок",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Администратор",
+                        "name": "X-Admin-User",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/repository.AccountAudit"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/payment/{user_id}": {
             "get": {
+                "description": "Возвращает баланс по журналу проводок и доступный баланс за вычетом холдов по заказам",
                 "tags": [
                     "payment"
                 ],
@@ -34,53 +448,245 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handler.PaymentStruct"
+                            "$ref": "#/definitions/handler.BalanceResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "tags": [
+                    "payment"
+                ],
+                "summary": "Создать платежный аккаунт",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/payment/{user_id}/deposit": {
+            "put": {
+                "tags": [
+                    "payment"
+                ],
+                "summary": "Пополнить баланс",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Сумма пополнения",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.DepositRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/payment/{user_id}/transactions": {
+            "get": {
+                "description": "Возвращает пополнения, оплаты заказов, возвраты и корректировки, начиная с новых. Для следующей страницы передайте next_cursor в параметре cursor",
+                "tags": [
+                    "payment"
+                ],
+                "summary": "История операций по счету",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID пользователя",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало периода включительно (RFC 3339 или YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец периода не включительно (RFC 3339 или YYYY-MM-DD)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Курсор следующей страницы",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы, по умолчанию 50, не более 200",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.TransactionPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/handler.PaymentStruct"
+                            "$ref": "#/definitions/handler.PaymentResponse"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/payment/{user_id}/transfer": {
             "post": {
+                "description": "Списывает сумму с баланса отправителя и зачисляет получателю в одной транзакции. Повтор с тем же idempotency_key не выполняет перевод второй раз",
                 "tags": [
                     "payment"
                 ],
-                "summary": "Создать платежный аккаунт",
+                "summary": "Перевести средства другому пользователю",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "ID пользователя",
+                        "description": "ID отправителя",
                         "name": "user_id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Получатель, сумма и ключ идемпотентности",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.TransferRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.TransferResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/handler.PaymentStruct"
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/handler.PaymentStruct"
+                            "$ref": "#/definitions/handler.PaymentResponse"
                         }
                     }
                 }
             }
         },
-        "/payment/{user_id}/deposit": {
+        "/payment/{user_id}/withdraw": {
             "put": {
+                "description": "Списывает сумму с баланса и возвращает новый баланс. Вывод сверх баланса отклоняется",
                 "tags": [
                     "payment"
                 ],
-                "summary": "Пополнить баланс",
+                "summary": "Вывести средства",
                 "parameters": [
                     {
                         "type": "string",
@@ -90,12 +696,12 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Сумма пополнения",
+                        "description": "Сумма вывода",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handler.PaymentStruct"
+                            "$ref": "#/definitions/handler.WithdrawRequest"
                         }
                     }
                 ],
@@ -103,19 +709,31 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handler.PaymentStruct"
+                            "$ref": "#/definitions/handler.PaymentResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/handler.PaymentStruct"
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.PaymentResponse"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/handler.PaymentStruct"
+                            "$ref": "#/definitions/handler.PaymentResponse"
                         }
                     }
                 }
@@ -123,19 +741,200 @@ const docTemplate = `{
         }
     },
     "definitions": {
-        "handler.PaymentStruct": {
+        "deadletter.AuditEntryView": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "value": {
+                    "description": "исправленное сообщение при возврате",
+                    "type": "object"
+                }
+            }
+        },
+        "deadletter.DiscardRequest": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "deadletter.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "deadletter.MessageDetails": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "history": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/deadletter.AuditEntryView"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "resolved_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "topic": {
+                    "type": "string"
+                },
+                "value": {
+                    "description": "JSON-сообщение или строка, если это не JSON",
+                    "type": "object"
+                }
+            }
+        },
+        "deadletter.MessageSummary": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "resolved_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "topic": {
+                    "type": "string"
+                }
+            }
+        },
+        "deadletter.RequeueRequest": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string"
+                },
+                "value": {
+                    "description": "исправленное сообщение, по умолчанию исходное",
+                    "type": "object"
+                }
+            }
+        },
+        "handler.AdjustmentRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Положительная сумма зачисляется, отрицательная списывается",
+                    "type": "number"
+                },
+                "currency": {
+                    "description": "Необязательно, только RUB",
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "Основание корректировки",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.BalanceResponse": {
+            "type": "object",
+            "properties": {
+                "available": {
+                    "description": "Доступно для оплаты, вывода и переводов",
+                    "type": "number"
+                },
+                "balance": {
+                    "description": "Совпадает с ledger, оставлено для совместимости",
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "held": {
+                    "description": "Сумма активных холдов по заказам",
+                    "type": "number"
+                },
+                "ledger": {
+                    "description": "Баланс по журналу проводок",
+                    "type": "number"
+                },
+                "success": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "handler.DepositRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Не более двух знаков после запятой",
+                    "type": "number"
+                },
+                "currency": {
+                    "description": "Необязательно, только RUB",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.PaymentResponse": {
             "type": "object",
             "properties": {
                 "amount": {
-                    "description": "Для запросов пополнения",
+                    "description": "Для операций с суммами",
                     "type": "number"
                 },
                 "balance": {
-                    "description": "Для ответов с балансом",
+                    "description": "Для возврата баланса",
                     "type": "number"
                 },
+                "currency": {
+                    "description": "Валюта сумм",
+                    "type": "string"
+                },
                 "message": {
-                    "description": "Для ошибок",
+                    "description": "Сообщения об ошибках",
                     "type": "string"
                 },
                 "success": {
@@ -143,6 +942,151 @@ const docTemplate = `{
                     "type": "boolean"
                 }
             }
+        },
+        "handler.TransferRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Не более двух знаков после запятой",
+                    "type": "number"
+                },
+                "currency": {
+                    "description": "Необязательно, только RUB",
+                    "type": "string"
+                },
+                "idempotency_key": {
+                    "description": "Ключ, по которому повтор запроса не выполняет перевод второй раз",
+                    "type": "string"
+                },
+                "recipient_id": {
+                    "description": "ID пользователя-получателя",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.WithdrawRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Не более двух знаков после запятой",
+                    "type": "number"
+                },
+                "currency": {
+                    "description": "Необязательно, только RUB",
+                    "type": "string"
+                }
+            }
+        },
+        "repository.AccountAudit": {
+            "type": "object",
+            "properties": {
+                "balance": {
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "drift": {
+                    "type": "number"
+                },
+                "entries": {
+                    "type": "integer"
+                },
+                "ledger_balance": {
+                    "type": "number"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "repository.AccountTransaction": {
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "type": "string"
+                },
+                "amount": {
+                    "type": "number"
+                },
+                "balance_after": {
+                    "type": "number"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "order_id": {
+                    "type": "string"
+                },
+                "transaction_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "repository.LedgerDrift": {
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/repository.AccountAudit"
+                    }
+                },
+                "unbalanced_transactions": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "service.TransactionPage": {
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "type": "string"
+                },
+                "next_cursor": {
+                    "type": "string"
+                },
+                "transactions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/repository.AccountTransaction"
+                    }
+                }
+            }
+        },
+        "service.TransferResult": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "balance": {
+                    "description": "Баланс отправителя после перевода",
+                    "type": "number"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "recipient_id": {
+                    "type": "string"
+                },
+                "replayed": {
+                    "description": "Перевод с этим ключом уже был выполнен раньше",
+                    "type": "boolean"
+                },
+                "transfer_id": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
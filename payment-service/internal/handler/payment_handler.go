@@ -1,10 +1,17 @@
 package handler
 
 import (
+	"common/deadletter"
+	"common/money"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
+	"payment-service/internal/repository"
 	"payment-service/internal/service"
+	"strconv"
+	"time"
 )
 
 type PaymentHandler struct {
@@ -12,31 +19,55 @@ type PaymentHandler struct {
 }
 
 type PaymentResponse struct {
-	Amount  float64 `json:"amount,omitempty"`  // Для операций с суммами
-	Balance float64 `json:"balance,omitempty"` // Для возврата баланса
-	Message string  `json:"message,omitempty"` // Сообщения об ошибках
-	Success bool    `json:"success"`           // Статус операции
+	Amount   money.Amount `json:"amount" swaggertype:"number"`  // Для операций с суммами, нулевая сумма не опускается
+	Balance  money.Amount `json:"balance" swaggertype:"number"` // Для возврата баланса, нулевой баланс не опускается
+	Currency string       `json:"currency,omitempty"`           // Валюта сумм
+	Message  string       `json:"message,omitempty"`            // Сообщения об ошибках
+	Success  bool         `json:"success"`                      // Статус операции
+}
+
+// BalanceResponse баланс счета по журналу проводок и доступная для списания часть
+type BalanceResponse struct {
+	Balance   money.Amount `json:"balance" swaggertype:"number"`   // Совпадает с ledger, оставлено для совместимости
+	Ledger    money.Amount `json:"ledger" swaggertype:"number"`    // Баланс по журналу проводок
+	Held      money.Amount `json:"held" swaggertype:"number"`      // Сумма активных холдов по заказам
+	Available money.Amount `json:"available" swaggertype:"number"` // Доступно для оплаты, вывода и переводов
+	Currency  string       `json:"currency"`
+	Success   bool         `json:"success"`
 }
 
 func NewPaymentHandler(svc *service.PaymentService) *PaymentHandler {
 	return &PaymentHandler{svc}
 }
 
+// RequireAdmin пропускает к next только запросы с именем администратора в заголовке
+// X-Admin-User, как и admin API отложенных сообщений
+func (h *PaymentHandler) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(deadletter.ActorHeader) == "" {
+			sendResponse(w, PaymentResponse{Message: service.ErrActorRequired.Error()}, http.StatusBadRequest)
+			return
+		}
+		next(w, r)
+	}
+}
+
 // CreateAccount godoc
 // @Summary Создать платежный аккаунт
 // @Tags payment
 // @Param user_id path string true "ID пользователя"
 // @Success 201 {object} PaymentResponse
+// @Failure 409 {object} PaymentResponse
 // @Failure 500 {object} PaymentResponse
 // @Router /payment/{user_id} [post]
 func (h *PaymentHandler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 	userId := mux.Vars(r)["user_id"]
 	resp := PaymentResponse{}
 
-	err := h.svc.CreateAccount(userId)
+	err := h.svc.CreateAccount(r.Context(), userId)
 	if err != nil {
 		resp.Message = err.Error()
-		sendResponse(w, resp, http.StatusInternalServerError)
+		sendResponse(w, resp, errorStatus(err))
 		return
 	}
 
@@ -46,29 +77,35 @@ func (h *PaymentHandler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 
 // GetBalance godoc
 // @Summary Получить баланс
+// @Description Возвращает баланс по журналу проводок и доступный баланс за вычетом холдов по заказам
 // @Tags payment
 // @Param user_id path string true "ID пользователя"
-// @Success 200 {object} PaymentResponse
+// @Success 200 {object} BalanceResponse
+// @Failure 404 {object} PaymentResponse
 // @Failure 500 {object} PaymentResponse
 // @Router /payment/{user_id} [get]
 func (h *PaymentHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	userId := mux.Vars(r)["user_id"]
-	resp := PaymentResponse{}
 
-	balance, err := h.svc.GetBalance(userId)
+	balance, err := h.svc.GetBalance(r.Context(), userId)
 	if err != nil {
-		resp.Message = err.Error()
-		sendResponse(w, resp, http.StatusInternalServerError)
+		sendResponse(w, PaymentResponse{Message: err.Error()}, errorStatus(err))
 		return
 	}
 
-	resp.Balance = balance
-	resp.Success = true
-	sendResponse(w, resp, http.StatusOK)
+	sendJSON(w, BalanceResponse{
+		Balance:   balance.Ledger,
+		Ledger:    balance.Ledger,
+		Held:      balance.Held,
+		Available: balance.Available,
+		Currency:  money.Currency,
+		Success:   true,
+	}, http.StatusOK)
 }
 
 type DepositRequest struct {
-	Amount float64 `json:"amount"`
+	Amount   money.Amount `json:"amount" swaggertype:"number"` // Не более двух знаков после запятой
+	Currency string       `json:"currency,omitempty"`          // Необязательно, только RUB
 }
 
 // Deposit godoc
@@ -86,22 +123,290 @@ func (h *PaymentHandler) Deposit(w http.ResponseWriter, r *http.Request) {
 	resp := PaymentResponse{}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		resp.Message = "Invalid request format"
+		resp.Message = "Invalid request format: " + err.Error()
+		sendResponse(w, resp, http.StatusBadRequest)
+		return
+	}
+	if err := money.ValidateCurrency(req.Currency); err != nil {
+		resp.Message = err.Error()
+		sendResponse(w, resp, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.Deposit(r.Context(), userId, req.Amount); err != nil {
+		resp.Message = err.Error()
+		sendResponse(w, resp, errorStatus(err))
+		return
+	}
+
+	resp.Success = true
+	sendResponse(w, resp, http.StatusOK)
+}
+
+type WithdrawRequest struct {
+	Amount   money.Amount `json:"amount" swaggertype:"number"` // Не более двух знаков после запятой
+	Currency string       `json:"currency,omitempty"`          // Необязательно, только RUB
+}
+
+// Withdraw godoc
+// @Summary Вывести средства
+// @Description Списывает сумму с баланса и возвращает новый баланс. Вывод сверх баланса отклоняется
+// @Tags payment
+// @Param user_id path string true "ID пользователя"
+// @Param request body WithdrawRequest true "Сумма вывода"
+// @Success 200 {object} PaymentResponse
+// @Failure 400 {object} PaymentResponse
+// @Failure 404 {object} PaymentResponse
+// @Failure 409 {object} PaymentResponse
+// @Failure 500 {object} PaymentResponse
+// @Router /payment/{user_id}/withdraw [put]
+func (h *PaymentHandler) Withdraw(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	var req WithdrawRequest
+	resp := PaymentResponse{}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		resp.Message = "Invalid request format: " + err.Error()
+		sendResponse(w, resp, http.StatusBadRequest)
+		return
+	}
+	if err := money.ValidateCurrency(req.Currency); err != nil {
+		resp.Message = err.Error()
+		sendResponse(w, resp, http.StatusBadRequest)
+		return
+	}
+
+	balance, err := h.svc.Withdraw(r.Context(), userId, req.Amount)
+	if err != nil {
+		resp.Message = err.Error()
+		sendResponse(w, resp, errorStatus(err))
+		return
+	}
+
+	resp.Amount = req.Amount
+	resp.Balance = balance
+	resp.Currency = money.Currency
+	resp.Success = true
+	sendResponse(w, resp, http.StatusOK)
+}
+
+type TransferRequest struct {
+	RecipientID    string       `json:"recipient_id"`                // ID пользователя-получателя
+	Amount         money.Amount `json:"amount" swaggertype:"number"` // Не более двух знаков после запятой
+	Currency       string       `json:"currency,omitempty"`          // Необязательно, только RUB
+	IdempotencyKey string       `json:"idempotency_key"`             // Ключ, по которому повтор запроса не выполняет перевод второй раз
+}
+
+// Transfer godoc
+// @Summary Перевести средства другому пользователю
+// @Description Списывает сумму с баланса отправителя и зачисляет получателю в одной транзакции. Повтор с тем же idempotency_key не выполняет перевод второй раз
+// @Tags payment
+// @Param user_id path string true "ID отправителя"
+// @Param request body TransferRequest true "Получатель, сумма и ключ идемпотентности"
+// @Success 200 {object} service.TransferResult
+// @Failure 400 {object} PaymentResponse
+// @Failure 404 {object} PaymentResponse
+// @Failure 409 {object} PaymentResponse
+// @Failure 422 {object} PaymentResponse
+// @Failure 500 {object} PaymentResponse
+// @Router /payment/{user_id}/transfer [post]
+func (h *PaymentHandler) Transfer(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	var req TransferRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendResponse(w, PaymentResponse{Message: "Invalid request format: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err := money.ValidateCurrency(req.Currency); err != nil {
+		sendResponse(w, PaymentResponse{Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.Transfer(r.Context(), userId, req.RecipientID, req.Amount, req.IdempotencyKey)
+	if err != nil {
+		sendResponse(w, PaymentResponse{Message: err.Error()}, errorStatus(err))
+		return
+	}
+	sendJSON(w, result, http.StatusOK)
+}
+
+type AdjustmentRequest struct {
+	Amount   money.Amount `json:"amount" swaggertype:"number"` // Положительная сумма зачисляется, отрицательная списывается
+	Currency string       `json:"currency,omitempty"`          // Необязательно, только RUB
+	Reason   string       `json:"reason"`                      // Основание корректировки
+}
+
+// Adjust godoc
+// @Summary Ручная корректировка баланса
+// @Description Зачисляет или списывает сумму с записью корректирующей проводки в журнал
+// @Tags ledger
+// @Param user_id path string true "ID пользователя"
+// @Param X-Admin-User header string true "Администратор"
+// @Param request body AdjustmentRequest true "Сумма и основание корректировки"
+// @Success 200 {object} PaymentResponse
+// @Failure 400 {object} PaymentResponse
+// @Failure 404 {object} PaymentResponse
+// @Failure 409 {object} PaymentResponse
+// @Failure 500 {object} PaymentResponse
+// @Router /admin/payment/{user_id}/adjustments [post]
+func (h *PaymentHandler) Adjust(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+	var req AdjustmentRequest
+	resp := PaymentResponse{}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		resp.Message = "Invalid request format: " + err.Error()
+		sendResponse(w, resp, http.StatusBadRequest)
+		return
+	}
+	if err := money.ValidateCurrency(req.Currency); err != nil {
+		resp.Message = err.Error()
 		sendResponse(w, resp, http.StatusBadRequest)
 		return
 	}
 
-	if err := h.svc.Deposit(userId, req.Amount); err != nil {
+	balance, err := h.svc.Adjust(r.Context(), userId, req.Amount, req.Reason, r.Header.Get(deadletter.ActorHeader))
+	if err != nil {
 		resp.Message = err.Error()
-		sendResponse(w, resp, http.StatusInternalServerError)
+		sendResponse(w, resp, errorStatus(err))
 		return
 	}
 
+	resp.Amount = req.Amount
+	resp.Balance = balance
+	resp.Currency = money.Currency
 	resp.Success = true
 	sendResponse(w, resp, http.StatusOK)
 }
 
+// AuditAccount godoc
+// @Summary Сверить баланс с журналом проводок
+// @Description Возвращает сохраненный баланс, баланс по журналу проводок и расхождение между ними
+// @Tags ledger
+// @Param user_id path string true "ID пользователя"
+// @Param X-Admin-User header string true "Администратор"
+// @Success 200 {object} repository.AccountAudit
+// @Failure 400 {object} PaymentResponse
+// @Failure 404 {object} PaymentResponse
+// @Failure 500 {object} PaymentResponse
+// @Router /admin/payment/{user_id}/audit [get]
+func (h *PaymentHandler) AuditAccount(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+
+	audit, err := h.svc.AuditAccount(r.Context(), userId)
+	if err != nil {
+		sendResponse(w, PaymentResponse{Message: err.Error()}, errorStatus(err))
+		return
+	}
+
+	sendJSON(w, audit, http.StatusOK)
+}
+
+// FindLedgerDrift godoc
+// @Summary Найти расхождения с журналом проводок
+// @Description Возвращает аккаунты, баланс которых расходится с журналом, и несбалансированные проводки
+// @Tags ledger
+// @Param X-Admin-User header string true "Администратор"
+// @Success 200 {object} repository.LedgerDrift
+// @Failure 400 {object} PaymentResponse
+// @Failure 500 {object} PaymentResponse
+// @Router /admin/ledger/drift [get]
+func (h *PaymentHandler) FindLedgerDrift(w http.ResponseWriter, r *http.Request) {
+	drift, err := h.svc.FindLedgerDrift(r.Context())
+	if err != nil {
+		sendResponse(w, PaymentResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	sendJSON(w, drift, http.StatusOK)
+}
+
+// ListTransactions godoc
+// @Summary История операций по счету
+// @Description Возвращает пополнения, оплаты заказов, возвраты и корректировки, начиная с новых. Для следующей страницы передайте next_cursor в параметре cursor
+// @Tags payment
+// @Param user_id path string true "ID пользователя"
+// @Param from query string false "Начало периода включительно (RFC 3339 или YYYY-MM-DD)"
+// @Param to query string false "Конец периода не включительно (RFC 3339 или YYYY-MM-DD)"
+// @Param cursor query string false "Курсор следующей страницы"
+// @Param limit query int false "Размер страницы, по умолчанию 50, не более 200"
+// @Success 200 {object} service.TransactionPage
+// @Failure 400 {object} PaymentResponse
+// @Failure 404 {object} PaymentResponse
+// @Failure 500 {object} PaymentResponse
+// @Router /payment/{user_id}/transactions [get]
+func (h *PaymentHandler) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["user_id"]
+
+	query, err := parseTransactionQuery(r)
+	if err != nil {
+		sendResponse(w, PaymentResponse{Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.svc.ListTransactions(r.Context(), userId, query)
+	if err != nil {
+		sendResponse(w, PaymentResponse{Message: err.Error()}, errorStatus(err))
+		return
+	}
+
+	sendJSON(w, page, http.StatusOK)
+}
+
+// parseTransactionQuery разбирает параметры выборки истории операций из строки запроса
+func parseTransactionQuery(r *http.Request) (service.TransactionQuery, error) {
+	params := r.URL.Query()
+	query := service.TransactionQuery{Cursor: params.Get("cursor")}
+
+	var err error
+	if query.From, err = parseTime(params.Get("from")); err != nil {
+		return query, fmt.Errorf("invalid from: %v", err)
+	}
+	if query.To, err = parseTime(params.Get("to")); err != nil {
+		return query, fmt.Errorf("invalid to: %v", err)
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, fmt.Errorf("invalid limit: %q", limit)
+		}
+	}
+	return query, nil
+}
+
+// parseTime принимает время в формате RFC 3339 или дату YYYY-MM-DD
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// errorStatus подбирает HTTP статус для ошибки сервиса
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidAdjustment), errors.Is(err, service.ErrInvalidAmount), errors.Is(err, service.ErrInvalidQuery),
+		errors.Is(err, service.ErrInvalidTransfer), errors.Is(err, service.ErrActorRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, repository.ErrAccountNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrInsufficientFunds), errors.Is(err, repository.ErrAccountExists):
+		return http.StatusConflict
+	case errors.Is(err, repository.ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func sendResponse(w http.ResponseWriter, data PaymentResponse, statusCode int) {
+	sendJSON(w, data, statusCode)
+}
+
+func sendJSON(w http.ResponseWriter, data interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(data)
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"common/metrics"
+	"common/money"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Hold statuses. Only active holds reduce the available balance.
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldVoided   = "voided"
+	HoldExpired  = "expired"
+)
+
+var (
+	// ErrHoldNotFound is returned when the order has no hold to capture
+	ErrHoldNotFound = errors.New("payment hold not found")
+	// ErrHoldNotActive is returned when the hold was already voided or has expired
+	ErrHoldNotActive = errors.New("payment hold is not active")
+)
+
+// AccountBalance is the ledger balance of an account and the part of it not reserved by holds
+type AccountBalance struct {
+	Ledger    money.Amount `json:"ledger" swaggertype:"number"`
+	Held      money.Amount `json:"held" swaggertype:"number"`
+	Available money.Amount `json:"available" swaggertype:"number"`
+}
+
+// Hold is an amount reserved on the user's account for an order
+type Hold struct {
+	HoldID    string
+	OrderID   string
+	UserID    string
+	Amount    money.Amount
+	ExpiresAt time.Time
+}
+
+// lockBalance locks the user's account row for the rest of tx and returns its balance.
+// Holds are only placed under this lock, so the held amount read afterwards stays accurate.
+func lockBalance(ctx context.Context, tx *sql.Tx, userId string) (AccountBalance, error) {
+	var balance AccountBalance
+	err := tx.QueryRowContext(ctx, "SELECT balance FROM payment_accounts WHERE user_id = $1 FOR UPDATE", userId).Scan(&balance.Ledger)
+	if err == sql.ErrNoRows {
+		return AccountBalance{}, ErrAccountNotFound
+	}
+	if err != nil {
+		return AccountBalance{}, fmt.Errorf("could not lock account: %v", err)
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(amount), 0) FROM payment_holds WHERE user_id = $1 AND status = 'active'", userId).Scan(&balance.Held)
+	if err != nil {
+		return AccountBalance{}, fmt.Errorf("could not retrieve held amount: %v", err)
+	}
+	balance.Available = balance.Ledger - balance.Held
+	return balance, nil
+}
+
+// PlaceHold reserves the order amount on the user's account exactly once per transaction id.
+// The ledger balance does not change until the hold is captured.
+func (repo *PaymentRepository) PlaceHold(ctx context.Context, transactionId string, orderId string, userId string, amount money.Amount, ttl time.Duration) error {
+	defer metrics.ObserveQuery("place_hold", time.Now())
+	return repo.applyOnce(ctx, transactionId, KindOrderHold, userId, amount, func(tx *sql.Tx) error {
+		balance, err := lockBalance(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
+		if balance.Available < amount {
+			return ErrInsufficientFunds
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO payment_holds (hold_id, order_id, user_id, amount, expires_at)
+			VALUES ($1, $2, $3, $4, $5)`,
+			transactionId, orderId, userId, amount, time.Now().UTC().Add(ttl))
+		if err != nil {
+			return fmt.Errorf("could not place hold: %v", err)
+		}
+		return nil
+	})
+}
+
+// CaptureHold debits the amount held for the order exactly once per capture id
+func (repo *PaymentRepository) CaptureHold(ctx context.Context, captureId string, orderId string, userId string, amount money.Amount) error {
+	defer metrics.ObserveQuery("capture_hold", time.Now())
+	return repo.applyOnce(ctx, captureId, KindOrderDebit, userId, amount, func(tx *sql.Tx) error {
+		hold, status, err := lockHold(ctx, tx, orderId)
+		if err != nil {
+			return err
+		}
+		if status != HoldActive || !hold.ExpiresAt.After(time.Now().UTC()) {
+			return ErrHoldNotActive
+		}
+
+		// The hold already guarantees that the balance covers the amount
+		var balance money.Amount
+		err = tx.QueryRowContext(ctx, "UPDATE payment_accounts SET balance = balance - $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2 RETURNING balance", hold.Amount, hold.UserID).Scan(&balance)
+		if err != nil {
+			return fmt.Errorf("could not capture hold: %v", err)
+		}
+		if err := settleHold(ctx, tx, hold.HoldID, HoldCaptured); err != nil {
+			return err
+		}
+
+		return postLedgerEntries(ctx, tx, ledgerTransaction{
+			ID:      captureId,
+			Kind:    KindOrderDebit,
+			OrderID: orderId,
+			Amount:  hold.Amount,
+			Debit:   ledgerPosting{Account: UserAccount(hold.UserID), BalanceAfter: &balance},
+			Credit:  ledgerPosting{Account: SystemOrdersAccount},
+		})
+	})
+}
+
+// ExpireHolds releases up to limit active holds whose TTL has passed. notify is called
+// for every hold before its status changes, and a hold whose notification fails stays
+// active until the next run, so no expiry goes unannounced.
+func (repo *PaymentRepository) ExpireHolds(ctx context.Context, limit int, notify func(Hold) error) (int, error) {
+	defer metrics.ObserveQuery("expire_holds", time.Now())
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT hold_id, order_id, user_id, amount, expires_at
+		FROM payment_holds
+		WHERE status = 'active' AND expires_at <= $1
+		ORDER BY expires_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`, time.Now().UTC(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("could not retrieve expired holds: %v", err)
+	}
+
+	var holds []Hold
+	for rows.Next() {
+		var hold Hold
+		if err := rows.Scan(&hold.HoldID, &hold.OrderID, &hold.UserID, &hold.Amount, &hold.ExpiresAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("could not scan hold: %v", err)
+		}
+		holds = append(holds, hold)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("could not retrieve expired holds: %v", err)
+	}
+
+	expired := 0
+	var notifyErr error
+	for _, hold := range holds {
+		if notifyErr = notify(hold); notifyErr != nil {
+			break
+		}
+		if err := settleHold(ctx, tx, hold.HoldID, HoldExpired); err != nil {
+			return 0, err
+		}
+		expired++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit expired holds: %v", err)
+	}
+	return expired, notifyErr
+}
+
+// voidHold releases the active hold of the order inside tx.
+// It reports false when the order has no hold, e.g. for orders debited before holds existed.
+func voidHold(ctx context.Context, tx *sql.Tx, orderId string) (bool, string, error) {
+	hold, status, err := lockHold(ctx, tx, orderId)
+	if err == ErrHoldNotFound {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	if status != HoldActive {
+		return true, status, nil
+	}
+	return true, HoldVoided, settleHold(ctx, tx, hold.HoldID, HoldVoided)
+}
+
+// lockHold locks the hold of the order for the rest of tx
+func lockHold(ctx context.Context, tx *sql.Tx, orderId string) (Hold, string, error) {
+	var hold Hold
+	var status string
+	err := tx.QueryRowContext(ctx, `
+		SELECT hold_id, order_id, user_id, amount, expires_at, status
+		FROM payment_holds
+		WHERE order_id = $1
+		FOR UPDATE`, orderId).Scan(&hold.HoldID, &hold.OrderID, &hold.UserID, &hold.Amount, &hold.ExpiresAt, &status)
+	if err == sql.ErrNoRows {
+		return Hold{}, "", ErrHoldNotFound
+	}
+	if err != nil {
+		return Hold{}, "", fmt.Errorf("could not retrieve hold: %v", err)
+	}
+	return hold, status, nil
+}
+
+// settleHold moves a hold out of the active status
+func settleHold(ctx context.Context, tx *sql.Tx, holdId string, status string) error {
+	_, err := tx.ExecContext(ctx, "UPDATE payment_holds SET status = $1, settled_at = CURRENT_TIMESTAMP WHERE hold_id = $2", status, holdId)
+	if err != nil {
+		return fmt.Errorf("could not update hold: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"common/metrics"
+	"common/money"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// System ledger accounts on the other side of user postings
+const (
+	SystemCashAccount        = "system:cash"        // money entering or leaving the platform
+	SystemOrdersAccount      = "system:orders"      // money paid for orders
+	SystemAdjustmentsAccount = "system:adjustments" // manual corrections and opening balances
+)
+
+// UserAccount returns the ledger account of the user's wallet.
+// Wallets are liabilities of the platform: credits increase the balance, debits decrease it.
+func UserAccount(userId string) string {
+	return "user:" + userId
+}
+
+// ledgerPosting is one side of a balanced ledger transaction
+type ledgerPosting struct {
+	Account      string
+	BalanceAfter *money.Amount // only known for user accounts
+}
+
+// ledgerTransaction is a money movement posted as one debit and one credit of the same amount
+type ledgerTransaction struct {
+	ID          string
+	Kind        string
+	OrderID     string
+	Amount      money.Amount
+	Description string
+	Actor       string // administrator who made a manual adjustment
+	Debit       ledgerPosting
+	Credit      ledgerPosting
+}
+
+// AccountAudit compares the stored balance of an account with its ledger
+type AccountAudit struct {
+	UserID        string       `json:"user_id"`
+	Currency      string       `json:"currency"`
+	Balance       money.Amount `json:"balance" swaggertype:"number"`
+	LedgerBalance money.Amount `json:"ledger_balance" swaggertype:"number"`
+	Drift         money.Amount `json:"drift" swaggertype:"number"`
+	Entries       int          `json:"entries"`
+}
+
+// LedgerDrift lists accounts whose balance disagrees with the ledger
+// and ledger transactions whose debits and credits do not match
+type LedgerDrift struct {
+	Accounts               []AccountAudit `json:"accounts"`
+	UnbalancedTransactions []string       `json:"unbalanced_transactions"`
+}
+
+// AccountTransaction is a posting to the user's wallet as shown in the transaction history.
+// Amount is positive for money coming in and negative for money going out.
+type AccountTransaction struct {
+	EntryID       int64        `json:"-"`
+	TransactionID string       `json:"transaction_id"`
+	Kind          string       `json:"kind"`
+	Amount        money.Amount `json:"amount" swaggertype:"number"`
+	BalanceAfter  money.Amount `json:"balance_after" swaggertype:"number"`
+	OrderID       string       `json:"order_id,omitempty"`
+	Description   string       `json:"description,omitempty"`
+	Actor         string       `json:"actor,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// TransactionFilter selects a page of the transaction history, newest first
+type TransactionFilter struct {
+	From        time.Time // inclusive, zero means unbounded
+	To          time.Time // exclusive, zero means unbounded
+	BeforeEntry int64     // only entries older than this one, zero means from the newest
+	Limit       int
+}
+
+// postLedgerEntries appends both postings of a ledger transaction inside tx
+func postLedgerEntries(ctx context.Context, tx *sql.Tx, t ledgerTransaction) error {
+	postings := []struct {
+		direction string
+		posting   ledgerPosting
+	}{
+		{"debit", t.Debit},
+		{"credit", t.Credit},
+	}
+
+	for _, p := range postings {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (transaction_id, kind, account_id, direction, amount, order_id, balance_after, description, actor)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, NULLIF($8, ''), NULLIF($9, ''))`,
+			t.ID, t.Kind, p.posting.Account, p.direction, t.Amount, t.OrderID, p.posting.BalanceAfter, t.Description, t.Actor)
+		if err != nil {
+			return fmt.Errorf("could not post ledger entry: %v", err)
+		}
+	}
+	return nil
+}
+
+// AuditAccount derives the user's balance from the ledger and compares it with the stored balance
+func (repo *PaymentRepository) AuditAccount(ctx context.Context, userId string) (AccountAudit, error) {
+	defer metrics.ObserveQuery("audit_account", time.Now())
+	audit := AccountAudit{UserID: userId, Currency: money.Currency}
+	err := repo.db.QueryRowContext(ctx, `
+		SELECT a.balance,
+			COALESCE(SUM(CASE e.direction WHEN 'credit' THEN e.amount ELSE -e.amount END), 0),
+			COUNT(e.entry_id)
+		FROM payment_accounts a
+		LEFT JOIN ledger_entries e ON e.account_id = 'user:' || a.user_id
+		WHERE a.user_id = $1
+		GROUP BY a.balance`, userId).Scan(&audit.Balance, &audit.LedgerBalance, &audit.Entries)
+	if err == sql.ErrNoRows {
+		return AccountAudit{}, ErrAccountNotFound
+	}
+	if err != nil {
+		return AccountAudit{}, fmt.Errorf("could not audit account: %v", err)
+	}
+
+	audit.Drift = audit.Balance - audit.LedgerBalance
+	return audit, nil
+}
+
+// FindLedgerDrift checks every account against the ledger and the ledger against itself
+func (repo *PaymentRepository) FindLedgerDrift(ctx context.Context) (LedgerDrift, error) {
+	defer metrics.ObserveQuery("find_ledger_drift", time.Now())
+	drift := LedgerDrift{Accounts: []AccountAudit{}, UnbalancedTransactions: []string{}}
+
+	rows, err := repo.db.QueryContext(ctx, `
+		SELECT a.user_id, a.balance,
+			COALESCE(SUM(CASE e.direction WHEN 'credit' THEN e.amount ELSE -e.amount END), 0) AS ledger_balance,
+			COUNT(e.entry_id)
+		FROM payment_accounts a
+		LEFT JOIN ledger_entries e ON e.account_id = 'user:' || a.user_id
+		GROUP BY a.user_id, a.balance
+		HAVING a.balance <> COALESCE(SUM(CASE e.direction WHEN 'credit' THEN e.amount ELSE -e.amount END), 0)
+		ORDER BY a.user_id`)
+	if err != nil {
+		return LedgerDrift{}, fmt.Errorf("could not check account drift: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		audit := AccountAudit{Currency: money.Currency}
+		if err := rows.Scan(&audit.UserID, &audit.Balance, &audit.LedgerBalance, &audit.Entries); err != nil {
+			return LedgerDrift{}, fmt.Errorf("could not scan account drift: %v", err)
+		}
+		audit.Drift = audit.Balance - audit.LedgerBalance
+		drift.Accounts = append(drift.Accounts, audit)
+	}
+	if err := rows.Err(); err != nil {
+		return LedgerDrift{}, fmt.Errorf("could not check account drift: %v", err)
+	}
+
+	txRows, err := repo.db.QueryContext(ctx, `
+		SELECT transaction_id
+		FROM ledger_entries
+		GROUP BY transaction_id
+		HAVING SUM(CASE direction WHEN 'debit' THEN amount ELSE -amount END) <> 0
+		ORDER BY transaction_id`)
+	if err != nil {
+		return LedgerDrift{}, fmt.Errorf("could not check ledger balance: %v", err)
+	}
+	defer txRows.Close()
+
+	for txRows.Next() {
+		var transactionId string
+		if err := txRows.Scan(&transactionId); err != nil {
+			return LedgerDrift{}, fmt.Errorf("could not scan ledger transaction: %v", err)
+		}
+		drift.UnbalancedTransactions = append(drift.UnbalancedTransactions, transactionId)
+	}
+	return drift, txRows.Err()
+}
+
+// ListTransactions returns the user's wallet postings matching the filter, newest first
+func (repo *PaymentRepository) ListTransactions(ctx context.Context, userId string, filter TransactionFilter) ([]AccountTransaction, error) {
+	defer metrics.ObserveQuery("list_transactions", time.Now())
+	var exists bool
+	err := repo.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM payment_accounts WHERE user_id = $1)", userId).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("could not check if account exists: %v", err)
+	}
+	if !exists {
+		return nil, ErrAccountNotFound
+	}
+
+	rows, err := repo.db.QueryContext(ctx, `
+		SELECT entry_id, transaction_id, kind,
+			CASE direction WHEN 'credit' THEN amount ELSE -amount END,
+			balance_after, COALESCE(order_id, ''), COALESCE(description, ''), COALESCE(actor, ''), created_at
+		FROM ledger_entries
+		WHERE account_id = $1
+			AND ($2::bigint = 0 OR entry_id < $2)
+			AND ($3::timestamp IS NULL OR created_at >= $3)
+			AND ($4::timestamp IS NULL OR created_at < $4)
+		ORDER BY entry_id DESC
+		LIMIT $5`,
+		UserAccount(userId), filter.BeforeEntry, nullTime(filter.From), nullTime(filter.To), filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve transactions: %v", err)
+	}
+	defer rows.Close()
+
+	transactions := []AccountTransaction{}
+	for rows.Next() {
+		var t AccountTransaction
+		err := rows.Scan(&t.EntryID, &t.TransactionID, &t.Kind, &t.Amount, &t.BalanceAfter, &t.OrderID, &t.Description, &t.Actor, &t.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan transaction: %v", err)
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// nullTime maps a zero time to SQL NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
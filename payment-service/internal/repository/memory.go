@@ -0,0 +1,520 @@
+package repository
+
+import (
+	"common/money"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryPaymentRepository keeps accounts, holds and the ledger in process memory with the
+// same semantics as PaymentRepository. Every operation runs under a single lock, including
+// the notify callback of ExpireHolds, so notify must not call back into the repository.
+type MemoryPaymentRepository struct {
+	mu        sync.Mutex
+	accounts  map[string]money.Amount
+	processed map[string]string      // transaction id -> recorded outcome
+	holds     map[string]*memoryHold // by order id
+	entries   []memoryLedgerEntry    // in posting order
+}
+
+// memoryHold is a row of payment_holds
+type memoryHold struct {
+	Hold
+	status string
+}
+
+// memoryLedgerEntry is a row of ledger_entries
+type memoryLedgerEntry struct {
+	entryId       int64
+	transactionId string
+	kind          string
+	accountId     string
+	direction     string
+	amount        money.Amount
+	orderId       string
+	balanceAfter  *money.Amount
+	description   string
+	actor         string
+	createdAt     time.Time
+}
+
+// NewMemoryPaymentRepository creates an empty in-memory payment repository
+func NewMemoryPaymentRepository() *MemoryPaymentRepository {
+	return &MemoryPaymentRepository{
+		accounts:  make(map[string]money.Amount),
+		processed: make(map[string]string),
+		holds:     make(map[string]*memoryHold),
+	}
+}
+
+// CreateAccount creates a new account for a user
+func (repo *MemoryPaymentRepository) CreateAccount(ctx context.Context, userId string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.accounts[userId]; ok {
+		return ErrAccountExists
+	}
+	repo.accounts[userId] = 0
+	return nil
+}
+
+// GetBalance retrieves the ledger balance of the user and the part of it not reserved by active holds
+func (repo *MemoryPaymentRepository) GetBalance(ctx context.Context, userId string) (AccountBalance, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	return repo.balance(userId)
+}
+
+// Deposit credits money from outside the system to the user's balance
+func (repo *MemoryPaymentRepository) Deposit(ctx context.Context, userId string, amount money.Amount) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	balance, ok := repo.accounts[userId]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	balance += amount
+	repo.accounts[userId] = balance
+
+	repo.post(ledgerTransaction{
+		ID:     uuid.New().String(),
+		Kind:   KindDeposit,
+		Amount: amount,
+		Debit:  ledgerPosting{Account: SystemCashAccount},
+		Credit: ledgerPosting{Account: UserAccount(userId), BalanceAfter: &balance},
+	})
+	return nil
+}
+
+// Withdraw takes money out of the user's balance and returns the new balance.
+// The withdrawal is refused with ErrInsufficientFunds when it exceeds the available balance.
+func (repo *MemoryPaymentRepository) Withdraw(ctx context.Context, userId string, amount money.Amount) (money.Amount, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	available, err := repo.balance(userId)
+	if err != nil {
+		return 0, err
+	}
+	if available.Available < amount {
+		return 0, ErrInsufficientFunds
+	}
+
+	balance := available.Ledger - amount
+	repo.accounts[userId] = balance
+	repo.post(ledgerTransaction{
+		ID:     uuid.New().String(),
+		Kind:   KindWithdrawal,
+		Amount: amount,
+		Debit:  ledgerPosting{Account: UserAccount(userId), BalanceAfter: &balance},
+		Credit: ledgerPosting{Account: SystemCashAccount},
+	})
+	return balance, nil
+}
+
+// Transfer moves money from the sender's balance to the recipient's balance exactly once
+// per transfer id and returns the sender's new balance. A replay returns the balance left
+// by the original transfer together with ErrTransactionAlreadyProcessed.
+func (repo *MemoryPaymentRepository) Transfer(ctx context.Context, transferId string, senderId string, recipientId string, amount money.Amount) (money.Amount, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var senderBalance money.Amount
+	err := repo.applyOnce(transferId, func() error {
+		sender, err := repo.balance(senderId)
+		if err != nil {
+			return err
+		}
+		if _, ok := repo.accounts[recipientId]; !ok {
+			return ErrAccountNotFound
+		}
+		if sender.Available < amount {
+			return ErrInsufficientFunds
+		}
+
+		senderBalance = sender.Ledger - amount
+		recipientBalance := repo.accounts[recipientId] + amount
+		repo.accounts[senderId] = senderBalance
+		repo.accounts[recipientId] = recipientBalance
+
+		repo.post(ledgerTransaction{
+			ID:          transferId,
+			Kind:        KindTransfer,
+			Amount:      amount,
+			Description: "transfer from " + senderId + " to " + recipientId,
+			Debit:       ledgerPosting{Account: UserAccount(senderId), BalanceAfter: &senderBalance},
+			Credit:      ledgerPosting{Account: UserAccount(recipientId), BalanceAfter: &recipientBalance},
+		})
+		return nil
+	})
+	if err == ErrTransactionAlreadyProcessed {
+		return repo.checkTransferReplay(transferId, recipientId, amount)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return senderBalance, nil
+}
+
+// checkTransferReplay tells a retried transfer apart from a different transfer that reuses its id
+// and returns the sender's balance after the original transfer
+func (repo *MemoryPaymentRepository) checkTransferReplay(transferId string, recipientId string, amount money.Amount) (money.Amount, error) {
+	matches := false
+	var balance money.Amount
+	for _, entry := range repo.entries {
+		if entry.transactionId != transferId {
+			continue
+		}
+		switch {
+		case entry.direction == "credit" && entry.accountId == UserAccount(recipientId) && entry.amount == amount:
+			matches = true
+		case entry.direction == "debit" && entry.balanceAfter != nil:
+			balance = *entry.balanceAfter
+		}
+	}
+	if !matches {
+		return 0, ErrIdempotencyKeyReused
+	}
+	return balance, ErrTransactionAlreadyProcessed
+}
+
+// Adjust applies a signed manual correction made by actor to the user's balance.
+// A negative adjustment may not take the available balance below zero: money
+// reserved by active holds must stay on the account until they are captured.
+func (repo *MemoryPaymentRepository) Adjust(ctx context.Context, userId string, amount money.Amount, reason string, actor string) (money.Amount, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	available, err := repo.balance(userId)
+	if err != nil {
+		return 0, err
+	}
+	if available.Available+amount < 0 {
+		return 0, ErrInsufficientFunds
+	}
+	balance := available.Ledger + amount
+	repo.accounts[userId] = balance
+
+	entry := ledgerTransaction{
+		ID:          uuid.New().String(),
+		Kind:        KindAdjustment,
+		Amount:      amount,
+		Description: reason,
+		Actor:       actor,
+		Debit:       ledgerPosting{Account: SystemAdjustmentsAccount},
+		Credit:      ledgerPosting{Account: UserAccount(userId), BalanceAfter: &balance},
+	}
+	if amount < 0 {
+		entry.Amount = -amount
+		entry.Debit, entry.Credit = entry.Credit, entry.Debit
+	}
+	repo.post(entry)
+	return balance, nil
+}
+
+// RefundTransaction returns the order amount to the user exactly once. A hold that was
+// not captured is released without touching the ledger, a captured one is credited back.
+func (repo *MemoryPaymentRepository) RefundTransaction(ctx context.Context, refundId string, orderId string, userId string, amount money.Amount) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	return repo.applyOnce(refundId, func() error {
+		if hold, ok := repo.holds[orderId]; ok && hold.status != HoldCaptured {
+			// Nothing was debited for the order
+			if hold.status == HoldActive {
+				hold.status = HoldVoided
+			}
+			return nil
+		}
+
+		balance, ok := repo.accounts[userId]
+		if !ok {
+			return ErrAccountNotFound
+		}
+		balance += amount
+		repo.accounts[userId] = balance
+
+		repo.post(ledgerTransaction{
+			ID:      refundId,
+			Kind:    KindRefund,
+			OrderID: orderId,
+			Amount:  amount,
+			Debit:   ledgerPosting{Account: SystemOrdersAccount},
+			Credit:  ledgerPosting{Account: UserAccount(userId), BalanceAfter: &balance},
+		})
+		return nil
+	})
+}
+
+// PlaceHold reserves the order amount on the user's account exactly once per transaction id
+func (repo *MemoryPaymentRepository) PlaceHold(ctx context.Context, transactionId string, orderId string, userId string, amount money.Amount, ttl time.Duration) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	return repo.applyOnce(transactionId, func() error {
+		balance, err := repo.balance(userId)
+		if err != nil {
+			return err
+		}
+		if balance.Available < amount {
+			return ErrInsufficientFunds
+		}
+		if _, ok := repo.holds[orderId]; ok {
+			return fmt.Errorf("could not place hold: order %s already has a hold", orderId)
+		}
+
+		repo.holds[orderId] = &memoryHold{
+			Hold: Hold{
+				HoldID:    transactionId,
+				OrderID:   orderId,
+				UserID:    userId,
+				Amount:    amount,
+				ExpiresAt: time.Now().UTC().Add(ttl),
+			},
+			status: HoldActive,
+		}
+		return nil
+	})
+}
+
+// CaptureHold debits the amount held for the order exactly once per capture id
+func (repo *MemoryPaymentRepository) CaptureHold(ctx context.Context, captureId string, orderId string, userId string, amount money.Amount) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	return repo.applyOnce(captureId, func() error {
+		hold, ok := repo.holds[orderId]
+		if !ok {
+			return ErrHoldNotFound
+		}
+		if hold.status != HoldActive || !hold.ExpiresAt.After(time.Now().UTC()) {
+			return ErrHoldNotActive
+		}
+
+		// The hold already guarantees that the balance covers the amount
+		balance := repo.accounts[hold.UserID] - hold.Amount
+		repo.accounts[hold.UserID] = balance
+		hold.status = HoldCaptured
+
+		repo.post(ledgerTransaction{
+			ID:      captureId,
+			Kind:    KindOrderDebit,
+			OrderID: orderId,
+			Amount:  hold.Amount,
+			Debit:   ledgerPosting{Account: UserAccount(hold.UserID), BalanceAfter: &balance},
+			Credit:  ledgerPosting{Account: SystemOrdersAccount},
+		})
+		return nil
+	})
+}
+
+// ExpireHolds releases up to limit active holds whose TTL has passed, oldest expiry first.
+// A hold whose notification fails stays active until the next run.
+func (repo *MemoryPaymentRepository) ExpireHolds(ctx context.Context, limit int, notify func(Hold) error) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	now := time.Now().UTC()
+	var holds []*memoryHold
+	for _, hold := range repo.holds {
+		if hold.status == HoldActive && !hold.ExpiresAt.After(now) {
+			holds = append(holds, hold)
+		}
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].ExpiresAt.Before(holds[j].ExpiresAt) })
+	if len(holds) > limit {
+		holds = holds[:limit]
+	}
+
+	expired := 0
+	for _, hold := range holds {
+		if err := notify(hold.Hold); err != nil {
+			return expired, err
+		}
+		hold.status = HoldExpired
+		expired++
+	}
+	return expired, nil
+}
+
+// AuditAccount derives the user's balance from the ledger and compares it with the stored balance
+func (repo *MemoryPaymentRepository) AuditAccount(ctx context.Context, userId string) (AccountAudit, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	balance, ok := repo.accounts[userId]
+	if !ok {
+		return AccountAudit{}, ErrAccountNotFound
+	}
+	return repo.audit(userId, balance), nil
+}
+
+// FindLedgerDrift checks every account against the ledger and the ledger against itself
+func (repo *MemoryPaymentRepository) FindLedgerDrift(ctx context.Context) (LedgerDrift, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	drift := LedgerDrift{Accounts: []AccountAudit{}, UnbalancedTransactions: []string{}}
+
+	userIds := make([]string, 0, len(repo.accounts))
+	for userId := range repo.accounts {
+		userIds = append(userIds, userId)
+	}
+	sort.Strings(userIds)
+	for _, userId := range userIds {
+		if audit := repo.audit(userId, repo.accounts[userId]); audit.Drift != 0 {
+			drift.Accounts = append(drift.Accounts, audit)
+		}
+	}
+
+	sums := make(map[string]money.Amount)
+	for _, entry := range repo.entries {
+		if entry.direction == "debit" {
+			sums[entry.transactionId] += entry.amount
+		} else {
+			sums[entry.transactionId] -= entry.amount
+		}
+	}
+	for transactionId, sum := range sums {
+		if sum != 0 {
+			drift.UnbalancedTransactions = append(drift.UnbalancedTransactions, transactionId)
+		}
+	}
+	sort.Strings(drift.UnbalancedTransactions)
+	return drift, nil
+}
+
+// ListTransactions returns the user's wallet postings matching the filter, newest first
+func (repo *MemoryPaymentRepository) ListTransactions(ctx context.Context, userId string, filter TransactionFilter) ([]AccountTransaction, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.accounts[userId]; !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	transactions := []AccountTransaction{}
+	for i := len(repo.entries) - 1; i >= 0 && len(transactions) < filter.Limit; i-- {
+		entry := repo.entries[i]
+		switch {
+		case entry.accountId != UserAccount(userId):
+			continue
+		case filter.BeforeEntry != 0 && entry.entryId >= filter.BeforeEntry:
+			continue
+		case !filter.From.IsZero() && entry.createdAt.Before(filter.From.UTC()):
+			continue
+		case !filter.To.IsZero() && !entry.createdAt.Before(filter.To.UTC()):
+			continue
+		}
+
+		t := AccountTransaction{
+			EntryID:       entry.entryId,
+			TransactionID: entry.transactionId,
+			Kind:          entry.kind,
+			Amount:        entry.amount,
+			OrderID:       entry.orderId,
+			Description:   entry.description,
+			Actor:         entry.actor,
+			CreatedAt:     entry.createdAt,
+		}
+		if entry.direction == "debit" {
+			t.Amount = -entry.amount
+		}
+		if entry.balanceAfter != nil {
+			t.BalanceAfter = *entry.balanceAfter
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, nil
+}
+
+// applyOnce runs apply unless the transaction id was already recorded, mirroring
+// PaymentRepository.applyOnce. apply must check everything before it changes state,
+// because a rejected transaction is recorded without rolling anything back.
+func (repo *MemoryPaymentRepository) applyOnce(transactionId string, apply func() error) error {
+	if outcome, ok := repo.processed[transactionId]; ok {
+		return outcomeError(outcome)
+	}
+
+	if err := apply(); err != nil {
+		outcome, rejected := rejectionOutcomes[err]
+		if rejected {
+			repo.processed[transactionId] = outcome
+		}
+		return err
+	}
+	repo.processed[transactionId] = outcomeSucceeded
+	return nil
+}
+
+// balance returns the ledger, held and available balance of the account
+func (repo *MemoryPaymentRepository) balance(userId string) (AccountBalance, error) {
+	ledger, ok := repo.accounts[userId]
+	if !ok {
+		return AccountBalance{}, ErrAccountNotFound
+	}
+
+	balance := AccountBalance{Ledger: ledger}
+	for _, hold := range repo.holds {
+		if hold.UserID == userId && hold.status == HoldActive {
+			balance.Held += hold.Amount
+		}
+	}
+	balance.Available = balance.Ledger - balance.Held
+	return balance, nil
+}
+
+// audit compares the stored balance of the account with the sum of its ledger entries
+func (repo *MemoryPaymentRepository) audit(userId string, balance money.Amount) AccountAudit {
+	audit := AccountAudit{UserID: userId, Currency: money.Currency, Balance: balance}
+	for _, entry := range repo.entries {
+		if entry.accountId != UserAccount(userId) {
+			continue
+		}
+		if entry.direction == "credit" {
+			audit.LedgerBalance += entry.amount
+		} else {
+			audit.LedgerBalance -= entry.amount
+		}
+		audit.Entries++
+	}
+	audit.Drift = audit.Balance - audit.LedgerBalance
+	return audit
+}
+
+// post appends both postings of a ledger transaction
+func (repo *MemoryPaymentRepository) post(t ledgerTransaction) {
+	now := time.Now().UTC()
+	for _, p := range []struct {
+		direction string
+		posting   ledgerPosting
+	}{
+		{"debit", t.Debit},
+		{"credit", t.Credit},
+	} {
+		entry := memoryLedgerEntry{
+			entryId:       int64(len(repo.entries)) + 1,
+			transactionId: t.ID,
+			kind:          t.Kind,
+			accountId:     p.posting.Account,
+			direction:     p.direction,
+			amount:        t.Amount,
+			orderId:       t.OrderID,
+			description:   t.Description,
+			actor:         t.Actor,
+			createdAt:     now,
+		}
+		if p.posting.BalanceAfter != nil {
+			balanceAfter := *p.posting.BalanceAfter
+			entry.balanceAfter = &balanceAfter
+		}
+		repo.entries = append(repo.entries, entry)
+	}
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"common/migrate"
+	"database/sql"
+	"embed"
+)
+
+// migrationFiles versioned schema of payment-service, see migrations/
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewMigrator returns the migrator for the payment-service schema
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	return migrate.New(db, "payment-service", migrationFiles, "migrations")
+}
+
+// DeadLettersTable is the table of messages payment-service set aside unprocessed, see deadletter.PostgresStore
+const DeadLettersTable = "payment_dead_letters"
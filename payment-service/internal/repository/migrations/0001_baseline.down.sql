@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS payment_holds;
+DROP TABLE IF EXISTS ledger_entries;
+DROP FUNCTION IF EXISTS ledger_entries_append_only();
+DROP TABLE IF EXISTS processed_transactions;
+DROP TABLE IF EXISTS payment_accounts;
@@ -0,0 +1,80 @@
+-- payment-service schema at the switch to migrations. Every statement is idempotent,
+-- so the migration applies both to an empty database and to one created by the old InitDB.
+
+CREATE TABLE IF NOT EXISTS payment_accounts (
+	user_id VARCHAR(255) PRIMARY KEY,
+	balance NUMERIC(18, 2) DEFAULT 0,
+	transaction_id VARCHAR(255),                      -- legacy, superseded by processed_transactions
+	transaction_status VARCHAR(50) DEFAULT 'pending', -- legacy, superseded by processed_transactions
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Inbox of applied Kafka transactions, one row per transaction id
+CREATE TABLE IF NOT EXISTS processed_transactions (
+	transaction_id VARCHAR(255) PRIMARY KEY,
+	kind VARCHAR(50) NOT NULL,
+	user_id VARCHAR(255) NOT NULL,
+	amount NUMERIC(18, 2) NOT NULL,
+	outcome VARCHAR(50) NOT NULL,
+	processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Exact amounts for databases created with FLOAT columns
+ALTER TABLE payment_accounts ALTER COLUMN balance TYPE NUMERIC(18, 2);
+ALTER TABLE processed_transactions ALTER COLUMN amount TYPE NUMERIC(18, 2);
+
+-- Append-only ledger with opening balances for accounts that existed before it
+CREATE TABLE IF NOT EXISTS ledger_entries (
+	entry_id BIGSERIAL PRIMARY KEY,
+	transaction_id VARCHAR(255) NOT NULL,
+	kind VARCHAR(50) NOT NULL,
+	account_id VARCHAR(255) NOT NULL,
+	direction VARCHAR(6) NOT NULL CHECK (direction IN ('debit', 'credit')),
+	amount NUMERIC(18, 2) NOT NULL CHECK (amount > 0),
+	order_id VARCHAR(255),
+	balance_after NUMERIC(18, 2),
+	description TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE ledger_entries ALTER COLUMN amount TYPE NUMERIC(18, 2);
+ALTER TABLE ledger_entries ALTER COLUMN balance_after TYPE NUMERIC(18, 2);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account ON ledger_entries (account_id, entry_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_transaction ON ledger_entries (transaction_id);
+
+CREATE OR REPLACE FUNCTION ledger_entries_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'ledger_entries is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_entries_append_only ON ledger_entries;
+CREATE TRIGGER ledger_entries_append_only BEFORE UPDATE OR DELETE ON ledger_entries
+	FOR EACH ROW EXECUTE FUNCTION ledger_entries_append_only();
+
+INSERT INTO ledger_entries (transaction_id, kind, account_id, direction, amount, balance_after, description)
+SELECT 'opening:' || a.user_id, 'adjustment', p.account_id, p.direction, ABS(a.balance), p.balance_after, 'opening balance'
+FROM payment_accounts a
+CROSS JOIN LATERAL (VALUES
+	('user:' || a.user_id, CASE WHEN a.balance > 0 THEN 'credit' ELSE 'debit' END, a.balance),
+	('system:adjustments', CASE WHEN a.balance > 0 THEN 'debit' ELSE 'credit' END, NULL)
+) AS p (account_id, direction, balance_after)
+WHERE a.balance <> 0
+	AND NOT EXISTS (SELECT 1 FROM ledger_entries e WHERE e.account_id = 'user:' || a.user_id);
+
+-- Amounts reserved for orders but not yet debited
+CREATE TABLE IF NOT EXISTS payment_holds (
+	hold_id VARCHAR(255) PRIMARY KEY,
+	order_id VARCHAR(255) NOT NULL UNIQUE,
+	user_id VARCHAR(255) NOT NULL,
+	amount NUMERIC(18, 2) NOT NULL CHECK (amount > 0),
+	status VARCHAR(20) NOT NULL DEFAULT 'active',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	settled_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_holds_active_user ON payment_holds (user_id) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_payment_holds_active_expiry ON payment_holds (expires_at) WHERE status = 'active';
@@ -0,0 +1,2 @@
+ALTER TABLE payment_accounts ADD COLUMN IF NOT EXISTS transaction_id VARCHAR(255);
+ALTER TABLE payment_accounts ADD COLUMN IF NOT EXISTS transaction_status VARCHAR(50) DEFAULT 'pending';
@@ -0,0 +1,3 @@
+-- Applied transactions live in processed_transactions, the per-account columns are never written
+ALTER TABLE payment_accounts DROP COLUMN IF EXISTS transaction_id;
+ALTER TABLE payment_accounts DROP COLUMN IF EXISTS transaction_status;
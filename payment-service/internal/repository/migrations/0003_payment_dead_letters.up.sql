@@ -0,0 +1,10 @@
+-- Kafka messages payment-service could not decode, kept for manual review
+CREATE TABLE IF NOT EXISTS payment_dead_letters (
+	id BIGSERIAL PRIMARY KEY,
+	kind VARCHAR(50) NOT NULL,
+	topic VARCHAR(255) NOT NULL,
+	message_key BYTEA,
+	message_value BYTEA NOT NULL,
+	reason TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
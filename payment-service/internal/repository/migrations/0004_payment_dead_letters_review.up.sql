@@ -0,0 +1,19 @@
+-- Dead letters are reviewed through the admin API: processing attempts and review outcome
+ALTER TABLE payment_dead_letters
+	ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+	ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	ADD COLUMN resolved_at TIMESTAMP;
+
+-- The admin API filters dead letters by review status
+CREATE INDEX IF NOT EXISTS idx_payment_dead_letters_status ON payment_dead_letters (status);
+
+-- Log of admin actions on dead letters
+CREATE TABLE IF NOT EXISTS payment_dead_letters_audit (
+	id BIGSERIAL PRIMARY KEY,
+	message_id BIGINT NOT NULL REFERENCES payment_dead_letters (id),
+	action VARCHAR(20) NOT NULL,
+	actor VARCHAR(255) NOT NULL,
+	reason TEXT,
+	edited_value BYTEA,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+-- Manual adjustments record the administrator who made them
+ALTER TABLE ledger_entries ADD COLUMN actor VARCHAR(255);
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"common/money"
+	"context"
+	"time"
+)
+
+// PaymentStore is the storage of payment accounts, holds and the ledger.
+// PaymentRepository implements it on Postgres and MemoryPaymentRepository in memory
+// with the same semantics; the storetest suite checks both against each other.
+type PaymentStore interface {
+	CreateAccount(ctx context.Context, userId string) error
+	GetBalance(ctx context.Context, userId string) (AccountBalance, error)
+	Deposit(ctx context.Context, userId string, amount money.Amount) error
+	Withdraw(ctx context.Context, userId string, amount money.Amount) (money.Amount, error)
+	Transfer(ctx context.Context, transferId string, senderId string, recipientId string, amount money.Amount) (money.Amount, error)
+	Adjust(ctx context.Context, userId string, amount money.Amount, reason string, actor string) (money.Amount, error)
+	RefundTransaction(ctx context.Context, refundId string, orderId string, userId string, amount money.Amount) error
+
+	PlaceHold(ctx context.Context, transactionId string, orderId string, userId string, amount money.Amount, ttl time.Duration) error
+	CaptureHold(ctx context.Context, captureId string, orderId string, userId string, amount money.Amount) error
+	ExpireHolds(ctx context.Context, limit int, notify func(Hold) error) (int, error)
+
+	AuditAccount(ctx context.Context, userId string) (AccountAudit, error)
+	FindLedgerDrift(ctx context.Context) (LedgerDrift, error)
+	ListTransactions(ctx context.Context, userId string, filter TransactionFilter) ([]AccountTransaction, error)
+}
+
+var (
+	_ PaymentStore = (*PaymentRepository)(nil)
+	_ PaymentStore = (*MemoryPaymentRepository)(nil)
+)
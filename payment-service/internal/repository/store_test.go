@@ -0,0 +1,49 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"payment-service/internal/repository"
+	"payment-service/internal/repository/storetest"
+	"testing"
+	"time"
+)
+
+func TestMemoryPaymentRepository(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) repository.PaymentStore {
+		return repository.NewMemoryPaymentRepository()
+	})
+}
+
+// TestPaymentRepository runs the same suite on the Postgres database from TEST_DATABASE_URL.
+// The service's tables are truncated before every test, so point it at a disposable database.
+func TestPaymentRepository(t *testing.T) {
+	connStr := os.Getenv("TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 30*time.Second)
+	defer cancel()
+	db, err := repository.InitDB(ctx, connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := repository.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Run(t, func(t *testing.T) repository.PaymentStore {
+		_, err := db.Exec("TRUNCATE payment_accounts, processed_transactions, payment_holds, ledger_entries")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repository.NewPaymentRepository(db)
+	})
+}
@@ -0,0 +1,513 @@
+// Package storetest is the conformance suite every repository.PaymentStore must pass.
+// The same tests run against Postgres and the in-memory store, so the two cannot drift apart.
+package storetest
+
+import (
+	"common/money"
+	"errors"
+	"github.com/google/uuid"
+	"payment-service/internal/repository"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run runs the suite. newStore is called for every test and must return an empty store.
+func Run(t *testing.T, newStore func(t *testing.T) repository.PaymentStore) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store repository.PaymentStore)
+	}{
+		{"CreateAccount", testCreateAccount},
+		{"AccountNotFound", testAccountNotFound},
+		{"DepositAndWithdraw", testDepositAndWithdraw},
+		{"Transfer", testTransfer},
+		{"TransferIdempotency", testTransferIdempotency},
+		{"Adjust", testAdjust},
+		{"AdjustKeepsHeldMoney", testAdjustKeepsHeldMoney},
+		{"PlaceHold", testPlaceHold},
+		{"CaptureHold", testCaptureHold},
+		{"RefundTransaction", testRefundTransaction},
+		{"ExpireHolds", testExpireHolds},
+		{"ListTransactions", testListTransactions},
+		{"LedgerStaysBalanced", testLedgerStaysBalanced},
+		{"ConcurrentWithdrawals", testConcurrentWithdrawals},
+		{"ConcurrentRedelivery", testConcurrentRedelivery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+func testCreateAccount(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, 0)
+	expectBalance(t, store, userId, 0, 0)
+
+	if err := store.CreateAccount(t.Context(), userId); !errors.Is(err, repository.ErrAccountExists) {
+		t.Fatalf("second CreateAccount: %v, want ErrAccountExists", err)
+	}
+}
+
+func testAccountNotFound(t *testing.T, store repository.PaymentStore) {
+	missing := newUserID()
+	other := newAccount(t, store, rub(100))
+
+	checks := map[string]error{}
+	_, checks["GetBalance"] = store.GetBalance(t.Context(), missing)
+	checks["Deposit"] = store.Deposit(t.Context(), missing, rub(1))
+	_, checks["Withdraw"] = store.Withdraw(t.Context(), missing, rub(1))
+	_, checks["Adjust"] = store.Adjust(t.Context(), missing, rub(1), "test", "admin")
+	_, checks["AuditAccount"] = store.AuditAccount(t.Context(), missing)
+	_, checks["ListTransactions"] = store.ListTransactions(t.Context(), missing, repository.TransactionFilter{Limit: 10})
+	_, checks["Transfer to a missing account"] = store.Transfer(t.Context(), newID(), other, missing, rub(1))
+	_, checks["Transfer from a missing account"] = store.Transfer(t.Context(), newID(), missing, other, rub(1))
+	checks["PlaceHold"] = store.PlaceHold(t.Context(), newID(), newID(), missing, rub(1), time.Hour)
+	checks["RefundTransaction"] = store.RefundTransaction(t.Context(), newID(), newID(), missing, rub(1))
+
+	for name, err := range checks {
+		if !errors.Is(err, repository.ErrAccountNotFound) {
+			t.Errorf("%s: %v, want ErrAccountNotFound", name, err)
+		}
+	}
+	expectBalance(t, store, other, rub(100), rub(100))
+}
+
+func testDepositAndWithdraw(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, rub(100))
+
+	balance, err := store.Withdraw(t.Context(), userId, rub(30))
+	if balance != rub(70) || err != nil {
+		t.Fatalf("Withdraw = %v, %v; want 70", balance, err)
+	}
+	if _, err := store.Withdraw(t.Context(), userId, rub(71)); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Withdraw above the balance: %v, want ErrInsufficientFunds", err)
+	}
+	balance, err = store.Withdraw(t.Context(), userId, rub(70))
+	if balance != 0 || err != nil {
+		t.Fatalf("Withdraw of the whole balance = %v, %v; want 0", balance, err)
+	}
+	expectBalance(t, store, userId, 0, 0)
+}
+
+func testTransfer(t *testing.T, store repository.PaymentStore) {
+	sender := newAccount(t, store, rub(100))
+	recipient := newAccount(t, store, rub(5))
+
+	balance, err := store.Transfer(t.Context(), newID(), sender, recipient, rub(40))
+	if balance != rub(60) || err != nil {
+		t.Fatalf("Transfer = %v, %v; want 60", balance, err)
+	}
+	expectBalance(t, store, sender, rub(60), rub(60))
+	expectBalance(t, store, recipient, rub(45), rub(45))
+
+	if _, err := store.Transfer(t.Context(), newID(), sender, recipient, rub(61)); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Transfer above the balance: %v, want ErrInsufficientFunds", err)
+	}
+	expectBalance(t, store, sender, rub(60), rub(60))
+	expectBalance(t, store, recipient, rub(45), rub(45))
+}
+
+func testTransferIdempotency(t *testing.T, store repository.PaymentStore) {
+	sender := newAccount(t, store, rub(100))
+	recipient := newAccount(t, store, 0)
+	transferId := newID()
+
+	if _, err := store.Transfer(t.Context(), transferId, sender, recipient, rub(10)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	// A replay reports the balance left by the original transfer, not the current one
+	deposit(t, store, sender, rub(5))
+	balance, err := store.Transfer(t.Context(), transferId, sender, recipient, rub(10))
+	if balance != rub(90) || !errors.Is(err, repository.ErrTransactionAlreadyProcessed) {
+		t.Fatalf("replayed Transfer = %v, %v; want 90 and ErrTransactionAlreadyProcessed", balance, err)
+	}
+	if _, err := store.Transfer(t.Context(), transferId, sender, recipient, rub(20)); !errors.Is(err, repository.ErrIdempotencyKeyReused) {
+		t.Fatalf("Transfer reusing the id with another amount: %v, want ErrIdempotencyKeyReused", err)
+	}
+	expectBalance(t, store, sender, rub(95), rub(95))
+	expectBalance(t, store, recipient, rub(10), rub(10))
+
+	// A rejected transfer stays rejected even after the sender tops up
+	rejected := newID()
+	if _, err := store.Transfer(t.Context(), rejected, sender, recipient, rub(500)); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Transfer above the balance: %v, want ErrInsufficientFunds", err)
+	}
+	deposit(t, store, sender, rub(500))
+	if _, err := store.Transfer(t.Context(), rejected, sender, recipient, rub(500)); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("replayed rejected Transfer: %v, want ErrInsufficientFunds", err)
+	}
+	expectBalance(t, store, recipient, rub(10), rub(10))
+}
+
+func testAdjust(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, rub(10))
+
+	balance, err := store.Adjust(t.Context(), userId, rub(5), "bonus", "admin")
+	if balance != rub(15) || err != nil {
+		t.Fatalf("positive Adjust = %v, %v; want 15", balance, err)
+	}
+	balance, err = store.Adjust(t.Context(), userId, -rub(15), "correction", "admin")
+	if balance != 0 || err != nil {
+		t.Fatalf("negative Adjust = %v, %v; want 0", balance, err)
+	}
+	if _, err := store.Adjust(t.Context(), userId, -rub(1), "correction", "admin"); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Adjust below zero: %v, want ErrInsufficientFunds", err)
+	}
+	expectAudit(t, store, userId, 0, 3)
+
+	// The history shows the reason and the administrator behind an adjustment
+	history, err := store.ListTransactions(t.Context(), userId, repository.TransactionFilter{Limit: 1})
+	if err != nil || len(history) != 1 {
+		t.Fatalf("ListTransactions = %+v, %v", history, err)
+	}
+	if got := history[0]; got.Kind != repository.KindAdjustment || got.Amount != -rub(15) || got.Description != "correction" || got.Actor != "admin" {
+		t.Fatalf("adjustment entry = %+v, want -15 correction by admin", got)
+	}
+}
+
+func testAdjustKeepsHeldMoney(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, rub(100))
+	orderId := newID()
+	placeHold(t, store, orderId, userId, rub(80), time.Hour)
+
+	// Only the money not reserved by holds can be taken away
+	if _, err := store.Adjust(t.Context(), userId, -rub(30), "correction", "admin"); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Adjust into held money: %v, want ErrInsufficientFunds", err)
+	}
+	expectBalance(t, store, userId, rub(100), rub(20))
+	if _, err := store.Adjust(t.Context(), userId, -rub(20), "correction", "admin"); err != nil {
+		t.Fatalf("Adjust of the available balance: %v", err)
+	}
+	expectBalance(t, store, userId, rub(80), 0)
+
+	// The hold is still fully covered when it is captured
+	if err := store.CaptureHold(t.Context(), newID(), orderId, userId, rub(80)); err != nil {
+		t.Fatalf("CaptureHold: %v", err)
+	}
+	expectBalance(t, store, userId, 0, 0)
+	expectAudit(t, store, userId, 0, 3)
+}
+
+func testPlaceHold(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, rub(100))
+	holdId := newID()
+
+	if err := store.PlaceHold(t.Context(), holdId, newID(), userId, rub(70), time.Hour); err != nil {
+		t.Fatalf("PlaceHold: %v", err)
+	}
+	expectBalance(t, store, userId, rub(100), rub(30))
+
+	if err := store.PlaceHold(t.Context(), holdId, newID(), userId, rub(70), time.Hour); !errors.Is(err, repository.ErrTransactionAlreadyProcessed) {
+		t.Fatalf("replayed PlaceHold: %v, want ErrTransactionAlreadyProcessed", err)
+	}
+	if err := store.PlaceHold(t.Context(), newID(), newID(), userId, rub(31), time.Hour); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("PlaceHold above the available balance: %v, want ErrInsufficientFunds", err)
+	}
+	if _, err := store.Withdraw(t.Context(), userId, rub(31)); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Withdraw of held money: %v, want ErrInsufficientFunds", err)
+	}
+	if _, err := store.Transfer(t.Context(), newID(), userId, newAccount(t, store, 0), rub(31)); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Fatalf("Transfer of held money: %v, want ErrInsufficientFunds", err)
+	}
+	expectBalance(t, store, userId, rub(100), rub(30))
+}
+
+func testCaptureHold(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, rub(100))
+	orderId := newID()
+	placeHold(t, store, orderId, userId, rub(40), time.Hour)
+
+	if err := store.CaptureHold(t.Context(), newID(), newID(), userId, rub(40)); !errors.Is(err, repository.ErrHoldNotFound) {
+		t.Fatalf("CaptureHold without a hold: %v, want ErrHoldNotFound", err)
+	}
+
+	captureId := newID()
+	if err := store.CaptureHold(t.Context(), captureId, orderId, userId, rub(40)); err != nil {
+		t.Fatalf("CaptureHold: %v", err)
+	}
+	expectBalance(t, store, userId, rub(60), rub(60))
+
+	if err := store.CaptureHold(t.Context(), captureId, orderId, userId, rub(40)); !errors.Is(err, repository.ErrTransactionAlreadyProcessed) {
+		t.Fatalf("replayed CaptureHold: %v, want ErrTransactionAlreadyProcessed", err)
+	}
+	if err := store.CaptureHold(t.Context(), newID(), orderId, userId, rub(40)); !errors.Is(err, repository.ErrHoldNotActive) {
+		t.Fatalf("second capture of the hold: %v, want ErrHoldNotActive", err)
+	}
+	expectBalance(t, store, userId, rub(60), rub(60))
+	expectAudit(t, store, userId, rub(60), 2)
+}
+
+func testRefundTransaction(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, rub(100))
+
+	// An uncaptured hold is released without a ledger entry
+	held := newID()
+	placeHold(t, store, held, userId, rub(30), time.Hour)
+	refundId := newID()
+	if err := store.RefundTransaction(t.Context(), refundId, held, userId, rub(30)); err != nil {
+		t.Fatalf("RefundTransaction of a hold: %v", err)
+	}
+	expectBalance(t, store, userId, rub(100), rub(100))
+	if err := store.CaptureHold(t.Context(), newID(), held, userId, rub(30)); !errors.Is(err, repository.ErrHoldNotActive) {
+		t.Fatalf("CaptureHold after refund: %v, want ErrHoldNotActive", err)
+	}
+
+	// A captured hold is credited back exactly once
+	captured := newID()
+	placeHold(t, store, captured, userId, rub(50), time.Hour)
+	if err := store.CaptureHold(t.Context(), newID(), captured, userId, rub(50)); err != nil {
+		t.Fatalf("CaptureHold: %v", err)
+	}
+	expectBalance(t, store, userId, rub(50), rub(50))
+
+	refundId = newID()
+	if err := store.RefundTransaction(t.Context(), refundId, captured, userId, rub(50)); err != nil {
+		t.Fatalf("RefundTransaction of a captured hold: %v", err)
+	}
+	if err := store.RefundTransaction(t.Context(), refundId, captured, userId, rub(50)); !errors.Is(err, repository.ErrTransactionAlreadyProcessed) {
+		t.Fatalf("replayed RefundTransaction: %v, want ErrTransactionAlreadyProcessed", err)
+	}
+	expectBalance(t, store, userId, rub(100), rub(100))
+	expectAudit(t, store, userId, rub(100), 3)
+}
+
+func testExpireHolds(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, rub(100))
+	expiredOrder := newID()
+	placeHold(t, store, expiredOrder, userId, rub(20), -time.Second)
+	placeHold(t, store, newID(), userId, rub(30), time.Hour)
+	expectBalance(t, store, userId, rub(100), rub(50))
+
+	if err := store.CaptureHold(t.Context(), newID(), expiredOrder, userId, rub(20)); !errors.Is(err, repository.ErrHoldNotActive) {
+		t.Fatalf("CaptureHold of an expired hold: %v, want ErrHoldNotActive", err)
+	}
+
+	notifyErr := errors.New("broker unavailable")
+	expired, err := store.ExpireHolds(t.Context(), 10, func(repository.Hold) error { return notifyErr })
+	if expired != 0 || !errors.Is(err, notifyErr) {
+		t.Fatalf("ExpireHolds with failing notify = %d, %v; want 0 and the notify error", expired, err)
+	}
+	expectBalance(t, store, userId, rub(100), rub(50))
+
+	var notified []repository.Hold
+	expired, err = store.ExpireHolds(t.Context(), 10, func(hold repository.Hold) error {
+		notified = append(notified, hold)
+		return nil
+	})
+	if expired != 1 || err != nil {
+		t.Fatalf("ExpireHolds = %d, %v; want 1", expired, err)
+	}
+	if len(notified) != 1 || notified[0].OrderID != expiredOrder || notified[0].UserID != userId || notified[0].Amount != rub(20) {
+		t.Fatalf("notified %+v, want the expired hold", notified)
+	}
+	expectBalance(t, store, userId, rub(100), rub(70))
+
+	expired, err = store.ExpireHolds(t.Context(), 10, func(repository.Hold) error { return nil })
+	if expired != 0 || err != nil {
+		t.Fatalf("second ExpireHolds = %d, %v; want 0", expired, err)
+	}
+}
+
+func testListTransactions(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, rub(100))
+	if _, err := store.Withdraw(t.Context(), userId, rub(30)); err != nil {
+		t.Fatalf("Withdraw: %v", err)
+	}
+	orderId := newID()
+	placeHold(t, store, orderId, userId, rub(20), time.Hour)
+	if err := store.CaptureHold(t.Context(), newID(), orderId, userId, rub(20)); err != nil {
+		t.Fatalf("CaptureHold: %v", err)
+	}
+
+	all, err := store.ListTransactions(t.Context(), userId, repository.TransactionFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListTransactions: %v", err)
+	}
+	want := []struct {
+		kind         string
+		amount       money.Amount
+		balanceAfter money.Amount
+		orderId      string
+	}{
+		{repository.KindOrderDebit, -rub(20), rub(50), orderId},
+		{repository.KindWithdrawal, -rub(30), rub(70), ""},
+		{repository.KindDeposit, rub(100), rub(100), ""},
+	}
+	if len(all) != len(want) {
+		t.Fatalf("ListTransactions returned %d entries %+v, want %d", len(all), all, len(want))
+	}
+	for i, w := range want {
+		got := all[i]
+		if got.Kind != w.kind || got.Amount != w.amount || got.BalanceAfter != w.balanceAfter || got.OrderID != w.orderId {
+			t.Errorf("entry %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	page, err := store.ListTransactions(t.Context(), userId, repository.TransactionFilter{Limit: 1, BeforeEntry: all[0].EntryID})
+	if err != nil || len(page) != 1 || page[0].EntryID != all[1].EntryID {
+		t.Fatalf("next page = %+v, %v; want the withdrawal", page, err)
+	}
+
+	future, err := store.ListTransactions(t.Context(), userId, repository.TransactionFilter{Limit: 10, From: time.Now().Add(24 * time.Hour)})
+	if err != nil || len(future) != 0 {
+		t.Fatalf("ListTransactions from tomorrow = %+v, %v; want none", future, err)
+	}
+	empty, err := store.ListTransactions(t.Context(), newAccount(t, store, 0), repository.TransactionFilter{Limit: 10})
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Fatalf("ListTransactions of a new account = %#v, %v; want an empty list", empty, err)
+	}
+}
+
+func testLedgerStaysBalanced(t *testing.T, store repository.PaymentStore) {
+	alice := newAccount(t, store, rub(100))
+	bob := newAccount(t, store, rub(50))
+	if _, err := store.Transfer(t.Context(), newID(), alice, bob, rub(25)); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if _, err := store.Adjust(t.Context(), bob, -rub(5), "fee", "admin"); err != nil {
+		t.Fatalf("Adjust: %v", err)
+	}
+	orderId := newID()
+	placeHold(t, store, orderId, bob, rub(10), time.Hour)
+	if err := store.CaptureHold(t.Context(), newID(), orderId, bob, rub(10)); err != nil {
+		t.Fatalf("CaptureHold: %v", err)
+	}
+
+	expectAudit(t, store, alice, rub(75), 2)
+	expectAudit(t, store, bob, rub(60), 4)
+
+	drift, err := store.FindLedgerDrift(t.Context())
+	if err != nil {
+		t.Fatalf("FindLedgerDrift: %v", err)
+	}
+	if len(drift.Accounts) != 0 || len(drift.UnbalancedTransactions) != 0 {
+		t.Fatalf("FindLedgerDrift = %+v, want no drift", drift)
+	}
+}
+
+func testConcurrentWithdrawals(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, rub(100))
+
+	const workers = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Withdraw(t.Context(), userId, rub(10))
+			if err != nil && !errors.Is(err, repository.ErrInsufficientFunds) {
+				t.Errorf("Withdraw: %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 10 {
+		t.Fatalf("%d concurrent withdrawals succeeded, want 10", succeeded)
+	}
+	expectBalance(t, store, userId, 0, 0)
+	expectAudit(t, store, userId, 0, 11)
+}
+
+func testConcurrentRedelivery(t *testing.T, store repository.PaymentStore) {
+	userId := newAccount(t, store, rub(100))
+	holdId, orderId := newID(), newID()
+
+	const workers = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	applied := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.PlaceHold(t.Context(), holdId, orderId, userId, rub(10), time.Hour)
+			if err != nil && !errors.Is(err, repository.ErrTransactionAlreadyProcessed) {
+				t.Errorf("PlaceHold: %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				applied++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if applied != 1 {
+		t.Fatalf("the same hold was applied %d times, want once", applied)
+	}
+	expectBalance(t, store, userId, rub(100), rub(90))
+}
+
+func rub(units int64) money.Amount {
+	return money.FromMinor(units * 100)
+}
+
+// newID returns a unique transaction or order id
+func newID() string {
+	return uuid.New().String()
+}
+
+// newUserID returns a unique user id, so tests never see each other's accounts
+func newUserID() string {
+	return "user-" + uuid.New().String()
+}
+
+// newAccount creates an account with the given opening deposit
+func newAccount(t *testing.T, store repository.PaymentStore, balance money.Amount) string {
+	t.Helper()
+	userId := newUserID()
+	if err := store.CreateAccount(t.Context(), userId); err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	if balance != 0 {
+		deposit(t, store, userId, balance)
+	}
+	return userId
+}
+
+func deposit(t *testing.T, store repository.PaymentStore, userId string, amount money.Amount) {
+	t.Helper()
+	if err := store.Deposit(t.Context(), userId, amount); err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+}
+
+func placeHold(t *testing.T, store repository.PaymentStore, orderId string, userId string, amount money.Amount, ttl time.Duration) {
+	t.Helper()
+	if err := store.PlaceHold(t.Context(), newID(), orderId, userId, amount, ttl); err != nil {
+		t.Fatalf("PlaceHold: %v", err)
+	}
+}
+
+func expectBalance(t *testing.T, store repository.PaymentStore, userId string, ledger money.Amount, available money.Amount) {
+	t.Helper()
+	balance, err := store.GetBalance(t.Context(), userId)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if balance.Ledger != ledger || balance.Available != available || balance.Held != ledger-available {
+		t.Fatalf("balance = %+v, want ledger %v and available %v", balance, ledger, available)
+	}
+}
+
+func expectAudit(t *testing.T, store repository.PaymentStore, userId string, balance money.Amount, entries int) {
+	t.Helper()
+	audit, err := store.AuditAccount(t.Context(), userId)
+	if err != nil {
+		t.Fatalf("AuditAccount: %v", err)
+	}
+	if audit.Balance != balance || audit.LedgerBalance != balance || audit.Drift != 0 || audit.Entries != entries {
+		t.Fatalf("audit = %+v, want balance %v with %d entries and no drift", audit, balance, entries)
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"common/events"
+	"common/money"
+	"context"
+	"log"
+	"payment-service/internal/repository"
+	"time"
+)
+
+const (
+	holdExpiryInterval  = 30 * time.Second
+	holdExpiryBatchSize = 100
+)
+
+// RunHoldExpiry периодически снимает истекшие холды и сообщает order-service,
+// что оплата заказа больше не зарезервирована. Останавливается при отмене ctx.
+func (svc *PaymentService) RunHoldExpiry(ctx context.Context) {
+	ticker := time.NewTicker(holdExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		expired, err := svc.ExpireHoldsOnce(ctx)
+		if err != nil {
+			log.Printf("hold expiry error: %v", err)
+		}
+		if expired > 0 {
+			log.Printf("Expired %d payment holds", expired)
+		}
+	}
+}
+
+// ExpireHoldsOnce снимает одну пачку истекших холдов и возвращает их число
+func (svc *PaymentService) ExpireHoldsOnce(ctx context.Context) (int, error) {
+	return svc.repo.ExpireHolds(ctx, holdExpiryBatchSize, func(hold repository.Hold) error {
+		return svc.publishHoldExpired(ctx, hold)
+	})
+}
+
+// publishHoldExpired публикует событие об истечении холда заказа
+func (svc *PaymentService) publishHoldExpired(ctx context.Context, hold repository.Hold) error {
+	return svc.PublishPaymentResult(ctx, PaymentResult{Type: events.HoldExpired, PaymentResult: events.PaymentResult{
+		TransactionID: hold.HoldID,
+		OrderID:       hold.OrderID,
+		UserID:        hold.UserID,
+		Amount:        hold.Amount,
+		Currency:      money.Currency,
+		Reason:        ReasonHoldExpired,
+	}})
+}
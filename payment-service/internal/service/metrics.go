@@ -0,0 +1,18 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Бизнес-метрики payment-service, доступны на /metrics
+var (
+	deposits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "payment_deposits_total",
+		Help: "Successful deposits.",
+	})
+	depositedRubles = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "payment_deposited_rubles_total",
+		Help: "Total amount of successful deposits, in rubles.",
+	})
+)
@@ -1,116 +1,443 @@
 package service
 
 import (
+	"common/bus"
+	"common/configutil"
+	"common/deadletter"
+	"common/events"
+	"common/money"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/segmentio/kafka-go"
+	"github.com/google/uuid"
 	"log"
 	"payment-service/internal/repository"
+	"strconv"
+	"time"
 )
 
+// Причины отказа в оплате
+const (
+	ReasonAccountNotFound   = "account_not_found"
+	ReasonInsufficientFunds = "insufficient_funds"
+	ReasonInvalidAmount     = "invalid_amount"
+	ReasonHoldNotFound      = "hold_not_found"
+	ReasonHoldNotActive     = "hold_not_active"
+	ReasonHoldExpired       = "hold_expired"
+)
+
+var (
+	// ErrInvalidAdjustment возвращается для некорректной ручной корректировки баланса
+	ErrInvalidAdjustment = errors.New("invalid adjustment")
+	// ErrActorRequired возвращается для административного действия без имени администратора
+	ErrActorRequired = errors.New("actor is required")
+	// ErrInvalidAmount возвращается для неположительной суммы операции
+	ErrInvalidAmount = errors.New("amount must be positive")
+)
+
+// ErrInvalidTransfer возвращается для перевода без получателя, самому себе или без ключа идемпотентности
+var ErrInvalidTransfer = errors.New("invalid transfer")
+
+// maxIdempotencyKeyLength ограничивает длину ключа идемпотентности перевода
+const maxIdempotencyKeyLength = 128
+
+// TransferResult результат перевода между пользователями
+type TransferResult struct {
+	TransferID  string       `json:"transfer_id"`
+	RecipientID string       `json:"recipient_id"`
+	Amount      money.Amount `json:"amount" swaggertype:"number"`
+	Balance     money.Amount `json:"balance" swaggertype:"number"` // Баланс отправителя после перевода
+	Currency    string       `json:"currency"`
+	Replayed    bool         `json:"replayed"` // Перевод с этим ключом уже был выполнен раньше
+}
+
+// Размер страницы истории операций
+const (
+	defaultTransactionsLimit = 50
+	maxTransactionsLimit     = 200
+)
+
+// ErrInvalidQuery возвращается для некорректных параметров выборки истории операций
+var ErrInvalidQuery = errors.New("invalid query")
+
+// TransactionQuery параметры выборки истории операций
+type TransactionQuery struct {
+	From   time.Time // включительно, нулевое значение — без ограничения
+	To     time.Time // не включительно, нулевое значение — без ограничения
+	Cursor string    // курсор из предыдущей страницы
+	Limit  int
+}
+
+// TransactionPage страница истории операций по счету
+type TransactionPage struct {
+	Currency     string                          `json:"currency"`
+	Transactions []repository.AccountTransaction `json:"transactions"`
+	NextCursor   string                          `json:"next_cursor,omitempty"`
+}
+
+// encodeCursor превращает ID проводки в непрозрачный курсор
+func encodeCursor(entryId int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(entryId, 10)))
+}
+
+// decodeCursor восстанавливает ID проводки из курсора
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	entryId, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || entryId <= 0 {
+		return 0, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return entryId, nil
+}
+
+// validateCommand проверяет сумму и валюту команды order-service
+func validateCommand(command events.TransactionCommand) error {
+	if err := money.ValidateCurrency(command.Currency); err != nil {
+		return err
+	}
+	if !command.Amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+	return nil
+}
+
+// PaymentResult результат оплаты, публикуемый в топик payment_results: тип события и его содержимое
+type PaymentResult struct {
+	Type string
+	events.PaymentResult
+}
+
 // PaymentService структура для обработки платежных операций
 type PaymentService struct {
-	repo *repository.PaymentRepository
+	repo       repository.PaymentStore
+	quarantine deadletter.Store // Команды, которые не удалось разобрать
+	publisher  bus.Publisher    // Публикация результатов оплаты
+	subscriber bus.Subscriber   // Чтение команд от order-service
+	topics     configutil.Topics
+	holdTTL    time.Duration // Время жизни холда до автоматического снятия
 }
 
-// NewPaymentService создает новый сервис для работы с платежами
-func NewPaymentService(repo *repository.PaymentRepository) *PaymentService {
-	return &PaymentService{repo}
+// NewPaymentService создает новый сервис для работы с платежами.
+// Холды по заказам, не списанные и не снятые за holdTTL, снимаются автоматически.
+func NewPaymentService(repo repository.PaymentStore, quarantine deadletter.Store, publisher bus.Publisher, subscriber bus.Subscriber, topics configutil.Topics, holdTTL time.Duration) *PaymentService {
+	return &PaymentService{
+		repo:       repo,
+		quarantine: quarantine,
+		publisher:  publisher,
+		subscriber: subscriber,
+		topics:     topics,
+		holdTTL:    holdTTL,
+	}
 }
 
 // CreateAccount создает новый платежный аккаунт для пользователя
-func (svc *PaymentService) CreateAccount(userId string) error {
-	return svc.repo.CreateAccount(userId)
+func (svc *PaymentService) CreateAccount(ctx context.Context, userId string) error {
+	return svc.repo.CreateAccount(ctx, userId)
 }
 
-// GetBalance возвращает баланс пользователя
-func (svc *PaymentService) GetBalance(userId string) (float64, error) {
-	return svc.repo.GetBalance(userId)
+// GetBalance возвращает баланс пользователя по журналу проводок и доступную часть за вычетом холдов
+func (svc *PaymentService) GetBalance(ctx context.Context, userId string) (repository.AccountBalance, error) {
+	return svc.repo.GetBalance(ctx, userId)
 }
 
 // Deposit пополняет баланс пользователя
-func (svc *PaymentService) Deposit(userId string, amount float64) error {
-	return svc.repo.Deposit(userId, amount)
+func (svc *PaymentService) Deposit(ctx context.Context, userId string, amount money.Amount) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+	if err := svc.repo.Deposit(ctx, userId, amount); err != nil {
+		return err
+	}
+
+	deposits.Inc()
+	depositedRubles.Add(amount.Float64())
+	return nil
+}
+
+// Withdraw выводит средства со счета пользователя и возвращает новый баланс
+func (svc *PaymentService) Withdraw(ctx context.Context, userId string, amount money.Amount) (money.Amount, error) {
+	if !amount.IsPositive() {
+		return 0, ErrInvalidAmount
+	}
+	return svc.repo.Withdraw(ctx, userId, amount)
 }
 
-// ProcessTransactionMessage обрабатывает сообщение о транзакции (обеспечивает семантику exactly once)
-func (svc *PaymentService) ProcessTransactionMessage(message map[string]interface{}) error {
-	transactionId := message["transaction_id"].(string)
-	userId := message["user_id"].(string)
-	amount := message["amount"].(float64)
+// Transfer переводит средства другому пользователю. Повторный запрос с тем же ключом
+// идемпотентности не списывает деньги второй раз и возвращает тот же ответ, что и первый,
+// с балансом отправителя сразу после перевода.
+func (svc *PaymentService) Transfer(ctx context.Context, userId string, recipientId string, amount money.Amount, idempotencyKey string) (TransferResult, error) {
+	switch {
+	case !amount.IsPositive():
+		return TransferResult{}, ErrInvalidAmount
+	case recipientId == "":
+		return TransferResult{}, fmt.Errorf("%w: recipient is required", ErrInvalidTransfer)
+	case recipientId == userId:
+		return TransferResult{}, fmt.Errorf("%w: cannot transfer to the same account", ErrInvalidTransfer)
+	case idempotencyKey == "":
+		return TransferResult{}, fmt.Errorf("%w: idempotency key is required", ErrInvalidTransfer)
+	case len(idempotencyKey) > maxIdempotencyKeyLength:
+		return TransferResult{}, fmt.Errorf("%w: idempotency key is longer than %d characters", ErrInvalidTransfer, maxIdempotencyKeyLength)
+	}
+
+	// Ключ уникален в пределах отправителя, поэтому ID перевода выводится из обоих значений
+	transferId := uuid.NewSHA1(uuid.NameSpaceURL, []byte("transfer:"+userId+"\x00"+idempotencyKey)).String()
+	result := TransferResult{TransferID: transferId, RecipientID: recipientId, Amount: amount, Currency: money.Currency}
+
+	balance, err := svc.repo.Transfer(ctx, transferId, userId, recipientId, amount)
+	if errors.Is(err, repository.ErrTransactionAlreadyProcessed) {
+		err = nil
+		result.Replayed = true
+	}
+	if err != nil {
+		return TransferResult{}, err
+	}
 
-	// Обрабатываем транзакцию и обеспечиваем семантику exactly once
-	return svc.repo.ProcessTransaction(transactionId, userId, amount)
+	result.Balance = balance
+	return result, nil
 }
 
-// PublishTransactionToKafka публикует сообщение о транзакции в Kafka
-func (svc *PaymentService) PublishTransactionToKafka(transactionId, userId string, amount float64) error {
-	// Создаем новый Kafka writer для отправки сообщений
-	writer := kafka.NewWriter(kafka.WriterConfig{
-		Brokers:  []string{"kafka:9093"}, // Хост Kafka
-		Topic:    "payment_transactions", // Топик Kafka
-		Balancer: &kafka.LeastBytes{},
-	})
+// Adjust применяет ручную корректировку баланса от имени администратора actor
+// с записью в журнал проводок
+func (svc *PaymentService) Adjust(ctx context.Context, userId string, amount money.Amount, reason string, actor string) (money.Amount, error) {
+	if actor == "" {
+		return 0, ErrActorRequired
+	}
+	if amount == 0 {
+		return 0, fmt.Errorf("%w: amount must not be zero", ErrInvalidAdjustment)
+	}
+	if reason == "" {
+		return 0, fmt.Errorf("%w: reason is required", ErrInvalidAdjustment)
+	}
+	balance, err := svc.repo.Adjust(ctx, userId, amount, reason, actor)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Admin %s adjusted balance of %s by %s: %s", actor, userId, amount, reason)
+	return balance, nil
+}
+
+// AuditAccount сверяет баланс пользователя с журналом проводок
+func (svc *PaymentService) AuditAccount(ctx context.Context, userId string) (repository.AccountAudit, error) {
+	return svc.repo.AuditAccount(ctx, userId)
+}
 
-	// Создаем сообщение
-	message := map[string]interface{}{
-		"transaction_id": transactionId,
-		"user_id":        userId,
-		"amount":         amount,
+// FindLedgerDrift возвращает аккаунты и проводки, расходящиеся с журналом
+func (svc *PaymentService) FindLedgerDrift(ctx context.Context) (repository.LedgerDrift, error) {
+	return svc.repo.FindLedgerDrift(ctx)
+}
+
+// ListTransactions возвращает страницу истории операций по счету пользователя, начиная с новых.
+// Курсор следующей страницы пуст, если операций больше нет.
+func (svc *PaymentService) ListTransactions(ctx context.Context, userId string, query TransactionQuery) (TransactionPage, error) {
+	filter := repository.TransactionFilter{From: query.From, To: query.To, Limit: query.Limit}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultTransactionsLimit
+	}
+	if filter.Limit > maxTransactionsLimit {
+		filter.Limit = maxTransactionsLimit
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return TransactionPage{}, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+	if query.Cursor != "" {
+		entryId, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return TransactionPage{}, err
+		}
+		filter.BeforeEntry = entryId
 	}
 
-	// Преобразуем сообщение в формат JSON
-	body, err := json.Marshal(message)
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	filter.Limit++
+	transactions, err := svc.repo.ListTransactions(ctx, userId, filter)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+
+	page := TransactionPage{Currency: money.Currency, Transactions: transactions}
+	if len(transactions) == filter.Limit {
+		page.Transactions = transactions[:filter.Limit-1]
+		page.NextCursor = encodeCursor(page.Transactions[len(page.Transactions)-1].EntryID)
+	}
+	return page, nil
+}
+
+// ProcessTransactionMessage обрабатывает команду на оплату заказа: резервирует сумму холдом
+// (с семантикой exactly once) и публикует результат оплаты для order-service
+func (svc *PaymentService) ProcessTransactionMessage(ctx context.Context, command events.TransactionCommand) error {
+	transactionId := command.TransactionID
+	orderId := command.OrderID
+	result := PaymentResult{Type: events.PaymentSucceeded, PaymentResult: events.PaymentResult{
+		TransactionID: transactionId,
+		OrderID:       orderId,
+		UserID:        command.UserID,
+		Amount:        command.Amount,
+		Currency:      money.Currency,
+	}}
+
+	if err := validateCommand(command); err != nil {
+		log.Printf("Rejecting transaction %s: %v", transactionId, err)
+		result.Type = events.PaymentFailed
+		result.Reason = ReasonInvalidAmount
+		return svc.PublishPaymentResult(ctx, result)
+	}
+
+	// Резервируем сумму заказа холдом с семантикой exactly once. Баланс по журналу
+	// не меняется до списания холда при выполнении заказа.
+	err := svc.repo.PlaceHold(ctx, transactionId, orderId, command.UserID, command.Amount, svc.holdTTL)
+	switch {
+	case err == nil:
+	case errors.Is(err, repository.ErrTransactionAlreadyProcessed):
+		// Повторная доставка: результат публикуем еще раз, на случай если первая публикация не дошла
+		log.Printf("Transaction %s already processed, republishing result", transactionId)
+	case errors.Is(err, repository.ErrAccountNotFound):
+		result.Type = events.PaymentFailed
+		result.Reason = ReasonAccountNotFound
+	case errors.Is(err, repository.ErrInsufficientFunds):
+		// Баланс не изменился, заказ получает отказ с типизированной причиной
+		result.Type = events.PaymentFailed
+		result.Reason = ReasonInsufficientFunds
+	default:
+		return err
+	}
+
+	return svc.PublishPaymentResult(ctx, result)
+}
+
+// ProcessRefundMessage обрабатывает команду на возврат средств по отмененному заказу
+// и публикует результат возврата для order-service. Несписанный холд просто снимается.
+func (svc *PaymentService) ProcessRefundMessage(ctx context.Context, command events.TransactionCommand) error {
+	refundId := command.TransactionID
+	result := PaymentResult{Type: events.RefundCompleted, PaymentResult: events.PaymentResult{
+		TransactionID: refundId,
+		OrderID:       command.OrderID,
+		UserID:        command.UserID,
+		Amount:        command.Amount,
+		Currency:      money.Currency,
+	}}
+
+	if err := validateCommand(command); err != nil {
+		log.Printf("Rejecting refund %s: %v", refundId, err)
+		result.Type = events.RefundFailed
+		result.Reason = ReasonInvalidAmount
+		return svc.PublishPaymentResult(ctx, result)
+	}
+
+	err := svc.repo.RefundTransaction(ctx, refundId, command.OrderID, command.UserID, command.Amount)
+	switch {
+	case err == nil:
+	case errors.Is(err, repository.ErrTransactionAlreadyProcessed):
+		log.Printf("Refund %s already processed, republishing result", refundId)
+	case errors.Is(err, repository.ErrAccountNotFound):
+		result.Type = events.RefundFailed
+		result.Reason = ReasonAccountNotFound
+	default:
+		return err
+	}
+
+	return svc.PublishPaymentResult(ctx, result)
+}
+
+// ProcessCaptureMessage списывает холд выполненного заказа и публикует результат списания
+func (svc *PaymentService) ProcessCaptureMessage(ctx context.Context, command events.TransactionCommand) error {
+	captureId := command.TransactionID
+	result := PaymentResult{Type: events.CaptureCompleted, PaymentResult: events.PaymentResult{
+		TransactionID: captureId,
+		OrderID:       command.OrderID,
+		UserID:        command.UserID,
+		Amount:        command.Amount,
+		Currency:      money.Currency,
+	}}
+
+	if err := validateCommand(command); err != nil {
+		log.Printf("Rejecting capture %s: %v", captureId, err)
+		result.Type = events.CaptureFailed
+		result.Reason = ReasonInvalidAmount
+		return svc.PublishPaymentResult(ctx, result)
+	}
+
+	err := svc.repo.CaptureHold(ctx, captureId, command.OrderID, command.UserID, command.Amount)
+	switch {
+	case err == nil:
+	case errors.Is(err, repository.ErrTransactionAlreadyProcessed):
+		log.Printf("Capture %s already processed, republishing result", captureId)
+	case errors.Is(err, repository.ErrHoldNotFound):
+		result.Type = events.CaptureFailed
+		result.Reason = ReasonHoldNotFound
+	case errors.Is(err, repository.ErrHoldNotActive):
+		// Холд успел истечь или был снят при отмене заказа
+		result.Type = events.CaptureFailed
+		result.Reason = ReasonHoldNotActive
+	default:
+		return err
+	}
+
+	return svc.PublishPaymentResult(ctx, result)
+}
+
+// PublishPaymentResult публикует результат оплаты заказа в топик payment_results
+func (svc *PaymentService) PublishPaymentResult(ctx context.Context, result PaymentResult) error {
+	// ID события выводится из ID транзакции, поэтому повторная публикация дает то же событие
+	event, err := events.New(result.Type, result.TransactionID, result.OrderID, result.PaymentResult)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("error marshaling message: %v", err)
 	}
 
-	// Отправляем сообщение в Kafka
-	err = writer.WriteMessages(context.Background(), kafka.Message{
+	// Ключ — пользователь, как у команд: результаты по одному счету читаются по порядку
+	err = svc.publisher.Publish(ctx, bus.Message{
+		Topic: svc.topics.PaymentResults,
+		Key:   []byte(result.UserID),
 		Value: body,
 	})
 	if err != nil {
-		return fmt.Errorf("error sending message to Kafka: %v", err)
+		return fmt.Errorf("error publishing payment result: %v", err)
 	}
 
-	log.Printf("Sent transaction %s to Kafka", transactionId)
+	log.Printf("Sent %s for transaction %s", result.Type, result.TransactionID)
 	return nil
 }
 
-// ProcessTransactionMessageFromKafka слушает сообщения в Kafka и обрабатывает их
-func (svc *PaymentService) ProcessTransactionMessageFromKafka() {
-	// Создаем Kafka reader для получения сообщений
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{"kafka:9093"}, // Хост Kafka
-		Topic:   "payment_transactions", // Топик Kafka
-		GroupID: "payment-service",      // Группа подписчиков
-	})
+// ConsumeTransactions слушает команды на оплату заказов и обрабатывает их, пока не отменен ctx
+func (svc *PaymentService) ConsumeTransactions(ctx context.Context) error {
+	return svc.consume(ctx, svc.topics.PaymentTransactions, events.PaymentRequested, svc.ProcessTransactionMessage)
+}
 
-	for {
-		// Создаем контекст для чтения сообщений
-		ctx := context.Background()
+// ConsumeCaptures слушает команды на списание холдов и обрабатывает их, пока не отменен ctx
+func (svc *PaymentService) ConsumeCaptures(ctx context.Context) error {
+	return svc.consume(ctx, svc.topics.PaymentCaptures, events.CaptureRequested, svc.ProcessCaptureMessage)
+}
 
-		// Чтение сообщения из Kafka
-		msg, err := reader.ReadMessage(ctx)
-		if err != nil {
-			log.Printf("Failed to read message: %v. Retrying...", err)
-			continue
-		}
+// ConsumeRefunds слушает команды на возврат средств и обрабатывает их, пока не отменен ctx
+func (svc *PaymentService) ConsumeRefunds(ctx context.Context) error {
+	return svc.consume(ctx, svc.topics.PaymentRefunds, events.RefundRequested, svc.ProcessRefundMessage)
+}
 
-		var message map[string]interface{}
-		err = json.Unmarshal(msg.Value, &message)
-		if err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
-			continue
+// consume читает команды типа eventType из топика и передает их в handle.
+// Команды, которые не удалось разобрать, уходят в карантин.
+func (svc *PaymentService) consume(ctx context.Context, topic string, eventType string, handle func(context.Context, events.TransactionCommand) error) error {
+	return svc.subscriber.Subscribe(ctx, topic, events.Handler(svc.quarantine, func(ctx context.Context, event events.Envelope) error {
+		if err := event.Expect(eventType); err != nil {
+			return err
+		}
+		var command events.TransactionCommand
+		if err := event.DecodePayload(&command); err != nil {
+			return err
 		}
 
-		// Обрабатываем транзакцию
-		err = svc.ProcessTransactionMessage(message)
-		if err != nil {
-			log.Printf("Error processing transaction: %v", err)
-		} else {
-			log.Printf("Transaction processed successfully")
+		// Ошибка обработки повторяется по политике подписчика, а затем команда уходит в dead-letter топик
+		if err := handle(ctx, command); err != nil {
+			return fmt.Errorf("could not process %s %s: %w", event.Type, command.TransactionID, err)
 		}
-	}
+		log.Printf("Message from %s processed successfully", topic)
+		return nil
+	}))
 }
@@ -1,14 +1,26 @@
 package main
 
 import (
+	"common/bus"
+	"common/deadletter"
+	"common/health"
+	"common/httpserver"
+	"common/metrics"
+	"common/tracing"
+	"context"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"log"
-	"net/http"
+	"os"
+	"os/signal"
+	"payment-service/app"
 	_ "payment-service/docs"
-	"payment-service/internal/handler"
+	"payment-service/internal/config"
 	"payment-service/internal/repository"
-	"payment-service/internal/service"
+	"syscall"
+	"time"
 )
 
 // @title Payment Service API
@@ -17,25 +29,124 @@ import (
 // @host localhost:8082
 // @BasePath /
 func main() {
-	db, err := repository.InitDB()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Could not load configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Trace context is always propagated between services; spans are exported as configured
+	shutdownTracing, err := tracing.Setup(ctx, "payment-service", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Could not set up tracing: %v", err)
+	}
+
+	// Postgres and Kafka may come up later than the service: retry them with backoff for up to StartupTimeout
+	startupCtx, cancelStartup := context.WithTimeout(ctx, time.Duration(cfg.StartupTimeout))
+	defer cancelStartup()
+	db, err := repository.InitDB(startupCtx, cfg.Database.ConnString())
 	if err != nil {
 		log.Fatalf("Could not initialize database: %v", err)
 	}
 
-	paymentRepo := repository.NewPaymentRepository(db)
-	paymentSvc := service.NewPaymentService(paymentRepo)
-	paymentHandler := handler.NewPaymentHandler(paymentSvc)
+	// "payment-service migrate <command>" applies or rolls back migrations and exits
+	migrator, err := repository.NewMigrator(db)
+	if err != nil {
+		log.Fatalf("Could not load migrations: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrator.RunCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+	if cfg.AutoMigrate {
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Fatalf("Could not migrate database: %v", err)
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+	}
+	// The service does not start on a schema of a different version
+	if err := migrator.Check(); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
+	}
 
-	go paymentSvc.ProcessTransactionMessageFromKafka()
+	checkKafka := func(ctx context.Context) error { return bus.CheckBrokers(ctx, cfg.Kafka.Brokers) }
+	if err := health.Wait(startupCtx, "kafka", checkKafka); err != nil {
+		log.Fatalf("Kafka is unavailable: %v", err)
+	}
+
+	// One producer for the whole service: payment results, the dead-letter topic and the admin API share it
+	publisher, err := bus.NewKafkaPublisher(cfg.Kafka.Brokers, bus.ProducerConfig{
+		Acks:         cfg.Kafka.Producer.Acks,
+		BatchSize:    cfg.Kafka.Producer.BatchSize,
+		BatchTimeout: time.Duration(cfg.Kafka.Producer.BatchTimeout),
+		Compression:  cfg.Kafka.Producer.Compression,
+		MaxAttempts:  cfg.Kafka.Producer.MaxAttempts,
+	})
+	if err != nil {
+		log.Fatalf("Could not create Kafka producer: %v", err)
+	}
+	deadLetters := deadletter.NewPostgresStore(db, repository.DeadLettersTable)
+	paymentApp := app.New(repository.NewPaymentRepository(db), deadLetters, publisher, bus.NewKafkaSubscriber(cfg.Kafka.Brokers, cfg.Kafka.ConsumerGroup, cfg.Kafka.ConsumerWorkers), app.Config{
+		Topics: cfg.Topics,
+		// A message that still fails after several attempts goes to the dead-letter topic
+		Retry: bus.RetryPolicy{
+			MaxAttempts:     cfg.Kafka.Retry.MaxAttempts,
+			InitialBackoff:  time.Duration(cfg.Kafka.Retry.InitialBackoff),
+			MaxBackoff:      time.Duration(cfg.Kafka.Retry.MaxBackoff),
+			DeadLetterTopic: cfg.Kafka.DeadLetterTopic,
+		},
+		HoldTTL: time.Duration(cfg.HoldTTL),
+	})
+	paymentApp.Start(ctx)
+
+	// The service is ready when the database and Kafka are reachable and all consumers are running
+	readiness := health.NewChecker()
+	readiness.Add("database", db.PingContext)
+	readiness.Add("kafka", checkKafka)
+	readiness.Add("consumers", paymentApp.CheckConsumers)
 
 	r := mux.NewRouter()
+	// Request latency per route for /metrics
+	r.Use(metrics.Middleware)
+	r.Use(tracing.Middleware)
 
 	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
-	r.HandleFunc("/payment/{user_id}", paymentHandler.CreateAccount).Methods("POST")
-	r.HandleFunc("/payment/{user_id}", paymentHandler.GetBalance).Methods("GET")
-	r.HandleFunc("/payment/{user_id}/deposit", paymentHandler.Deposit).Methods("PUT")
+	metrics.RegisterDB(db, "payment-service")
+	r.Handle("/metrics", promhttp.Handler())
+	r.HandleFunc("/healthz", health.Live).Methods("GET")
+	r.Handle("/readyz", readiness).Methods("GET")
+
+	paymentApp.Routes(r)
 
-	log.Println("Payment service started on :8082")
-	log.Fatal(http.ListenAndServe(":8082", r))
+	// On SIGINT/SIGTERM the server stops accepting requests and waits for in-flight ones
+	addr := fmt.Sprintf(":%d", cfg.Port)
+	log.Printf("Payment service started on %s", addr)
+	serveErr := httpserver.Serve(ctx, addr, tracing.Handler(r), time.Duration(cfg.ShutdownTimeout))
+
+	// Shut down in reverse order: background tasks commit what they processed,
+	// the producer flushes buffered messages, and only then the database is closed
+	log.Printf("Payment service stopping")
+	stop()
+	paymentApp.Wait()
+	if err := publisher.Close(); err != nil {
+		log.Printf("Failed to close Kafka producer: %v", err)
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+	if serveErr != nil {
+		log.Fatalf("HTTP server failed: %v", serveErr)
+	}
+	log.Printf("Payment service stopped")
 }